@@ -1,7 +1,12 @@
+--
+-- Sets up the database of the docker setup on its first start. It equals the
+-- migrations 1 to 9 of pkg/storage/migrations and records them as applied,
+-- every later change of the schema is a migration only.
+--
+
 --
 -- Schema zlr_ca
 --
-DROP SCHEMA IF EXISTS zlr_ca CASCADE;
 CREATE SCHEMA IF NOT EXISTS zlr_ca;
 
 --
@@ -18,12 +23,23 @@ create table if not exists zlr_ca.icecream
   image_open             varchar(200),
   image_closed           varchar(200),
   allergy_info           varchar(200),
-  dietary_certifications varchar(50)
+  dietary_certifications varchar(50),
+  version                integer      not null default 1,
+  updated_at             timestamptz  not null default now(),
+  deleted_at             timestamptz,
+  search_vector          tsvector generated always as (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(story, '')), 'C')
+  ) stored
 );
 
 create unique index if not exists icecream_product_id_uindex
   on zlr_ca.icecream (product_id);
 
+create index if not exists icecream_search_vector_index
+  on zlr_ca.icecream using gin (search_vector);
+
 --
 -- Table ingredients
 --
@@ -99,4 +115,110 @@ on delete cascade;
 alter table zlr_ca.icecream_has_sourcing_values
   add constraint icecream_has_sourcing_values_sourcing_values_id_fk
 foreign key (sourcing_values_id) references zlr_ca.sourcing_values (id)
-on delete cascade;
\ No newline at end of file
+on delete cascade;
+
+
+--
+-- Table audit_log
+--
+create table zlr_ca.audit_log
+(
+  id         bigserial    not null
+    constraint audit_log_pkey
+    primary key,
+  entity     varchar(50)  not null,
+  entity_id  varchar(50)  not null,
+  action     varchar(20)  not null,
+  username   varchar(100) not null,
+  request_id varchar(100),
+  before     jsonb,
+  after      jsonb,
+  created_at timestamptz  not null default now()
+);
+
+create index audit_log_entity_index
+  on zlr_ca.audit_log (entity, entity_id, id);
+
+create index audit_log_username_index
+  on zlr_ca.audit_log (username, created_at);
+
+
+--
+-- Table icecream_revisions
+--
+create table zlr_ca.icecream_revisions
+(
+  icecream_product_id integer      not null,
+  revision            integer      not null,
+  icecream            jsonb,
+  valid_from          timestamptz  not null default now(),
+  username            varchar(100) not null,
+  constraint icecream_revisions_icecream_product_id_revision_pk
+  primary key (icecream_product_id, revision)
+);
+
+
+--
+-- Table users
+--
+create table zlr_ca.users
+(
+  id            serial       not null
+    constraint users_pkey
+    primary key,
+  username      varchar(100) not null,
+  password_hash varchar(100) not null,
+  role          varchar(20)  not null default 'viewer',
+  disabled      boolean      not null default false,
+  failed_logins integer      not null default 0,
+  locked_until  timestamptz,
+  created_at    timestamptz  not null default now()
+);
+
+create unique index users_username_uindex
+  on zlr_ca.users (username);
+
+--
+-- Table api_keys
+--
+create table zlr_ca.api_keys
+(
+  id         serial       not null
+    constraint api_keys_pkey
+    primary key,
+  name       varchar(100) not null,
+  prefix     varchar(20)  not null,
+  role       varchar(20)  not null default 'viewer',
+  key_hash   varchar(64)  not null,
+  created_by varchar(100) not null,
+  created_at timestamptz  not null default now()
+);
+
+create unique index api_keys_name_uindex
+  on zlr_ca.api_keys (name);
+
+create unique index api_keys_key_hash_uindex
+  on zlr_ca.api_keys (key_hash);
+
+--
+-- Table schema_migrations
+--
+create table zlr_ca.schema_migrations
+(
+  version    bigint       not null
+    constraint schema_migrations_pkey
+    primary key,
+  name       varchar(200) not null,
+  applied_at timestamptz  not null
+);
+
+insert into zlr_ca.schema_migrations (version, name, applied_at) values
+  (1, 'baseline', now()),
+  (2, 'search', now()),
+  (3, 'versions', now()),
+  (4, 'trash', now()),
+  (5, 'audit', now()),
+  (6, 'revisions', now()),
+  (7, 'users', now()),
+  (8, 'api_keys', now()),
+  (9, 'roles', now());
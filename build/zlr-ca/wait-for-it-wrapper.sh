@@ -14,4 +14,4 @@ sleep 5
 # .. and then finally start the server
 #
 
-server -h ${DB_HOST} -pt ${DB_PORT} -u ${DB_USER} -p ${DB_PSWD} -d ${DB_NAME} -s ${DB_SCHEMA}
\ No newline at end of file
+server
\ No newline at end of file
@@ -6,19 +6,23 @@ import (
 	"io/ioutil"
 	"time"
 
+	"github.com/fraenky8/zlr-ca/pkg/config"
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
 	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
 )
 
 // go run main.go -h 192.168.99.100 -pt 5432 -u postgres -p mysecretpassword -d postgres -s zlr_ca
+// go run -tags sqlite main.go -driver sqlite -dsn kiosk.db
 func main() {
 	start := time.Now()
 	fmt.Println("starting import of icecream.json")
 
-	db, err := storage.NewPostgres(
-		storage.NewConfigByCmdArgs(),
-	)
+	loader := config.NewLoader("import")
+	dbConfig := config.Database(loader)
+	loader.Parse()
+
+	db, err := storage.Open(dbConfig)
 
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/config"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/migrations"
+)
+
+const usage = `usage: migrate [database flags] <command>
+
+commands:
+  up          applies all pending migrations
+  down <n>    reverts the latest n applied migrations
+  status      lists all migrations and whether they are applied
+  force <v>   records the migrations up to version v as applied without running any,
+              e.g. to adopt a database set up by hand, 0 forgets all migrations`
+
+// migrates the schema of the database
+// go run main.go -h 192.168.99.100 -pt 5432 -u postgres -p mysecretpassword -d postgres -s zlr_ca up
+// go run -tags sqlite main.go -driver sqlite -dsn kiosk.db status
+func main() {
+
+	loader := config.NewLoader("migrate")
+	dbConfig := config.Database(loader)
+	loader.Parse()
+
+	db, err := storage.Open(dbConfig)
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err = run(migrator, loader.Args()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(migrator *migrations.Migrator, args []string) error {
+
+	if len(args) == 1 {
+		switch args[0] {
+		case "up":
+			applied, err := migrator.Up()
+			for _, migration := range applied {
+				fmt.Printf("applied %d %s\n", migration.Version, migration.Name)
+			}
+			if err != nil {
+				return err
+			}
+			return printVersion(migrator)
+
+		case "status":
+			return status(migrator)
+		}
+	}
+
+	if len(args) != 2 {
+		return errors.New(usage)
+	}
+
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n < 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "down":
+		reverted, err := migrator.Down(int(n))
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "force":
+		if err = migrator.Force(n); err != nil {
+			return err
+		}
+
+	default:
+		return errors.New(usage)
+	}
+
+	return printVersion(migrator)
+}
+
+func status(migrator *migrations.Migrator) error {
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = "applied at " + status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d %-20s %s\n", status.Version, status.Name, applied)
+	}
+
+	return nil
+}
+
+func printVersion(migrator *migrations.Migrator) error {
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("schema is at version %d\n", version)
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/config"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+)
+
+// purges the trash: finally deletes icecreams which are in the trash for longer than -older
+// go run main.go -older 720h -h 192.168.99.100 -pt 5432 -u postgres -p mysecretpassword -d postgres -s zlr_ca
+func main() {
+
+	loader := config.NewLoader("purge")
+	dbConfig := config.Database(loader)
+
+	var older time.Duration
+	loader.Duration(&older, "purge.older", "older", 0, "only purge icecreams deleted longer ago than this, e.g. 720h")
+
+	loader.Parse()
+
+	db, err := storage.Open(dbConfig)
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer db.Close()
+
+	purged, err := repos.NewIcecreamRepo(db).Purge(time.Now().Add(-older))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("purged %d icecreams from the trash\n", purged)
+}
@@ -1,35 +1,81 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 
 	"github.com/fraenky8/zlr-ca/pkg/api"
+	"github.com/fraenky8/zlr-ca/pkg/auth"
+	"github.com/fraenky8/zlr-ca/pkg/config"
+	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/memory"
+	"github.com/fraenky8/zlr-ca/pkg/storage/migrations"
 	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
 )
 
-// go run main.go -h 192.168.99.100 -pt 5432 -u postgres -p mysecretpassword -d postgres -s zlr_ca
+// go run main.go -jwt-key jwt.secret -h 192.168.99.100 -pt 5432 -u postgres -p mysecretpassword -d postgres -s zlr_ca
+// go run -tags sqlite main.go -driver sqlite -dsn kiosk.db -migrate
+// ZLR_SERVER_ADMIN_PASSWORD_FILE=admin.secret go run main.go -store memory -admin frank -seed cmd/import/icecream.json
+// ZLR_DB_HOST=postgres ZLR_DB_PASSWORD_FILE=/run/secrets/db-password go run main.go -config zlr-ca.yaml
 func main() {
 
-	db, err := storage.NewPostgres(
-		storage.NewConfigByCmdArgs(),
-	)
+	loader := config.NewLoader("server")
+	serverConfig := config.Server(loader)
+	dbConfig := config.Database(loader)
 
-	if err != nil {
-		fmt.Println(err)
-		return
+	var store, seed, admin, adminPassword string
+	var migrate bool
+	loader.String(&store, "server.store", "store", "database", "where to keep the data, database (see -driver) or memory")
+	loader.String(&seed, "server.seed", "seed", "", "json file with icecreams to start the memory store with, e.g. cmd/import/icecream.json")
+	loader.String(&admin, "server.admin", "admin", "", "name of the admin the memory store starts with, needs -admin-password")
+	loader.Secret(&adminPassword, "server.admin_password", "admin-password", "password of the admin the memory store starts with")
+	loader.Bool(&migrate, "server.migrate", "migrate", false, "apply the pending migrations of the database on start")
+
+	loader.Verify(func() error {
+		if (admin == "") != (adminPassword == "") {
+			return fmt.Errorf("the admin of the memory store needs both a name and a password")
+		}
+		return nil
+	})
+
+	loader.Parse()
+
+	var repository *repos.Repository
+	var err error
+
+	switch store {
+	case "database":
+		var db storage.Database
+		if db, err = storage.Open(dbConfig); err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer db.Close()
+
+		if migrate {
+			if err = migrateDatabase(db); err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+
+		repository, err = repos.NewRepository(db)
+	case "memory":
+		repository, err = newMemoryRepository(admin, adminPassword, seed)
+	default:
+		err = fmt.Errorf("unknown store %q, use database or memory", store)
 	}
-	defer db.Close()
 
-	repository, err := repos.NewRepository(db)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
 	s, err := api.NewServer(
-		&api.ServerConfig{},
+		serverConfig,
 		repository,
 	)
 	if err != nil {
@@ -39,3 +85,61 @@ func main() {
 
 	log.Fatal(s.Run())
 }
+
+// migrateDatabase applies the pending migrations, see cmd/migrate
+func migrateDatabase(db storage.Database) error {
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		log.Printf("applied migration %d %s", migration.Version, migration.Name)
+	}
+
+	return err
+}
+
+// newMemoryRepository starts with the admin, if any, and the icecreams of the seed file, if any.
+// Without an admin nobody can sign in, the memory store has no users otherwise.
+func newMemoryRepository(admin, adminPassword, seed string) (*repos.Repository, error) {
+
+	repository, err := memory.NewRepository(memory.NewStore())
+	if err != nil {
+		return nil, err
+	}
+
+	if admin == "" {
+		log.Printf("the memory store has no users, start it with -admin and ZLR_SERVER_ADMIN_PASSWORD to sign in")
+	} else {
+		hash, err := auth.HashPassword(adminPassword)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = repository.UserService.Create(admin, hash, domain.RoleAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	if seed == "" {
+		return repository, nil
+	}
+
+	b, err := ioutil.ReadFile(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	var icecreams []*domain.Icecream
+	if err = json.Unmarshal(b, &icecreams); err != nil {
+		return nil, fmt.Errorf("could not read seed %s: %v", seed, err)
+	}
+
+	if _, err = repository.IcecreamService.Creates(icecreams); err != nil {
+		return nil, fmt.Errorf("could not seed icecreams: %v", err)
+	}
+
+	return repository, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/auth"
+	"github.com/fraenky8/zlr-ca/pkg/config"
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+)
+
+const usage = `usage: users [database flags] <command>
+
+commands:
+  list                     lists all users
+  add <username> [role]    adds a user, a viewer by default, the password is read from stdin
+  reset <username>         sets a new password read from stdin and lifts a lock
+  role <username> <role>   changes the role of the user to viewer, editor or admin
+  disable <username>       denies the user any access
+  enable <username>        allows the user access again`
+
+// manages the users allowed to access the api
+// echo 's3cr3t!' | go run main.go -h 192.168.99.100 -pt 5432 -u postgres -p mysecretpassword -d postgres -s zlr_ca add frank editor
+func main() {
+
+	loader := config.NewLoader("users")
+	dbConfig := config.Database(loader)
+	loader.Parse()
+
+	db, err := storage.Open(dbConfig)
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer db.Close()
+
+	if err = run(repos.NewUsersRepo(db), loader.Args()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(users domain.UserService, args []string) error {
+
+	if len(args) == 1 && args[0] == "list" {
+		return list(users)
+	}
+
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New(usage)
+	}
+
+	command, username := args[0], args[1]
+
+	role := domain.RoleViewer
+	if len(args) == 3 {
+		if command != "add" && command != "role" {
+			return errors.New(usage)
+		}
+		role = domain.Role(args[2])
+		if err := role.Verify(); err != nil {
+			return err
+		}
+	}
+
+	switch command {
+	case "add":
+		if err := (domain.User{Username: username}).Verify(); err != nil {
+			return err
+		}
+		hash, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if _, err = users.Create(username, hash, role); err == domain.ErrAlreadyExists {
+			return fmt.Errorf("user %s already exists", username)
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("added user %s as %s\n", username, role)
+
+	case "reset":
+		hash, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err = users.SetPassword(username, hash); err != nil {
+			return err
+		}
+		fmt.Printf("reset password of user %s\n", username)
+
+	case "role":
+		if len(args) != 3 {
+			return errors.New(usage)
+		}
+		if err := users.SetRole(username, role); err != nil {
+			return err
+		}
+		fmt.Printf("changed role of user %s to %s\n", username, role)
+
+	case "disable", "enable":
+		if err := users.SetDisabled(username, command == "disable"); err != nil {
+			return err
+		}
+		fmt.Printf("%sd user %s\n", command, username)
+
+	default:
+		return errors.New(usage)
+	}
+
+	return nil
+}
+
+func list(users domain.UserService) error {
+
+	all, err := users.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range all {
+		status := "active"
+		if user.Disabled {
+			status = "disabled"
+		} else if user.Locked(time.Now()) {
+			status = "locked until " + user.LockedUntil.Format(time.RFC3339)
+		}
+		fmt.Printf("%-20s %-8s %s\n", user.Username, user.Role, status)
+	}
+
+	return nil
+}
+
+// readPassword reads the password from the first line of stdin and hashes it
+func readPassword() ([]byte, error) {
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return nil, fmt.Errorf("could not read password from stdin: %v", err)
+	}
+
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return nil, fmt.Errorf("password must not be empty")
+	}
+
+	return auth.HashPassword(password)
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/auth"
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Credentials are exchanged for a token at /auth/token
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// authenticate accepts either BasicAuth with the credentials of a user or a bearer
+// token, which is an api key or a JWT issued by /auth/token. It reports whether
+// the request is authenticated, otherwise the request got aborted.
+func (s *Server) authenticate(c *gin.Context) bool {
+
+	header := c.GetHeader("Authorization")
+
+	if strings.HasPrefix(header, "Bearer ") {
+		return s.bearerAuth(c, strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	}
+
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return s.unauthorized(c)
+	}
+
+	user, err := s.login(username, password)
+	if err != nil {
+		log.Printf("could not login user %s: %v", username, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return false
+	}
+
+	if user == nil {
+		return s.unauthorized(c)
+	}
+
+	return s.authenticated(c, user.Username, user.Role)
+}
+
+func (s *Server) bearerAuth(c *gin.Context, token string) bool {
+
+	if auth.IsAPIKey(token) {
+		apiKey, err := s.repo.APIKeyService.ReadByHash(auth.HashAPIKey(token))
+		if err != nil {
+			log.Printf("could not read api key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+			return false
+		}
+
+		if apiKey == nil {
+			return s.unauthorized(c)
+		}
+
+		return s.authenticated(c, apiKey.Principal(), apiKey.Role)
+	}
+
+	username, err := s.tokens.Verify(token)
+	if err != nil {
+		return s.unauthorized(c)
+	}
+
+	// the user may have been disabled since the token was issued
+	user, err := s.repo.UserService.Read(username)
+	if err != nil {
+		log.Printf("could not read user %s: %v", username, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return false
+	}
+
+	if user == nil || user.Disabled {
+		return s.unauthorized(c)
+	}
+
+	return s.authenticated(c, user.Username, user.Role)
+}
+
+// authenticated passes the identity on to the following handlers
+func (s *Server) authenticated(c *gin.Context, principal string, role domain.Role) bool {
+	c.Set(gin.AuthUserKey, principal)
+	c.Set(RequestRoleKey, role)
+	return true
+}
+
+// login returns the user if the password is right and the user may log in, nil otherwise.
+// After too many failed logins in a row a user gets locked for a while.
+func (s *Server) login(username, password string) (*domain.User, error) {
+
+	user, err := s.repo.UserService.Read(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		// check anyway, so an unknown user takes as long as a wrong password
+		auth.CheckPassword(nil, password)
+		return nil, nil
+	}
+
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		if err := s.repo.UserService.LoginFailed(user.Username, s.config.MaxFailedLogins, s.config.Lockout); err != nil {
+			log.Printf("could not count failed login of user %s: %v", user.Username, err)
+		}
+		return nil, nil
+	}
+
+	// a disabled or locked user gets no hint whether the password was right
+	if user.Disabled || user.Locked(time.Now()) {
+		return nil, nil
+	}
+
+	if user.FailedLogins > 0 {
+		if err := s.repo.UserService.LoginSucceeded(user.Username); err != nil {
+			log.Printf("could not reset failed logins of user %s: %v", user.Username, err)
+		}
+	}
+
+	return user, nil
+}
+
+func (s *Server) unauthorized(c *gin.Context) bool {
+	c.Writer.Header().Add("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	c.Writer.Header().Add("WWW-Authenticate", `Bearer realm="Authorization Required"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, FailStringResponse("invalid credentials"))
+	return false
+}
+
+// issueToken exchanges the credentials of a user for a JWT
+func (s *Server) issueToken(c *gin.Context) {
+
+	var credentials Credentials
+	if !bindJSONRequest(c, &credentials, "credentials") {
+		return
+	}
+
+	user, err := s.login(credentials.Username, credentials.Password)
+	if err != nil {
+		log.Printf("could not login user %s: %v", credentials.Username, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, FailStringResponse("invalid credentials"))
+		return
+	}
+
+	token, expiresAt, err := s.tokens.Issue(user.Username)
+	if err != nil {
+		log.Printf("could not issue token: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("could not issue token, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(&TokenResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+	}))
+}
+
+func (s *Server) readAPIKeys(c *gin.Context) {
+
+	apiKeys, err := s.repo.APIKeyService.ReadAll()
+	if err != nil {
+		log.Printf("could not get api keys: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&APIKeysResponse{APIKeys: apiKeys}),
+	)
+}
+
+// createAPIKey returns the new key only this once, afterwards just its hash is known
+func (s *Server) createAPIKey(c *gin.Context) {
+
+	var request domain.APIKey
+	if !bindJSONRequest(c, &request, "api key") {
+		return
+	}
+
+	if request.Role == "" {
+		request.Role = domain.RoleViewer
+	}
+
+	if err := request.Verify(); err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	key, hash, err := auth.NewAPIKey()
+	if err != nil {
+		log.Printf("could not generate api key: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("could not generate api key, please try again later"))
+		return
+	}
+
+	apiKey, err := s.repo.APIKeyService.Create(&domain.APIKey{
+		Name:      request.Name,
+		Role:      request.Role,
+		Prefix:    key[:len(auth.APIKeyPrefix)+8],
+		Hash:      hash,
+		CreatedBy: c.GetString(gin.AuthUserKey),
+	})
+	if err == domain.ErrAlreadyExists {
+		c.JSON(http.StatusConflict, FailStringResponse("api key with name = "+request.Name+" already exists"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not create api key: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(
+		&APIKeyCreatedResponse{APIKey: apiKey, Key: key}),
+	)
+}
+
+func (s *Server) deleteAPIKey(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	apiKey, err := s.repo.APIKeyService.ReadById(id)
+	if err != nil {
+		log.Printf("could not get api key: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if apiKey == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no api key found"))
+		return
+	}
+
+	if err = s.repo.APIKeyService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, FailResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/evanphx/json-patch"
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// errMalformedPatch marks a patch document which could not be decoded at all,
+// in contrast to a well-formed patch which could not be applied to the icecream
+type errMalformedPatch struct {
+	err error
+}
+
+func (e errMalformedPatch) Error() string {
+	return fmt.Sprintf("malformed patch document: %v", e.err)
+}
+
+// applyIcecreamPatch applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// document to the json representation of the icecream and returns the patched icecream
+func applyIcecreamPatch(icecream *domain.Icecream, contentType string, body []byte) (*domain.Icecream, error) {
+
+	doc, err := icecreamDocument(icecream)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	switch contentType {
+	case MergePatchContentType:
+		if !json.Valid(body) {
+			return nil, errMalformedPatch{fmt.Errorf("invalid json")}
+		}
+		if patched, err = jsonpatch.MergePatch(doc, body); err != nil {
+			return nil, errMalformedPatch{err}
+		}
+	case JSONPatchContentType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, errMalformedPatch{err}
+		}
+		if patched, err = patch.Apply(doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+
+	var result domain.Icecream
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, fmt.Errorf("patched icecream is invalid: %v", err)
+	}
+
+	return &result, nil
+}
+
+// icecreamDocument marshals the icecream with ingredients and sourcing values always
+// present, so that JSON Patch paths like /ingredients/- can be applied to empty lists
+func icecreamDocument(icecream *domain.Icecream) ([]byte, error) {
+
+	b, err := json.Marshal(icecream)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, relation := range domain.IcecreamRelations {
+		if _, ok := doc[string(relation)]; !ok {
+			doc[string(relation)] = []interface{}{}
+		}
+	}
+
+	return json.Marshal(doc)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// Access is what a request needs to pass a route. The zero value
+// lets any authenticated user pass.
+type Access struct {
+	// Public routes need no authentication at all
+	Public bool
+	// Role is required additionally to the authentication
+	Role domain.Role
+}
+
+var (
+	PublicAccess        = Access{Public: true}
+	AuthenticatedAccess = Access{}
+)
+
+func RoleAccess(role domain.Role) Access {
+	return Access{Role: role}
+}
+
+func (a Access) Verify() error {
+	if a.Public && a.Role != "" {
+		return fmt.Errorf("public access cannot require role %s", a.Role)
+	}
+	if a.Role != "" {
+		return a.Role.Verify()
+	}
+	return nil
+}
+
+func (a Access) String() string {
+	if a.Public {
+		return "public"
+	}
+	if a.Role == "" {
+		return "authenticated"
+	}
+	return string(a.Role)
+}
+
+// Policy declares the access to all routes of a resource group by their method.
+// The zero value lets any authenticated user pass.
+type Policy struct {
+	// Read are GET, HEAD and OPTIONS requests
+	Read Access
+	// Write are POST, PUT and PATCH requests
+	Write  Access
+	Delete Access
+}
+
+func (p Policy) Verify() error {
+	for _, a := range []Access{p.Read, p.Write, p.Delete} {
+		if err := a.Verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Access returns the access needed for a request with the given method
+func (p Policy) Access(method string) Access {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return p.Read
+	case http.MethodDelete:
+		return p.Delete
+	}
+	return p.Write
+}
+
+// DefaultPolicies of the resource groups: reads need a viewer, creating and
+// changing an editor, deleting as well as managing the access to the api an admin
+func DefaultPolicies() map[string]Policy {
+
+	catalogue := Policy{
+		Read:   RoleAccess(domain.RoleViewer),
+		Write:  RoleAccess(domain.RoleEditor),
+		Delete: RoleAccess(domain.RoleAdmin),
+	}
+
+	return map[string]Policy{
+		"/auth": {
+			Read:   PublicAccess,
+			Write:  PublicAccess,
+			Delete: PublicAccess,
+		},
+		"/icecreams":      catalogue,
+		"/ingredients":    catalogue,
+		"/sourcingvalues": catalogue,
+		"/search":         catalogue,
+		"/audit":          catalogue,
+		"/apikeys": {
+			Read:   RoleAccess(domain.RoleAdmin),
+			Write:  RoleAccess(domain.RoleAdmin),
+			Delete: RoleAccess(domain.RoleAdmin),
+		},
+	}
+}
+
+// RouteAccess is the effective access of a single route
+type RouteAccess struct {
+	Method string
+	Path   string
+	Access Access
+}
+
+// group registers a resource group whose routes are guarded by the policy
+// configured for its path. A group without policy needs an authenticated user.
+func (s *Server) group(path string) *gin.RouterGroup {
+	policy := s.config.Policies[path]
+	s.policies[path] = policy
+	return s.engine.Group(path, s.enforce(policy))
+}
+
+// enforce lets only requests pass which satisfy the policy
+func (s *Server) enforce(policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		access := policy.Access(c.Request.Method)
+		if access.Public {
+			c.Next()
+			return
+		}
+
+		if !s.authenticate(c) {
+			return
+		}
+
+		role, _ := c.Get(RequestRoleKey)
+		if r, ok := role.(domain.Role); access.Role != "" && (!ok || !r.Includes(access.Role)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, FailStringResponse("permission denied, role "+string(access.Role)+" required"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AccessMatrix returns the effective access of all routes ordered by path and
+// method. Routes outside of any group are public.
+func (s *Server) AccessMatrix() []RouteAccess {
+
+	var matrix []RouteAccess
+	for _, route := range s.engine.Routes() {
+		access := PublicAccess
+		group := ""
+		for path, policy := range s.policies {
+			if (route.Path == path || strings.HasPrefix(route.Path, path+"/")) && len(path) > len(group) {
+				group, access = path, policy.Access(route.Method)
+			}
+		}
+		matrix = append(matrix, RouteAccess{Method: route.Method, Path: route.Path, Access: access})
+	}
+
+	sort.Slice(matrix, func(i, j int) bool {
+		if matrix[i].Path != matrix[j].Path {
+			return matrix[i].Path < matrix[j].Path
+		}
+		return matrix[i].Method < matrix[j].Method
+	})
+
+	return matrix
+}
+
+// reportAccess logs the access matrix, so the effective policies are visible on start
+func (s *Server) reportAccess() {
+	log.Printf("access to the routes:")
+	for _, route := range s.AccessMatrix() {
+		log.Printf("  %-7s %-45s %s", route.Method, route.Path, route.Access)
+	}
+}
@@ -3,6 +3,7 @@ package api
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 )
@@ -30,20 +31,64 @@ type IcecreamsResponse struct {
 	Icecreams []*domain.Icecream `json:"icecreams"`
 }
 
+// IcecreamsReplaceResponse additionally lists the product ids of the icecreams
+// which did not exist before
+type IcecreamsReplaceResponse struct {
+	Icecreams []*domain.Icecream `json:"icecreams"`
+	Created   []int64            `json:"created"`
+}
+
+// IcecreamsSearchResponse looks like IcecreamsResponse, additionally every
+// icecream carries its score and highlighted snippets.
+type IcecreamsSearchResponse struct {
+	Icecreams []*domain.IcecreamSearchResult `json:"icecreams"`
+}
+
+// IcecreamsPageResponse is one page of a listing. Icecreams holds either
+// the full icecreams or only the selected fields of them.
+type IcecreamsPageResponse struct {
+	Icecreams interface{} `json:"icecreams"`
+	Total     int64       `json:"total"`
+	Links     PageLinks   `json:"links"`
+}
+
+type PageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
 type IngredientResponse struct {
 	Ingredient domain.Ingredients `json:"ingredients"`
 }
 
+// IngredientsResponse holds the ingredients of several icecreams keyed by their product id
 type IngredientsResponse struct {
-	Ingredients []domain.Ingredients `json:"ingredients"`
+	Ingredients map[int64]domain.Ingredients `json:"ingredients"`
+}
+
+type IngredientEntryResponse struct {
+	Ingredient *domain.IngredientEntry `json:"ingredient"`
+}
+
+type IngredientEntriesResponse struct {
+	Ingredients []*domain.IngredientEntry `json:"ingredients"`
 }
 
 type SourcingValueResponse struct {
 	SourcingValue domain.SourcingValues `json:"sourcing_values"`
 }
 
+// SourcingValuesResponse holds the sourcing values of several icecreams keyed by their product id
 type SourcingValuesResponse struct {
-	SourcingValues []domain.SourcingValues `json:"sourcing_values"`
+	SourcingValues map[int64]domain.SourcingValues `json:"sourcing_values"`
+}
+
+type SourcingValueEntryResponse struct {
+	SourcingValue *domain.SourcingValueEntry `json:"sourcing_value"`
+}
+
+type SourcingValueEntriesResponse struct {
+	SourcingValues []*domain.SourcingValueEntry `json:"sourcing_values"`
 }
 
 type ErrorsResponse struct {
@@ -84,3 +129,35 @@ func ErrorResponse(message string) Response {
 		Message: message,
 	}
 }
+
+type AuditEntriesResponse struct {
+	Entries []*domain.AuditEntry `json:"entries"`
+}
+
+type IcecreamRevisionResponse struct {
+	Revision *domain.IcecreamRevision `json:"revision"`
+}
+
+type IcecreamRevisionsResponse struct {
+	Revisions []*domain.IcecreamRevision `json:"revisions"`
+}
+
+type IcecreamDiffResponse struct {
+	Diff *domain.IcecreamDiff `json:"diff"`
+}
+
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type APIKeysResponse struct {
+	APIKeys []*domain.APIKey `json:"api_keys"`
+}
+
+// APIKeyCreatedResponse carries the key itself, which is never shown again
+type APIKeyCreatedResponse struct {
+	APIKey *domain.APIKey `json:"api_key"`
+	Key    string         `json:"key"`
+}
@@ -1,12 +1,17 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fraenky8/zlr-ca/pkg/auth"
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
 	"github.com/gin-contrib/gzip"
@@ -16,19 +21,47 @@ import (
 const (
 	DefaultPort = "8080"
 
-	RequestIcecreamKey = "icecreams"
+	DefaultMaxFailedLogins = 5
+	DefaultLockout         = 15 * time.Minute
+
+	DefaultTokenAlgorithm = auth.HS256
+	DefaultTokenTTL       = time.Hour
+
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+
+	RequestIcecreamKey      = "icecreams"
+	RequestIcecreamPatchKey = "icecreampatches"
+	RequestIngredientKey    = "ingredient"
+	RequestSourcingValueKey = "sourcingvalue"
+	RequestIdKey            = "requestid"
+	RequestRoleKey          = "role"
+
+	RequestIdHeader = "X-Request-ID"
 )
 
-// accounts holds some fake accounts for BasicAuth middleware
-var accounts = gin.Accounts{
-	"frank": "fr4nk!",
-	"seb":   "th!rstY",
-	"sarah": "!c3cre4M",
+// icecreamFields are the fields of an icecream which can be selected in a listing
+var icecreamFields = []string{
+	"productId", "name", "description", "story", "image_closed", "image_open",
+	"allergy_info", "dietary_certifications", "sourcing_values", "ingredients",
 }
 
 type ServerConfig struct {
 	Port string
 	Mode string
+
+	// MaxFailedLogins in a row lock a user for the Lockout duration
+	MaxFailedLogins int
+	Lockout         time.Duration
+
+	// TokenKeyFile holds the secret for HS256 or the private key for RS256 to sign
+	// the tokens, which are valid for TokenTTL
+	TokenAlgorithm string
+	TokenKeyFile   string
+	TokenTTL       time.Duration
+
+	// Policies override the DefaultPolicies of the resource groups by their path
+	Policies map[string]Policy
 }
 
 func (s *ServerConfig) Verify() error {
@@ -38,13 +71,54 @@ func (s *ServerConfig) Verify() error {
 	if s.Mode == "" {
 		s.Mode = gin.DebugMode
 	}
+	if s.MaxFailedLogins <= 0 {
+		s.MaxFailedLogins = DefaultMaxFailedLogins
+	}
+	if s.Lockout <= 0 {
+		s.Lockout = DefaultLockout
+	}
+	if s.TokenAlgorithm == "" {
+		s.TokenAlgorithm = DefaultTokenAlgorithm
+	}
+	if s.TokenTTL <= 0 {
+		s.TokenTTL = DefaultTokenTTL
+	}
+
+	if port, err := strconv.Atoi(s.Port); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %q", s.Port)
+	}
+	switch s.Mode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		return fmt.Errorf("unknown mode %q, use %s, %s or %s", s.Mode, gin.DebugMode, gin.ReleaseMode, gin.TestMode)
+	}
+	switch strings.ToUpper(s.TokenAlgorithm) {
+	case auth.HS256, auth.RS256:
+	default:
+		return fmt.Errorf("unknown token algorithm %q, use %s or %s", s.TokenAlgorithm, auth.HS256, auth.RS256)
+	}
+
+	policies := DefaultPolicies()
+	for path, policy := range s.Policies {
+		if _, ok := policies[path]; !ok {
+			return fmt.Errorf("policy for unknown resource group %s", path)
+		}
+		if err := policy.Verify(); err != nil {
+			return fmt.Errorf("invalid policy for %s: %v", path, err)
+		}
+		policies[path] = policy
+	}
+	s.Policies = policies
+
 	return nil
 }
 
 type Server struct {
-	config *ServerConfig
-	repo   *repos.Repository
-	engine *gin.Engine
+	config   *ServerConfig
+	repo     *repos.Repository
+	tokens   *auth.Tokens
+	engine   *gin.Engine
+	policies map[string]Policy
 }
 
 func NewServer(config *ServerConfig, repo *repos.Repository) (*Server, error) {
@@ -57,20 +131,29 @@ func NewServer(config *ServerConfig, repo *repos.Repository) (*Server, error) {
 		return nil, fmt.Errorf("could not create server with repo: %v", err)
 	}
 
+	tokens, err := auth.NewTokens(config.TokenAlgorithm, config.TokenKeyFile, config.TokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("could not create server with config: %v", err)
+	}
+
 	gin.SetMode(config.Mode)
 	engine := gin.Default()
 	engine.Use(gzip.Gzip(gzip.DefaultCompression))
+	engine.Use(requestId)
 
 	s := &Server{
-		config: config,
-		repo:   repo,
-		engine: engine,
+		config:   config,
+		repo:     repo,
+		tokens:   tokens,
+		engine:   engine,
+		policies: make(map[string]Policy),
 	}
 
 	return s.setupRoutes(), nil
 }
 
 func (s *Server) Run() error {
+	s.reportAccess()
 	return s.engine.Run(":" + s.config.Port)
 }
 
@@ -87,28 +170,51 @@ func (s *Server) setupRoutes() *Server {
 	// empty "" routes here  to avoid a 307 redirect response
 	// so it only occures when query has trailing slash
 
-	icecreams := s.engine.Group("/icecreams", gin.BasicAuth(accounts))
+	// the access to every group is declared by its policy, see DefaultPolicies
+
+	icecreams := s.group("/icecreams")
 	{
 		create := icecreams.Group("").Use(s.icecreamRequest)
 		{
 			create.POST("", s.createIcecreams)
-			create.PUT("", s.createIcecreams)
+			create.PUT("", s.replaceIcecreams)
 		}
 
+		// a single icecream is put as object, not wrapped in an array
+		icecreams.PUT("/:ids", s.replaceIcecream)
+
 		read := icecreams.Group("")
 		{
-			read.GET("", s.readIcecreams)
+			read.GET("", s.listIcecreams)
+			read.GET("/trash", s.readTrash)
 			read.GET("/:ids", s.readIcecreams)
 			read.GET("/:ids/", s.readIcecreams)
 			read.GET("/:ids/ingredients", s.readIcecreamIngredients)
 			read.GET("/:ids/sourcingvalues", s.readIcecreamSourcingValues)
+			read.GET("/:ids/history", s.readIcecreamHistory)
+			read.GET("/:ids/revisions", s.readIcecreamRevisions)
+			read.GET("/:ids/revisions/:rev", s.readIcecreamRevision)
+			read.GET("/:ids/diff", s.diffIcecreamRevisions)
+		}
+
+		relations := icecreams.Group("")
+		{
+			relations.POST("/:ids/ingredients", s.createIcecreamIngredients)
+			relations.POST("/:ids/sourcingvalues", s.createIcecreamSourcingValues)
 		}
 
-		update := icecreams.Group("").Use(s.icecreamRequest)
+		icecreams.POST("/:ids/restore", s.restoreIcecreams)
+		icecreams.POST("/:ids/revisions/:rev/revert", s.revertIcecream)
+
+		update := icecreams.Group("").Use(s.icecreamPatchRequest)
 		{
 			update.PATCH("", s.updateIcecreams)
 		}
 
+		// a single icecream is patched by a merge patch or json patch document
+		// which is not an array of icecreams, so it bypasses icecreamPatchRequest
+		icecreams.PATCH("/:ids", s.patchIcecream)
+
 		// delete collides with an in-built function
 		del := icecreams.Group("")
 		{
@@ -122,28 +228,71 @@ func (s *Server) setupRoutes() *Server {
 			del.DELETE("/:ids/ingredients", func(c *gin.Context) {
 				c.JSON(http.StatusMethodNotAllowed, FailStringResponse("deleting all ingredients of an icecream is not allowed"))
 			})
-			del.DELETE("/:ids/ingredients/:name", func(c *gin.Context) {
-				c.JSON(http.StatusNotImplemented, ErrorResponse("not implemented yet"))
-			})
-			del.DELETE("/:ids/sourcingvalues/:name", func(c *gin.Context) {
-				c.JSON(http.StatusNotImplemented, ErrorResponse("not implemented yet"))
-			})
+			del.DELETE("/:ids/ingredients/:name", s.deleteIcecreamIngredient)
+			del.DELETE("/:ids/sourcingvalues/:name", s.deleteIcecreamSourcingValue)
 		}
 	}
 
-	ingredients := s.engine.Group("/ingredients")
+	s.group("/search").GET("", s.searchIcecreams)
+	s.group("/audit").GET("", s.readAudit)
+
+	s.group("/auth").POST("/token", s.issueToken)
+
+	apikeys := s.group("/apikeys")
+	{
+		apikeys.GET("", s.readAPIKeys)
+		apikeys.POST("", s.createAPIKey)
+		apikeys.DELETE("/:id", s.deleteAPIKey)
+	}
+
+	ingredients := s.group("/ingredients")
 	{
 		ingredients.GET("", s.readIngredients)
+		ingredients.GET("/:id", s.readIngredient)
+		ingredients.POST("", s.ingredientRequest, s.createIngredient)
+		ingredients.PATCH("/:id", s.ingredientRequest, s.updateIngredient)
+		ingredients.DELETE("/:id", s.deleteIngredient)
 	}
 
-	sourcingvalues := s.engine.Group("/sourcingvalues")
+	sourcingvalues := s.group("/sourcingvalues")
 	{
 		sourcingvalues.GET("", s.readSourcingValues)
+		sourcingvalues.GET("/:id", s.readSourcingValue)
+		sourcingvalues.POST("", s.sourcingValueRequest, s.createSourcingValue)
+		sourcingvalues.PATCH("/:id", s.sourcingValueRequest, s.updateSourcingValue)
+		sourcingvalues.DELETE("/:id", s.deleteSourcingValue)
 	}
 
 	return s
 }
 
+// requestId identifies every request by the X-Request-ID header of the client
+// or by a random id if there is none. The id is recorded in the audit log.
+func requestId(c *gin.Context) {
+
+	id := strings.TrimSpace(c.GetHeader(RequestIdHeader))
+	if id == "" || len(id) > 100 {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			log.Printf("could not generate request id: %v", err)
+		}
+		id = hex.EncodeToString(b)
+	}
+
+	c.Set(RequestIdKey, id)
+	c.Header(RequestIdHeader, id)
+	c.Next()
+}
+
+// repository returns the repository which records all changes in the
+// audit log on behalf of the authenticated user of the request
+func (s *Server) repository(c *gin.Context) *repos.Repository {
+	return s.repo.As(&domain.Actor{
+		User:      c.GetString(gin.AuthUserKey),
+		RequestID: c.GetString(RequestIdKey),
+	})
+}
+
 func (s *Server) icecreamRequest(c *gin.Context) {
 
 	if !strings.Contains(c.ContentType(), "application/json") {
@@ -170,6 +319,78 @@ func (s *Server) icecreamRequest(c *gin.Context) {
 	c.Next()
 }
 
+func (s *Server) icecreamPatchRequest(c *gin.Context) {
+
+	var patches []*domain.IcecreamPatch
+	if !bindJSONRequest(c, &patches, "icecream") {
+		return
+	}
+
+	c.Set(RequestIcecreamPatchKey, patches)
+	c.Next()
+}
+
+func (s *Server) ingredientRequest(c *gin.Context) {
+
+	var ingredient domain.IngredientEntry
+	if !bindJSONRequest(c, &ingredient, "ingredient") {
+		return
+	}
+
+	if err := ingredient.Verify(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	c.Set(RequestIngredientKey, ingredient.Name)
+	c.Next()
+}
+
+func (s *Server) sourcingValueRequest(c *gin.Context) {
+
+	var sourcingValue domain.SourcingValueEntry
+	if !bindJSONRequest(c, &sourcingValue, "sourcing value") {
+		return
+	}
+
+	if err := sourcingValue.Verify(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	c.Set(RequestSourcingValueKey, sourcingValue.Description)
+	c.Next()
+}
+
+// bindJSONRequest binds the json body of the request into data. If that is not
+// possible the request gets aborted with a fail response and false is returned.
+func bindJSONRequest(c *gin.Context, data interface{}, name string) bool {
+
+	if !strings.Contains(c.ContentType(), "application/json") {
+		c.AbortWithStatusJSON(http.StatusBadRequest, FailStringResponse("only Content-Type: application/json is supported"))
+		return false
+	}
+
+	if c.Request.Body == nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, FailStringResponse("no "+name+" data provided"))
+		return false
+	}
+
+	if err := c.ShouldBindJSON(data); err != nil {
+		if err.Error() == "EOF" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, FailStringResponse("no "+name+" data provided"))
+			return false
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, FailResponse(fmt.Errorf("faulty data provided: %v", err)))
+		return false
+	}
+
+	return true
+}
+
+// readIcecreams returns the icecreams including all their relations. The relations
+// can be restricted with e.g. ?include=ingredients or left out with ?include=
+// A single icecream can be read as it was at a point in time with ?as_of=2018-08-01T00:00:00Z
 func (s *Server) readIcecreams(c *gin.Context) {
 
 	ids, err := convertIdsParam(c.Param("ids"))
@@ -178,7 +399,18 @@ func (s *Server) readIcecreams(c *gin.Context) {
 		return
 	}
 
-	icecreams, err := s.repo.IcecreamService.Reads(ids)
+	if asOf := strings.TrimSpace(c.Query("as_of")); asOf != "" {
+		s.readIcecreamAsOf(c, ids, asOf)
+		return
+	}
+
+	include, err := convertIncludeQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads(ids, include...)
 	if err != nil {
 		log.Printf("could not get icecream: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
@@ -186,6 +418,15 @@ func (s *Server) readIcecreams(c *gin.Context) {
 	}
 
 	if len(icecreams) == 1 {
+		if len(ids) == 1 {
+			etag := icecreamETag(icecreams[0])
+			c.Header("ETag", etag)
+			if matchETag(c.GetHeader("If-None-Match"), etag, true) {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+
 		c.JSON(http.StatusOK, SuccessResponse(
 			&IcecreamResponse{Icecream: icecreams[0]}),
 		)
@@ -202,165 +443,1680 @@ func (s *Server) readIcecreams(c *gin.Context) {
 	)
 }
 
-func (s *Server) readIcecreamIngredients(c *gin.Context) {
+// readIcecreamAsOf returns the revision of the icecream which was valid at the given time
+func (s *Server) readIcecreamAsOf(c *gin.Context, ids []int64, asOf string) {
 
-	ids, err := convertIdsParam(c.Param("ids"))
+	if len(ids) != 1 {
+		c.JSON(http.StatusBadRequest, FailStringResponse("as_of is only supported for a single icecream"))
+		return
+	}
+
+	at, err := time.Parse(time.RFC3339, asOf)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, FailResponse(err))
+		c.JSON(http.StatusBadRequest, FailStringResponse("invalid as_of provided: "+asOf+", must be RFC 3339"))
 		return
 	}
 
-	ingredients, err := s.repo.IngredientService.Reads(ids)
+	revision, err := s.repo.IcecreamRevisionService.AsOf(ids[0], at)
 	if err != nil {
-		log.Printf("could not get ingredients: %v", err)
+		log.Printf("could not get revision of icecream: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
 	}
 
-	if len(ingredients) == 1 {
-		c.JSON(http.StatusOK, SuccessResponse(
-			&IngredientResponse{Ingredient: ingredients[0]},
-		))
+	if revision == nil || revision.Icecream == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse(fmt.Sprintf("icecream with productId = %d did not exist at %s", ids[0], asOf)))
 		return
 	}
 
 	c.JSON(http.StatusOK, SuccessResponse(
-		&IngredientsResponse{Ingredients: ingredients}),
-	)
+		&IcecreamRevisionResponse{Revision: revision},
+	))
 }
 
-func (s *Server) readIcecreamSourcingValues(c *gin.Context) {
+// listIcecreams pages through all icecreams, e.g.
+// GET /icecreams?limit=10&sort=name,-product_id&fields=name,description
+// The listing can be filtered with the repeatable query parameters ingredient,
+// without_ingredient, sourcing_value, allergen, without_allergen and certification.
+func (s *Server) listIcecreams(c *gin.Context) {
 
-	ids, err := convertIdsParam(c.Param("ids"))
+	options, err := convertListQuery(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, FailResponse(err))
 		return
 	}
 
-	sourcingValues, err := s.repo.SourcingValueService.Reads(ids)
+	fields, err := convertFieldsQuery(c.Query("fields"))
 	if err != nil {
-		log.Printf("could not get sourcing values: %v", err)
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	// the relations are only loaded if they are selected
+	for _, relation := range domain.IcecreamRelations {
+		for _, field := range fields {
+			if field == string(relation) {
+				options.Include = append(options.Include, relation)
+			}
+		}
+	}
+
+	page, err := s.repo.IcecreamService.List(options)
+	if err == domain.ErrInvalidCursor {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+	if err != nil {
+		log.Printf("could not list icecreams: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
 	}
 
-	if len(sourcingValues) == 1 {
-		c.JSON(http.StatusOK, SuccessResponse(
-			&SourcingValueResponse{SourcingValue: sourcingValues[0]},
-		))
+	icecreams, err := selectFields(page.Icecreams, fields)
+	if err != nil {
+		log.Printf("could not select fields of icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("an error occured, please try again later"))
 		return
 	}
 
 	c.JSON(http.StatusOK, SuccessResponse(
-		&SourcingValuesResponse{SourcingValues: sourcingValues}),
-	)
+		&IcecreamsPageResponse{
+			Icecreams: icecreams,
+			Total:     page.Total,
+			Links: PageLinks{
+				Next: pageLink(c, page.Next),
+				Prev: pageLink(c, page.Prev),
+			},
+		},
+	))
 }
 
-func (s *Server) createIcecreams(c *gin.Context) {
+// readIcecreamHistory returns all recorded changes of the icecream, oldest first.
+// The history is kept even after the icecream got purged.
+func (s *Server) readIcecreamHistory(c *gin.Context) {
 
-	icecreams := c.MustGet(RequestIcecreamKey).([]*domain.Icecream)
+	id, err := convertIdParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
 
-	// if one icecream fails, all icecreams fail - "all or nothing"
-	for k, icecream := range icecreams {
-		if err := icecream.Verify(); err != nil {
-			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: %v", k, err)))
-			return
-		}
+	entries, err := s.repo.AuditService.History(domain.AuditEntityIcecream, strconv.FormatInt(id, 10))
+	if err != nil {
+		log.Printf("could not get history of icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
 
-		productId, err := strconv.Atoi(icecream.ProductID)
-		if err != nil {
-			log.Printf("faulty id: %v", err)
-			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: faulty productId provided: %s", k, icecream.ProductID)))
-			return
-		}
+	c.JSON(http.StatusOK, SuccessResponse(
+		&AuditEntriesResponse{Entries: entries},
+	))
+}
 
-		if existingIcecream, _ := s.repo.IcecreamService.Reads([]int64{int64(productId)}); existingIcecream != nil {
-			c.JSON(http.StatusBadRequest, FailStringResponse("icecream with productId = "+icecream.ProductID+" already exists"))
-			return
-		}
+// readIcecreamRevisions returns all revisions of the icecream, oldest first
+func (s *Server) readIcecreamRevisions(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
 	}
 
-	if _, err := s.repo.IcecreamService.Creates(icecreams); err != nil {
+	revisions, err := s.repo.IcecreamRevisionService.Revisions(id)
+	if err != nil {
+		log.Printf("could not get revisions of icecream: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
 		return
 	}
 
-	c.JSON(http.StatusCreated, SuccessResponse(
-		&IcecreamsResponse{Icecreams: icecreams},
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamRevisionsResponse{Revisions: revisions},
 	))
 }
 
-func (s *Server) updateIcecreams(c *gin.Context) {
+func (s *Server) readIcecreamRevision(c *gin.Context) {
 
-	icecreams := c.MustGet(RequestIcecreamKey).([]*domain.Icecream)
+	id, err := convertIdParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
 
-	for k, icecream := range icecreams {
-		if err := icecream.Verify(); err != nil {
-			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: %v", k, err)))
-			return
-		}
+	rev, err := convertRevision(c.Param("rev"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
 	}
 
-	if err := s.repo.IcecreamService.Updates(icecreams); err != nil {
-		c.JSON(http.StatusInternalServerError, FailResponse(err))
+	revision, ok := s.icecreamRevision(c, id, rev)
+	if !ok {
 		return
 	}
 
 	c.JSON(http.StatusOK, SuccessResponse(
-		&IcecreamsResponse{Icecreams: icecreams},
+		&IcecreamRevisionResponse{Revision: revision},
 	))
 }
 
-func (s *Server) deleteIcecreams(c *gin.Context) {
+// diffIcecreamRevisions compares two revisions of the icecream, e.g.
+// GET /icecreams/602/diff?from=1&to=3
+func (s *Server) diffIcecreamRevisions(c *gin.Context) {
 
-	ids, err := convertIdsParam(c.Param("ids"))
+	id, err := convertIdParam(c.Param("ids"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, FailResponse(err))
 		return
 	}
 
-	if err := s.repo.IcecreamService.Deletes(ids); err != nil {
-		c.JSON(http.StatusInternalServerError, FailResponse(err))
+	fromRev, err := convertRevision(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("from: %v", err)))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(nil))
+	toRev, err := convertRevision(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("to: %v", err)))
+		return
+	}
+
+	from, ok := s.icecreamRevision(c, id, fromRev)
+	if !ok {
+		return
+	}
+
+	to, ok := s.icecreamRevision(c, id, toRev)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamDiffResponse{Diff: domain.NewIcecreamDiff(from, to)},
+	))
 }
 
-func (s *Server) deleteIcecreamSourcingValues(c *gin.Context) {
+// revertIcecream replaces the icecream by the state of an earlier revision.
+// That creates a new revision, so a revert can be reverted as well.
+func (s *Server) revertIcecream(c *gin.Context) {
 
-	ids, err := convertIdsParam(c.Param("ids"))
+	id, err := convertIdParam(c.Param("ids"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, FailResponse(err))
 		return
 	}
 
-	if err := s.repo.SourcingValueService.Deletes(ids); err != nil {
-		c.JSON(http.StatusInternalServerError, FailResponse(err))
+	rev, err := convertRevision(c.Param("rev"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
 		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse(nil))
+	revision, ok := s.icecreamRevision(c, id, rev)
+	if !ok {
+		return
+	}
+
+	if revision.Icecream == nil {
+		c.JSON(http.StatusUnprocessableEntity, FailStringResponse(fmt.Sprintf("revision %d deleted the icecream, there is nothing to revert to", rev)))
+		return
+	}
+
+	if err := s.repository(c).IcecreamService.Revert(id, rev); err != nil {
+		log.Printf("could not revert icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads([]int64{id}, domain.IcecreamRelations...)
+	if err != nil || len(icecreams) == 0 {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.Header("ETag", icecreamETag(icecreams[0]))
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamResponse{Icecream: icecreams[0]},
+	))
 }
 
-func (s *Server) readIngredients(c *gin.Context) {
-	ingredients, err := s.repo.IngredientService.ReadAll()
+// icecreamRevision reads the revision and responds with 404 if it does not exist
+func (s *Server) icecreamRevision(c *gin.Context, id int64, rev int64) (*domain.IcecreamRevision, bool) {
+
+	revision, err := s.repo.IcecreamRevisionService.Revision(id, rev)
 	if err != nil {
-		log.Printf("could not get ingredients: %v", err)
+		log.Printf("could not get revision of icecream: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return nil, false
 	}
-	c.JSON(http.StatusOK, SuccessResponse(
-		&IngredientResponse{Ingredient: ingredients}),
-	)
+
+	if revision == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse(fmt.Sprintf("icecream with productId = %d has no revision %d", id, rev)))
+		return nil, false
+	}
+
+	return revision, true
 }
 
-func (s *Server) readSourcingValues(c *gin.Context) {
-	sourcingValues, err := s.repo.SourcingValueService.ReadAll()
+// readAudit returns the recorded changes of the whole catalogue,
+// e.g. GET /audit?user=frank&since=2018-08-01T00:00:00Z&limit=50
+func (s *Server) readAudit(c *gin.Context) {
+
+	filter := &domain.AuditFilter{
+		User: strings.TrimSpace(c.Query("user")),
+	}
+
+	if since := strings.TrimSpace(c.Query("since")); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, FailStringResponse("invalid since provided: "+since+", must be RFC 3339"))
+			return
+		}
+		filter.Since = t
+	}
+
+	limit, err := convertLimitQuery(c.Query("limit"))
 	if err != nil {
-		log.Printf("could not get sourcing values: %v", err)
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+	filter.Limit = limit
+
+	entries, err := s.repo.AuditService.Search(filter)
+	if err != nil {
+		log.Printf("could not get audit log: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
 	}
+
 	c.JSON(http.StatusOK, SuccessResponse(
-		&SourcingValueResponse{SourcingValue: sourcingValues}),
-	)
+		&AuditEntriesResponse{Entries: entries},
+	))
+}
+
+// searchIcecreams ranks the icecreams by relevance, e.g. GET /search?q=cheesecake
+func (s *Server) searchIcecreams(c *gin.Context) {
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, FailStringResponse("no search query provided"))
+		return
+	}
+
+	limit, err := convertLimitQuery(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	results, err := s.repo.IcecreamService.Search(query, limit)
+	if err != nil {
+		log.Printf("could not search icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamsSearchResponse{Icecreams: results},
+	))
+}
+
+func (s *Server) readIcecreamIngredients(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	if !s.icecreamsExist(c, ids) {
+		return
+	}
+
+	ingredients, err := s.repo.IngredientService.Reads(ids)
+	if err != nil {
+		log.Printf("could not get ingredients: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if len(ingredients) == 1 {
+		c.JSON(http.StatusOK, SuccessResponse(
+			&IngredientResponse{Ingredient: ingredients[ids[0]]},
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IngredientsResponse{Ingredients: ingredients}),
+	)
+}
+
+func (s *Server) readIcecreamSourcingValues(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	if !s.icecreamsExist(c, ids) {
+		return
+	}
+
+	sourcingValues, err := s.repo.SourcingValueService.Reads(ids)
+	if err != nil {
+		log.Printf("could not get sourcing values: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if len(sourcingValues) == 1 {
+		c.JSON(http.StatusOK, SuccessResponse(
+			&SourcingValueResponse{SourcingValue: sourcingValues[ids[0]]},
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&SourcingValuesResponse{SourcingValues: sourcingValues}),
+	)
+}
+
+// icecreamsExist answers 404 if one of the icecreams does not exist or is in the trash,
+// their relations are not to be read then
+func (s *Server) icecreamsExist(c *gin.Context, ids []int64) bool {
+
+	icecreams, err := s.repo.IcecreamService.Reads(ids)
+	if err != nil {
+		log.Printf("could not get icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return false
+	}
+
+	existing := make(map[string]bool)
+	for _, icecream := range icecreams {
+		existing[icecream.ProductID] = true
+	}
+
+	for _, id := range ids {
+		productId := strconv.FormatInt(id, 10)
+		if !existing[productId] {
+			c.JSON(http.StatusNotFound, FailStringResponse("icecream with productId = "+productId+" does not exist"))
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) createIcecreams(c *gin.Context) {
+
+	icecreams := c.MustGet(RequestIcecreamKey).([]*domain.Icecream)
+
+	// if one icecream fails, all icecreams fail - "all or nothing"
+	for k, icecream := range icecreams {
+		if err := icecream.Verify(); err != nil {
+			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: %v", k, err)))
+			return
+		}
+
+		if _, err := strconv.Atoi(icecream.ProductID); err != nil {
+			log.Printf("faulty id: %v", err)
+			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: faulty productId provided: %s", k, icecream.ProductID)))
+			return
+		}
+	}
+
+	// the repo refuses existing icecreams atomically, a check before could race with another request
+	_, err := s.repository(c).IcecreamService.Creates(icecreams)
+	if err == domain.ErrAlreadyExists {
+		c.JSON(http.StatusConflict, FailStringResponse("at least one icecream already exists, it might be in the trash"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not create icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(
+		&IcecreamsResponse{Icecreams: icecreams},
+	))
+}
+
+// replaceIcecreams is a bulk upsert: all icecreams are created or, if they exist,
+// replaced entirely including their relations. Repeating the request yields the
+// same icecreams, so it can be retried safely.
+func (s *Server) replaceIcecreams(c *gin.Context) {
+
+	icecreams := c.MustGet(RequestIcecreamKey).([]*domain.Icecream)
+
+	var ids []int64
+	for k, icecream := range icecreams {
+		if err := icecream.Verify(); err != nil {
+			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: %v", k, err)))
+			return
+		}
+
+		productId, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: faulty productId provided: %s", k, icecream.ProductID)))
+			return
+		}
+
+		ids = append(ids, productId)
+	}
+
+	created, err := s.repository(c).IcecreamService.Replaces(icecreams)
+	if err != nil {
+		log.Printf("could not replace icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	replaced, err := s.repo.IcecreamService.Reads(ids, domain.IcecreamRelations...)
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if created == nil {
+		created = []int64{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamsReplaceResponse{Icecreams: replaced, Created: created},
+	))
+}
+
+// replaceIcecream creates or entirely replaces a single icecream including its relations.
+// It responds with 201 if the icecream has been created and with 200 if it got replaced.
+func (s *Server) replaceIcecream(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	var icecream domain.Icecream
+	if !bindJSONRequest(c, &icecream, "icecream") {
+		return
+	}
+
+	productId := strconv.FormatInt(id, 10)
+	if icecream.ProductID == "" {
+		icecream.ProductID = productId
+	}
+	if icecream.ProductID != productId {
+		c.JSON(http.StatusBadRequest, FailStringResponse("productId "+icecream.ProductID+" does not match the url"))
+		return
+	}
+
+	if err := icecream.Verify(); err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	created, err := s.repository(c).IcecreamService.Replaces([]*domain.Icecream{&icecream})
+	if err != nil {
+		log.Printf("could not replace icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads([]int64{id}, domain.IcecreamRelations...)
+	if err != nil || len(icecreams) == 0 {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	status := http.StatusOK
+	if len(created) > 0 {
+		status = http.StatusCreated
+	}
+
+	c.Header("ETag", icecreamETag(icecreams[0]))
+	c.JSON(status, SuccessResponse(
+		&IcecreamResponse{Icecream: icecreams[0]},
+	))
+}
+
+// updateIcecreams partially updates the icecreams: only the given fields are changed,
+// fields set to null are cleared. Ingredients and sourcing values are either replaced
+// by an array or changed by an object like {"add": [...], "remove": [...]}. The If-Match
+// header must hold the current ETag of every icecream in the order of the patches, so
+// that no concurrent change gets overwritten.
+func (s *Server) updateIcecreams(c *gin.Context) {
+
+	patches := c.MustGet(RequestIcecreamPatchKey).([]*domain.IcecreamPatch)
+
+	var ids []int64
+	for k, patch := range patches {
+		if err := patch.Verify(); err != nil {
+			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: %v", k, err)))
+			return
+		}
+
+		productId, err := strconv.ParseInt(patch.ProductID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("icecream #%d: faulty productId provided: %s", k, patch.ProductID)))
+			return
+		}
+
+		ids = append(ids, productId)
+	}
+
+	versions, ok := ifMatchVersions(c, len(patches))
+	if !ok {
+		return
+	}
+
+	// the repo only applies the patches if nobody changed the icecreams in the meantime
+	for k, version := range versions {
+		patches[k].Version = version
+	}
+
+	err := s.repository(c).IcecreamService.Updates(patches)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse("at least one icecream does not exist"))
+		return
+	}
+	if err == domain.ErrVersionMismatch {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("at least one icecream has been changed in the meantime"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, FailResponse(err))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads(ids, domain.IcecreamRelations...)
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamsResponse{Icecreams: icecreams},
+	))
+}
+
+// patchIcecream applies a JSON Merge Patch (application/merge-patch+json) or a
+// JSON Patch (application/json-patch+json) to a single icecream. The patch is applied
+// to the current icecream and the difference is stored at once, so either all
+// operations succeed or none. The If-Match header must hold the current ETag of
+// the icecream so that no concurrent change gets overwritten.
+func (s *Server) patchIcecream(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	contentType := c.ContentType()
+	if contentType != MergePatchContentType && contentType != JSONPatchContentType {
+		c.JSON(http.StatusUnsupportedMediaType, FailStringResponse(
+			"content-type must be "+MergePatchContentType+" or "+JSONPatchContentType))
+		return
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, FailStringResponse("If-Match header required"))
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(fmt.Errorf("could not read request: %v", err)))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads([]int64{id}, domain.IcecreamRelations...)
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+	if len(icecreams) == 0 {
+		c.JSON(http.StatusNotFound, FailStringResponse(fmt.Sprintf("icecream with productId = %d does not exist", id)))
+		return
+	}
+	icecream := icecreams[0]
+
+	if !matchETag(ifMatch, icecreamETag(icecream), false) {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("icecream has been changed in the meantime"))
+		return
+	}
+
+	patched, err := applyIcecreamPatch(icecream, contentType, body)
+	if err != nil {
+		if _, ok := err.(errMalformedPatch); ok {
+			c.JSON(http.StatusBadRequest, FailResponse(err))
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, FailResponse(err))
+		return
+	}
+
+	if patched.ProductID != icecream.ProductID {
+		c.JSON(http.StatusUnprocessableEntity, FailStringResponse("productId cannot be changed"))
+		return
+	}
+
+	patch := domain.NewIcecreamPatch(icecream, patched)
+	if err := patch.Verify(); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, FailResponse(err))
+		return
+	}
+
+	// the repo only applies the patch if nobody changed the icecream since it was read
+	patch.Version = icecream.Version
+
+	err = s.repository(c).IcecreamService.Updates([]*domain.IcecreamPatch{patch})
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse(fmt.Sprintf("icecream with productId = %d does not exist", id)))
+		return
+	}
+	if err == domain.ErrVersionMismatch {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("icecream has been changed in the meantime"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, FailResponse(err))
+		return
+	}
+
+	icecreams, err = s.repo.IcecreamService.Reads([]int64{id}, domain.IcecreamRelations...)
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.Header("ETag", icecreamETag(icecreams[0]))
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamResponse{Icecream: icecreams[0]},
+	))
+}
+
+// deleteIcecreams deletes the icecreams, but only if the If-Match header holds the
+// current ETag of every icecream in the order of the ids. Either all are deleted or none.
+func (s *Server) deleteIcecreams(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	if len(ids) == 1 {
+		s.deleteIcecream(c, ids[0])
+		return
+	}
+
+	versions, ok := ifMatchVersions(c, len(ids))
+	if !ok {
+		return
+	}
+
+	err = s.repository(c).IcecreamService.Deletes(ids, versions)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse("at least one icecream does not exist"))
+		return
+	}
+	if err == domain.ErrVersionMismatch {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("at least one icecream has been changed in the meantime"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, FailResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+// readTrash returns the deleted icecreams including their relations
+func (s *Server) readTrash(c *gin.Context) {
+
+	icecreams, err := s.repo.IcecreamService.Trash()
+	if err != nil {
+		log.Printf("could not get trash: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if icecreams == nil {
+		icecreams = []*domain.Icecream{}
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamsResponse{Icecreams: icecreams},
+	))
+}
+
+// restoreIcecreams takes the icecreams out of the trash, either all or none
+func (s *Server) restoreIcecreams(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	err = s.repository(c).IcecreamService.Restores(ids)
+	if err == domain.ErrNotDeleted {
+		c.JSON(http.StatusNotFound, FailStringResponse("at least one icecream is not in the trash"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not restore icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads(ids, domain.IcecreamRelations...)
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IcecreamsResponse{Icecreams: icecreams},
+	))
+}
+
+func (s *Server) deleteIcecream(c *gin.Context, id int64) {
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, FailStringResponse("If-Match header required"))
+		return
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads([]int64{id})
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+	if len(icecreams) == 0 {
+		c.JSON(http.StatusNotFound, FailStringResponse(fmt.Sprintf("icecream with productId = %d does not exist", id)))
+		return
+	}
+
+	if !matchETag(ifMatch, icecreamETag(icecreams[0]), false) {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("icecream has been changed in the meantime"))
+		return
+	}
+
+	err = s.repository(c).IcecreamService.Delete(id, icecreams[0].Version)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse(fmt.Sprintf("icecream with productId = %d does not exist", id)))
+		return
+	}
+	if err == domain.ErrVersionMismatch {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("icecream has been changed in the meantime"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, FailResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+// deleteIcecreamSourcingValues removes all sourcing values of the icecreams, the sourcing
+// values themselves are kept
+func (s *Server) deleteIcecreamSourcingValues(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	_, ok := s.updateIcecreamRelations(c, ids, func(icecream *domain.Icecream) *domain.IcecreamPatch {
+		if len(icecream.SourcingValues) == 0 {
+			return nil
+		}
+		return &domain.IcecreamPatch{SourcingValues: domain.RelationPatch{Set: true, Replace: true}}
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+func (s *Server) createIcecreamIngredients(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	var ingredients domain.Ingredients
+	if !bindJSONRequest(c, &ingredients, "ingredients") {
+		return
+	}
+
+	if len(ingredients) == 0 {
+		c.JSON(http.StatusBadRequest, FailStringResponse("no ingredients data provided"))
+		return
+	}
+
+	if err := ingredients.Verify(); err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	var add []string
+	for _, ingredient := range ingredients {
+		add = append(add, string(ingredient))
+	}
+
+	_, ok := s.updateIcecreamRelations(c, ids, func(icecream *domain.Icecream) *domain.IcecreamPatch {
+		if containsAll(ingredientNames(icecream.Ingredients), add) {
+			return nil
+		}
+		return &domain.IcecreamPatch{Ingredients: domain.RelationPatch{Set: true, Add: add}}
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(
+		&IngredientResponse{Ingredient: ingredients},
+	))
+}
+
+func (s *Server) createIcecreamSourcingValues(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	var sourcingValues domain.SourcingValues
+	if !bindJSONRequest(c, &sourcingValues, "sourcing values") {
+		return
+	}
+
+	if len(sourcingValues) == 0 {
+		c.JSON(http.StatusBadRequest, FailStringResponse("no sourcing values data provided"))
+		return
+	}
+
+	if err := sourcingValues.Verify(); err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	var add []string
+	for _, sourcingValue := range sourcingValues {
+		add = append(add, string(sourcingValue))
+	}
+
+	_, ok := s.updateIcecreamRelations(c, ids, func(icecream *domain.Icecream) *domain.IcecreamPatch {
+		if containsAll(sourcingValueDescriptions(icecream.SourcingValues), add) {
+			return nil
+		}
+		return &domain.IcecreamPatch{SourcingValues: domain.RelationPatch{Set: true, Add: add}}
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(
+		&SourcingValueResponse{SourcingValue: sourcingValues},
+	))
+}
+
+func (s *Server) deleteIcecreamIngredient(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	ingredient := domain.Ingredient(c.Param("name"))
+	if err := ingredient.Verify(); err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	remove := []string{string(ingredient)}
+
+	updated, ok := s.updateIcecreamRelations(c, ids, func(icecream *domain.Icecream) *domain.IcecreamPatch {
+		if !containsAll(ingredientNames(icecream.Ingredients), remove) {
+			return nil
+		}
+		return &domain.IcecreamPatch{Ingredients: domain.RelationPatch{Set: true, Remove: remove}}
+	})
+	if !ok {
+		return
+	}
+
+	if updated == 0 {
+		c.JSON(http.StatusNotFound, FailStringResponse("ingredient "+string(ingredient)+" not found on given icecream(s)"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+func (s *Server) deleteIcecreamSourcingValue(c *gin.Context) {
+
+	ids, err := convertIdsParam(c.Param("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	sourcingValue := domain.SourcingValue(c.Param("name"))
+	if err := sourcingValue.Verify(); err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	remove := []string{string(sourcingValue)}
+
+	updated, ok := s.updateIcecreamRelations(c, ids, func(icecream *domain.Icecream) *domain.IcecreamPatch {
+		if !containsAll(sourcingValueDescriptions(icecream.SourcingValues), remove) {
+			return nil
+		}
+		return &domain.IcecreamPatch{SourcingValues: domain.RelationPatch{Set: true, Remove: remove}}
+	})
+	if !ok {
+		return
+	}
+
+	if updated == 0 {
+		c.JSON(http.StatusNotFound, FailStringResponse("sourcing value "+string(sourcingValue)+" not found on given icecream(s)"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+// updateIcecreamRelations changes the ingredients or sourcing values of the icecreams by
+// the patches which patch returns, nil leaves an icecream as it is. The patches are applied
+// by the IcecreamService, so every changed icecream gets a new version and revision like on
+// any other update. If the If-Match header is given, every icecream must still be at one of
+// its ETags. It returns the number of changed icecreams, otherwise an appropriate response
+// is written and false is returned.
+func (s *Server) updateIcecreamRelations(c *gin.Context, ids []int64, patch func(icecream *domain.Icecream) *domain.IcecreamPatch) (int, bool) {
+
+	versions, ok := ifMatchVersions(c, len(ids))
+	if !ok {
+		return 0, false
+	}
+
+	icecreams, err := s.repo.IcecreamService.Reads(ids, domain.IcecreamRelations...)
+	if err != nil {
+		log.Printf("could not get icecream: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return 0, false
+	}
+
+	existing := make(map[string]*domain.Icecream)
+	for _, icecream := range icecreams {
+		existing[icecream.ProductID] = icecream
+	}
+
+	var patches []*domain.IcecreamPatch
+	for k, id := range ids {
+		productId := strconv.FormatInt(id, 10)
+
+		icecream := existing[productId]
+		if icecream == nil {
+			c.JSON(http.StatusNotFound, FailStringResponse("icecream with productId = "+productId+" does not exist"))
+			return 0, false
+		}
+
+		// If-Match: * matches any version
+		version := icecream.Version
+		if versions != nil {
+			version = versions[k]
+		}
+
+		if version != icecream.Version {
+			c.JSON(http.StatusPreconditionFailed, FailStringResponse("icecream with productId = "+productId+" has been changed in the meantime"))
+			return 0, false
+		}
+
+		p := patch(icecream)
+		if p == nil {
+			continue
+		}
+
+		p.ProductID = productId
+
+		// the repo only applies the patch if nobody changed the icecream since it was matched
+		p.Version = version
+
+		patches = append(patches, p)
+	}
+
+	if len(patches) == 0 {
+		return 0, true
+	}
+
+	err = s.repository(c).IcecreamService.Updates(patches)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse("at least one icecream does not exist"))
+		return 0, false
+	}
+	if err == domain.ErrVersionMismatch {
+		c.JSON(http.StatusPreconditionFailed, FailStringResponse("icecream has been changed in the meantime"))
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("could not update icecreams: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return 0, false
+	}
+
+	if len(ids) == 1 {
+		if icecreams, err := s.repo.IcecreamService.Reads(ids); err == nil && len(icecreams) == 1 {
+			c.Header("ETag", icecreamETag(icecreams[0]))
+		}
+	}
+
+	return len(patches), true
+}
+
+func ingredientNames(ingredients domain.Ingredients) []string {
+	var names []string
+	for _, ingredient := range ingredients {
+		names = append(names, string(ingredient))
+	}
+	return names
+}
+
+func sourcingValueDescriptions(sourcingValues domain.SourcingValues) []string {
+	var descriptions []string
+	for _, sourcingValue := range sourcingValues {
+		descriptions = append(descriptions, string(sourcingValue))
+	}
+	return descriptions
+}
+
+// containsAll reports whether all values are among the given ones
+func containsAll(given []string, values []string) bool {
+	contained := make(map[string]bool)
+	for _, value := range given {
+		contained[value] = true
+	}
+	for _, value := range values {
+		if !contained[strings.TrimSpace(value)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) readIngredients(c *gin.Context) {
+	ingredients, err := s.repo.IngredientService.ReadAll()
+	if err != nil {
+		log.Printf("could not get ingredients: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IngredientEntriesResponse{Ingredients: ingredients}),
+	)
+}
+
+func (s *Server) readIngredient(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	ingredient, err := s.repo.IngredientService.ReadById(id)
+	if err != nil {
+		log.Printf("could not get ingredient: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if ingredient == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no ingredient found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IngredientEntryResponse{Ingredient: ingredient}),
+	)
+}
+
+func (s *Server) createIngredient(c *gin.Context) {
+
+	name := c.MustGet(RequestIngredientKey).(domain.Ingredient)
+
+	ingredient, err := s.repository(c).IngredientService.Create(name)
+	if err == domain.ErrAlreadyExists {
+		c.JSON(http.StatusConflict, FailStringResponse("ingredient with name = "+string(name)+" already exists"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not create ingredient: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(
+		&IngredientEntryResponse{Ingredient: ingredient}),
+	)
+}
+
+// updateIngredient renames an ingredient. If the new name is already taken
+// by another ingredient, both get merged and the remaining one is returned.
+func (s *Server) updateIngredient(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	name := c.MustGet(RequestIngredientKey).(domain.Ingredient)
+
+	ingredient, err := s.repository(c).IngredientService.Rename(id, name)
+	if err != nil {
+		log.Printf("could not rename ingredient: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if ingredient == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no ingredient found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&IngredientEntryResponse{Ingredient: ingredient}),
+	)
+}
+
+// deleteIngredient refuses to delete ingredients still used by an icecream
+// unless the query parameter force=true is given.
+func (s *Server) deleteIngredient(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	force, err := convertBoolQuery(c.Query("force"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	ingredient, err := s.repo.IngredientService.ReadById(id)
+	if err != nil {
+		log.Printf("could not get ingredient: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if ingredient == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no ingredient found"))
+		return
+	}
+
+	err = s.repository(c).IngredientService.Delete(id, force)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse("no ingredient found"))
+		return
+	}
+	if err == domain.ErrStillReferenced {
+		c.JSON(http.StatusConflict, FailStringResponse("ingredient is still used by at least one icecream, use force=true to delete anyway"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not delete ingredient: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+func (s *Server) readSourcingValues(c *gin.Context) {
+	sourcingValues, err := s.repo.SourcingValueService.ReadAll()
+	if err != nil {
+		log.Printf("could not get sourcing values: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+	c.JSON(http.StatusOK, SuccessResponse(
+		&SourcingValueEntriesResponse{SourcingValues: sourcingValues}),
+	)
+}
+
+func (s *Server) readSourcingValue(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	sourcingValue, err := s.repo.SourcingValueService.ReadById(id)
+	if err != nil {
+		log.Printf("could not get sourcing value: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if sourcingValue == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no sourcing value found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&SourcingValueEntryResponse{SourcingValue: sourcingValue}),
+	)
+}
+
+func (s *Server) createSourcingValue(c *gin.Context) {
+
+	description := c.MustGet(RequestSourcingValueKey).(domain.SourcingValue)
+
+	sourcingValue, err := s.repository(c).SourcingValueService.Create(description)
+	if err == domain.ErrAlreadyExists {
+		c.JSON(http.StatusConflict, FailStringResponse("sourcing value with description = "+string(description)+" already exists"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not create sourcing value: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse(
+		&SourcingValueEntryResponse{SourcingValue: sourcingValue}),
+	)
+}
+
+// updateSourcingValue renames a sourcing value for all icecreams at once. If the new
+// description is already taken, both get merged and the remaining one is returned.
+func (s *Server) updateSourcingValue(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	description := c.MustGet(RequestSourcingValueKey).(domain.SourcingValue)
+
+	sourcingValue, err := s.repository(c).SourcingValueService.Rename(id, description)
+	if err != nil {
+		log.Printf("could not rename sourcing value: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if sourcingValue == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no sourcing value found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(
+		&SourcingValueEntryResponse{SourcingValue: sourcingValue}),
+	)
+}
+
+// deleteSourcingValue refuses to delete sourcing values still used by an icecream
+// unless the query parameter force=true is given.
+func (s *Server) deleteSourcingValue(c *gin.Context) {
+
+	id, err := convertIdParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	force, err := convertBoolQuery(c.Query("force"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailResponse(err))
+		return
+	}
+
+	sourcingValue, err := s.repo.SourcingValueService.ReadById(id)
+	if err != nil {
+		log.Printf("could not get sourcing value: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	if sourcingValue == nil {
+		c.JSON(http.StatusNotFound, FailStringResponse("no sourcing value found"))
+		return
+	}
+
+	err = s.repository(c).SourcingValueService.Delete(id, force)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, FailStringResponse("no sourcing value found"))
+		return
+	}
+	if err == domain.ErrStillReferenced {
+		c.JSON(http.StatusConflict, FailStringResponse("sourcing value is still used by at least one icecream, use force=true to delete anyway"))
+		return
+	}
+	if err != nil {
+		log.Printf("could not delete sourcing value: %v", err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse("a database error occured, please try again later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse(nil))
+}
+
+func convertListQuery(c *gin.Context) (*domain.IcecreamListOptions, error) {
+
+	limit, err := convertLimitQuery(c.Query("limit"))
+	if err != nil {
+		return nil, err
+	}
+
+	options := &domain.IcecreamListOptions{
+		Limit:  limit,
+		Cursor: strings.TrimSpace(c.Query("cursor")),
+	}
+
+	options.Filter = domain.IcecreamFilter{
+		Ingredients:        queryValues(c, "ingredient"),
+		WithoutIngredients: queryValues(c, "without_ingredient"),
+		SourcingValues:     queryValues(c, "sourcing_value"),
+		Allergens:          queryValues(c, "allergen"),
+		WithoutAllergens:   queryValues(c, "without_allergen"),
+		Certifications:     queryValues(c, "certification"),
+	}
+
+	for _, field := range strings.Split(c.Query("sort"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		sortField := domain.SortField{Name: field}
+		if strings.HasPrefix(field, "-") {
+			sortField = domain.SortField{Name: field[1:], Descending: true}
+		}
+
+		if err := sortField.Verify(); err != nil {
+			return nil, err
+		}
+
+		options.Sort = append(options.Sort, sortField)
+	}
+
+	return options, nil
+}
+
+func convertLimitQuery(limit string) (int, error) {
+
+	limit = strings.TrimSpace(limit)
+	if limit == "" {
+		return DefaultPageLimit, nil
+	}
+
+	l, err := strconv.Atoi(limit)
+	if err != nil || l < 1 || l > MaxPageLimit {
+		return 0, fmt.Errorf("invalid limit provided: %s, must be between 1 and %d", limit, MaxPageLimit)
+	}
+
+	return l, nil
+}
+
+// queryValues returns all non-empty values of a query parameter which may be given multiple times
+func queryValues(c *gin.Context, key string) (values []string) {
+	for _, value := range c.QueryArray(key) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func convertIncludeQuery(c *gin.Context) ([]domain.Relation, error) {
+
+	query, ok := c.GetQuery("include")
+	if !ok {
+		return domain.IcecreamRelations, nil
+	}
+
+	include := []domain.Relation{}
+	for _, relation := range strings.Split(query, ",") {
+		relation = strings.TrimSpace(relation)
+		if relation == "" {
+			continue
+		}
+
+		if err := domain.Relation(relation).Verify(); err != nil {
+			return nil, err
+		}
+
+		include = append(include, domain.Relation(relation))
+	}
+
+	return include, nil
+}
+
+func convertFieldsQuery(query string) (fields []string, err error) {
+
+	for _, field := range strings.Split(query, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		known := false
+		for _, f := range icecreamFields {
+			if f == field {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return nil, fmt.Errorf("unknown field %q, use any of %s", field, strings.Join(icecreamFields, ", "))
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// selectFields reduces the icecreams to the given fields. The productId is
+// always kept so the icecreams can still be identified.
+func selectFields(icecreams []*domain.Icecream, fields []string) (interface{}, error) {
+
+	if icecreams == nil {
+		icecreams = []*domain.Icecream{}
+	}
+
+	if len(fields) == 0 {
+		return icecreams, nil
+	}
+
+	selected := []map[string]interface{}{}
+	for _, icecream := range icecreams {
+		b, err := json.Marshal(icecream)
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]interface{}
+		if err = json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+
+		reduced := map[string]interface{}{"productId": all["productId"]}
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				reduced[field] = value
+			}
+		}
+
+		selected = append(selected, reduced)
+	}
+
+	return selected, nil
+}
+
+// pageLink returns the current request url pointing to the page of the given cursor
+func pageLink(c *gin.Context, cursor string) string {
+
+	if cursor == "" {
+		return ""
+	}
+
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// icecreamETag is the strong entity tag of the current version of the icecream
+func icecreamETag(icecream *domain.Icecream) string {
+	return fmt.Sprintf(`"%d"`, icecream.Version)
+}
+
+// matchETag reports whether an If-Match or If-None-Match header matches the etag.
+// The header is either * or a comma separated list of entity tags. Weak tags
+// (W/"...") only match if a weak comparison is requested, as for If-None-Match.
+func matchETag(header string, etag string, weak bool) bool {
+
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersions returns the versions which the If-Match header demands of several
+// icecreams at once. As there is no single representation to match against, the header
+// holds the ETag of every icecream in their order, or * for any version, in which case
+// no versions are returned. Otherwise an appropriate response is written and false is
+// returned.
+func ifMatchVersions(c *gin.Context, count int) ([]int64, bool) {
+
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, FailStringResponse("If-Match header required"))
+		return nil, false
+	}
+
+	if ifMatch == "*" {
+		return nil, true
+	}
+
+	tags := strings.Split(ifMatch, ",")
+	if len(tags) != count {
+		c.JSON(http.StatusBadRequest, FailStringResponse(fmt.Sprintf(
+			"If-Match header must hold one ETag per icecream, %d given for %d icecreams", len(tags), count)))
+		return nil, false
+	}
+
+	var versions []int64
+	for _, tag := range tags {
+		version, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(tag), `"`), 10, 64)
+
+		// a weak or foreign entity tag never matches the version of an icecream
+		if err != nil || icecreamETag(&domain.Icecream{Version: version}) != strings.TrimSpace(tag) {
+			c.JSON(http.StatusPreconditionFailed, FailStringResponse("at least one icecream has been changed in the meantime"))
+			return nil, false
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, true
+}
+
+func convertIdParam(sid string) (int64, error) {
+
+	sid = strings.TrimSpace(sid)
+	if sid == "" {
+		return 0, fmt.Errorf("no id provided")
+	}
+
+	id, err := strconv.ParseInt(sid, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id provided: %s", sid)
+	}
+
+	return id, nil
+}
+
+func convertRevision(value string) (int64, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("no revision provided")
+	}
+
+	rev, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || rev < 1 {
+		return 0, fmt.Errorf("invalid revision provided: %s", value)
+	}
+
+	return rev, nil
+}
+
+func convertBoolQuery(value string) (bool, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean value provided: %s", value)
+	}
+
+	return b, nil
 }
 
 func convertIdsParam(sids string) (ids []int64, err error) {
@@ -8,16 +8,20 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fraenky8/zlr-ca/pkg/auth"
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/mock"
 	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	basicAuthHeaderFrank = `Basic ZnJhbms6ZnI0bmsh`
+	basicAuthHeaderFrank              = `Basic ZnJhbms6ZnI0bmsh`
+	basicAuthHeaderFrankWrongPassword = `Basic ZnJhbms6d3Jvbmc=`
 
 	requestContentType  = "application/json"
 	responseContentType = "application/json; charset=utf-8"
@@ -76,6 +80,32 @@ const (
 	`
 )
 
+// passwordHashFrank is the hash of the password of frank in basicAuthHeaderFrank
+var passwordHashFrank, _ = bcrypt.GenerateFromPassword([]byte("fr4nk!"), bcrypt.MinCost)
+
+// userService knows frank as the only user, an admin
+func userService() *mock.UserService {
+	return userServiceWithRole(domain.RoleAdmin)
+}
+
+// userServiceWithRole knows frank as the only user with the given role
+func userServiceWithRole(role domain.Role) *mock.UserService {
+	return &mock.UserService{
+		ReadFn: func(username string) (*domain.User, error) {
+			if username != "frank" {
+				return nil, nil
+			}
+			return &domain.User{ID: 1, Username: "frank", PasswordHash: passwordHashFrank, Role: role}, nil
+		},
+		LoginFailedFn: func(username string, maxFailures int, lockout time.Duration) error {
+			return nil
+		},
+		LoginSucceededFn: func(username string) error {
+			return nil
+		},
+	}
+}
+
 func TestReadIcecream_withoutAuthorization_returnsStatusUnauthorized(t *testing.T) {
 	// given
 	is := &mock.IcecreamService{}
@@ -88,6 +118,10 @@ func TestReadIcecream_withoutAuthorization_returnsStatusUnauthorized(t *testing.
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
@@ -115,6 +149,10 @@ func TestReadIcecream_withInvalidAuthorization_returnsStatusUnauthorized(t *test
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
@@ -131,9 +169,10 @@ func TestReadIcecream_withInvalidAuthorization_returnsStatusUnauthorized(t *test
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
-func TestReadSingleIcecream_withValidAuthorization_returnsStatusOkAndSingleIcecreamData(t *testing.T) {
+func TestReadIcecream_withWrongPassword_returnsStatusUnauthorizedAndCountsFailedLogin(t *testing.T) {
 	// given
 	is := &mock.IcecreamService{}
+	us := userService()
 
 	s, err := NewServer(
 		&ServerConfig{Mode: gin.ReleaseMode},
@@ -143,50 +182,32 @@ func TestReadSingleIcecream_withValidAuthorization_returnsStatusOkAndSingleIcecr
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      us,
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
-	is.ReadsFn = func(ids []int64) ([]*domain.Icecream, error) {
-		return []*domain.Icecream{{
-			ProductID: icecreamProductId1,
-			// ... more data
-		}}, nil
-	}
-
 	// when
 	w := httptest.NewRecorder()
 	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
 	assert.Nil(t, err)
-	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("Authorization", basicAuthHeaderFrankWrongPassword)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, http.StatusOK, w.Code)
-
-	response := struct {
-		Status string
-		Data   struct {
-			Icecream struct {
-				domain.Icecream
-			}
-		}
-	}{}
-
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusOk, response.Status)
-	assert.NotEmpty(t, response.Data)
-	assert.Equal(t, icecreamProductId1, response.Data.Icecream.ProductID)
-
-	assert.True(t, is.ReadsInvoked)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.True(t, us.LoginFailedInvoked)
+	assert.False(t, is.ReadsInvoked)
 }
 
-func TestReadMultipleIcecream_withValidAuthorization_returnsStatusOkAndMultipleIcecreamData(t *testing.T) {
+func TestReadIcecream_withLockedUser_returnsStatusUnauthorized(t *testing.T) {
 	// given
 	is := &mock.IcecreamService{}
+	us := userService()
 
 	s, err := NewServer(
 		&ServerConfig{Mode: gin.ReleaseMode},
@@ -196,56 +217,36 @@ func TestReadMultipleIcecream_withValidAuthorization_returnsStatusOkAndMultipleI
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      us,
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
-	is.ReadsFn = func(ids []int64) ([]*domain.Icecream, error) {
-		return []*domain.Icecream{{
-			ProductID: icecreamProductId1,
-			// ... more data
-		}, {
-			ProductID: icecreamProductId2,
-			// ... more data
-		}}, nil
+	us.ReadFn = func(username string) (*domain.User, error) {
+		lockedUntil := time.Now().Add(time.Minute)
+		return &domain.User{ID: 1, Username: "frank", PasswordHash: passwordHashFrank, LockedUntil: &lockedUntil}, nil
 	}
 
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+","+icecreamProductId2, nil)
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
 	assert.Nil(t, err)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, http.StatusOK, w.Code)
-
-	response := struct {
-		Status string
-		Data   struct {
-			Icecreams []struct {
-				domain.Icecream
-			}
-		}
-	}{}
-
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusOk, response.Status)
-	assert.NotEmpty(t, response.Data)
-	assert.Equal(t, 2, len(response.Data.Icecreams))
-	assert.Equal(t, icecreamProductId1, response.Data.Icecreams[0].ProductID)
-	assert.Equal(t, icecreamProductId2, response.Data.Icecreams[1].ProductID)
-
-	assert.True(t, is.ReadsInvoked)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, is.ReadsInvoked)
 }
 
-func TestCreateIcecream_withWrongContentType_returnsFailResponse(t *testing.T) {
-
+func TestReadIcecream_withDisabledUser_returnsStatusUnauthorized(t *testing.T) {
 	// given
 	is := &mock.IcecreamService{}
+	us := userService()
 
 	s, err := NewServer(
 		&ServerConfig{Mode: gin.ReleaseMode},
@@ -255,34 +256,35 @@ func TestCreateIcecream_withWrongContentType_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      us,
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
+	us.ReadFn = func(username string) (*domain.User, error) {
+		return &domain.User{ID: 1, Username: "frank", PasswordHash: passwordHashFrank, Disabled: true}, nil
+	}
+
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", nil)
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
 	assert.Nil(t, err)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, is.ReadsInvoked)
 }
 
-func TestCreateIcecream_withNilBody_returnsFailResponse(t *testing.T) {
-
+func TestReadIcecream_afterFailedLogins_resetsFailedLogins(t *testing.T) {
 	// given
 	is := &mock.IcecreamService{}
+	us := userService()
 
 	s, err := NewServer(
 		&ServerConfig{Mode: gin.ReleaseMode},
@@ -292,31 +294,35 @@ func TestCreateIcecream_withNilBody_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      us,
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
+	us.ReadFn = func(username string) (*domain.User, error) {
+		return &domain.User{ID: 1, Username: "frank", PasswordHash: passwordHashFrank, Role: domain.RoleAdmin, FailedLogins: 2}, nil
+	}
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}}, nil
+	}
+
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", nil)
-	r.Header.Set("Content-Type", requestContentType)
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
+	assert.Nil(t, err)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, us.LoginSucceededInvoked)
 }
 
-func TestCreateIcecream_withEmptyBody_returnsFailResponse(t *testing.T) {
+func TestIssueToken_withValidCredentials_returnsTokenAcceptedAsBearer(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
@@ -329,31 +335,52 @@ func TestCreateIcecream_withEmptyBody_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}}, nil
+	}
+
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(""))
+	r, err := http.NewRequest("POST", "/auth/token", strings.NewReader(`{"username": "frank", "password": "fr4nk!"}`))
+	assert.Nil(t, err)
 	r.Header.Set("Content-Type", requestContentType)
-	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	var response Response
+	response := struct {
+		Status string
+		Data   TokenResponse
+	}{}
 	err = json.Unmarshal(w.Body.Bytes(), &response)
 	assert.Nil(t, err)
+	assert.Equal(t, "Bearer", response.Data.TokenType)
+	assert.NotEmpty(t, response.Data.Token)
 
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	// when
+	w = httptest.NewRecorder()
+	r, err = http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", "Bearer "+response.Data.Token)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.ReadsInvoked)
 }
 
-func TestCreateIcecream_withFaultyData_returnsFailResponse(t *testing.T) {
+func TestIssueToken_withWrongPassword_returnsStatusUnauthorized(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
@@ -366,31 +393,28 @@ func TestCreateIcecream_withFaultyData_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(`{"data":["foo", "bar"]"}`))
+	r, err := http.NewRequest("POST", "/auth/token", strings.NewReader(`{"username": "frank", "password": "wrong"}`))
+	assert.Nil(t, err)
 	r.Header.Set("Content-Type", requestContentType)
-	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "token")
 }
 
-func TestCreateIcecream_withMissingProductId_returnsFailResponse(t *testing.T) {
+func TestReadIcecream_withInvalidBearerToken_returnsStatusUnauthorized(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
@@ -403,34 +427,32 @@ func TestCreateIcecream_withMissingProductId_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(missingProductIdIcecream))
-	r.Header.Set("Content-Type", requestContentType)
-	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", "Bearer s0m3.th!n.g")
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, is.ReadsInvoked)
 }
 
-func TestCreateIcecream_withMissingName_returnsFailResponse(t *testing.T) {
+func TestReadIcecream_withAPIKey_returnsStatusOk(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
+	aks := &mock.APIKeyService{}
 
 	s, err := NewServer(
 		&ServerConfig{Mode: gin.ReleaseMode},
@@ -440,34 +462,45 @@ func TestCreateIcecream_withMissingName_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    aks,
 		},
 	)
 	assert.Nil(t, err)
 
+	key, hash, err := auth.NewAPIKey()
+	assert.Nil(t, err)
+
+	aks.ReadByHashFn = func(h string) (*domain.APIKey, error) {
+		if h != hash {
+			return nil, nil
+		}
+		return &domain.APIKey{ID: 1, Name: "partner", Role: domain.RoleViewer, Hash: hash}, nil
+	}
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}}, nil
+	}
+
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(missingNameIcecream))
-	r.Header.Set("Content-Type", requestContentType)
-	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", "Bearer "+key)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.ReadsInvoked)
 }
 
-func TestCreateIcecream_withFaultyProductId_returnsFailResponse(t *testing.T) {
+func TestCreateAPIKey_returnsKeyAndStoresOnlyItsHash(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
+	aks := &mock.APIKeyService{}
 
 	s, err := NewServer(
 		&ServerConfig{Mode: gin.ReleaseMode},
@@ -477,31 +510,48 @@ func TestCreateIcecream_withFaultyProductId_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    aks,
 		},
 	)
 	assert.Nil(t, err)
 
+	var stored *domain.APIKey
+	aks.CreateFn = func(apiKey *domain.APIKey) (*domain.APIKey, error) {
+		stored = apiKey
+		created := *apiKey
+		created.ID = 1
+		return &created, nil
+	}
+
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(faultyProductIdIcecream))
+	r, err := http.NewRequest("POST", "/apikeys", strings.NewReader(`{"name": "partner"}`))
+	assert.Nil(t, err)
 	r.Header.Set("Content-Type", requestContentType)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, http.StatusCreated, w.Code)
 
-	var response Response
+	response := struct {
+		Status string
+		Data   APIKeyCreatedResponse
+	}{}
 	err = json.Unmarshal(w.Body.Bytes(), &response)
 	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
+	assert.True(t, auth.IsAPIKey(response.Data.Key))
+	assert.Equal(t, auth.HashAPIKey(response.Data.Key), stored.Hash)
+	assert.Equal(t, "frank", stored.CreatedBy)
+	assert.True(t, strings.HasPrefix(response.Data.Key, stored.Prefix))
+	assert.NotContains(t, w.Body.String(), stored.Hash)
 }
 
-func TestCreateIcecream_withExistingIcecream_returnsFailResponse(t *testing.T) {
+func TestReadIcecream_asViewer_returnsStatusOk(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
@@ -514,42 +564,32 @@ func TestCreateIcecream_withExistingIcecream_returnsFailResponse(t *testing.T) {
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userServiceWithRole(domain.RoleViewer),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
-	is.ReadsFn = func(ids []int64) ([]*domain.Icecream, error) {
-		// existing icecream
-		var icecreams []*domain.Icecream
-		err = json.Unmarshal([]byte(icecream), &icecreams)
-		assert.Nil(t, err)
-
-		return icecreams, nil
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}}, nil
 	}
 
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(icecream))
-	r.Header.Set("Content-Type", requestContentType)
+	r, err := http.NewRequest("GET", "/icecreams/602", nil)
+	assert.Nil(t, err)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusBadRequest, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusFail, response.Status)
-	assert.NotEmpty(t, response.Data)
-
+	assert.Equal(t, http.StatusOK, w.Code)
 	assert.True(t, is.ReadsInvoked)
 }
 
-func TestCreateIcecream_withNewIcecreamButDatabaseError_returnsErrorResponse(t *testing.T) {
+func TestCreateIcecreams_asViewer_returnsStatusForbidden(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
@@ -562,44 +602,30 @@ func TestCreateIcecream_withNewIcecreamButDatabaseError_returnsErrorResponse(t *
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userServiceWithRole(domain.RoleViewer),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
-	is.ReadsFn = func(ids []int64) ([]*domain.Icecream, error) {
-		return nil, nil
-	}
-
-	is.CreatesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
-		// simulation database error
-		return nil, fmt.Errorf("foreign key constraint violated")
-	}
-
 	// when
 	w := httptest.NewRecorder()
 	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(icecream))
+	assert.Nil(t, err)
 	r.Header.Set("Content-Type", requestContentType)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
-
-	var response Response
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Nil(t, err)
-
-	assert.Equal(t, StatusError, response.Status)
-	assert.Empty(t, response.Data)
-	assert.NotEmpty(t, response.Message)
-
-	assert.True(t, is.ReadsInvoked)
-	assert.True(t, is.CreatesInvoked)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `{"status":"fail","data":{"errors":["permission denied, role editor required"]}}`, w.Body.String())
+	assert.False(t, is.CreatesInvoked)
 }
 
-func TestCreateIcecream_withNewValidIcecream_returnsSuccessResponse(t *testing.T) {
+func TestDeleteIcecreams_asEditor_returnsStatusForbidden(t *testing.T) {
 
 	// given
 	is := &mock.IcecreamService{}
@@ -612,38 +638,396 @@ func TestCreateIcecream_withNewValidIcecream_returnsSuccessResponse(t *testing.T
 			SourcingValueService:             &mock.SourcingValueService{},
 			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
 			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userServiceWithRole(domain.RoleEditor),
+			APIKeyService:                    &mock.APIKeyService{},
 		},
 	)
 	assert.Nil(t, err)
 
-	is.ReadsFn = func(ids []int64) ([]*domain.Icecream, error) {
-		return nil, nil
-	}
-
-	is.CreatesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
-		id, _ := strconv.Atoi(icecreamProductId1)
-		return []int64{int64(id)}, nil
-	}
-
 	// when
 	w := httptest.NewRecorder()
-	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(icecream))
-	r.Header.Set("Content-Type", requestContentType)
+	r, err := http.NewRequest("DELETE", "/icecreams/602,610", nil)
+	assert.Nil(t, err)
 	r.Header.Set("Authorization", basicAuthHeaderFrank)
 
 	s.ServeHTTP(w, r)
 
 	// then
-	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
-	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `{"status":"fail","data":{"errors":["permission denied, role admin required"]}}`, w.Body.String())
+	assert.False(t, is.DeletesInvoked)
+}
 
-	response := struct {
-		Status string
-		Data   struct {
-			Icecreams []struct {
-				domain.Icecream
-			}
-		}
+func TestDeleteIngredient_asEditor_returnsStatusForbidden(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	ings := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                ings,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userServiceWithRole(domain.RoleEditor),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/ingredients/1", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `{"status":"fail","data":{"errors":["permission denied, role admin required"]}}`, w.Body.String())
+	assert.False(t, ings.DeleteInvoked)
+}
+
+func TestCreateAPIKey_asEditor_returnsStatusForbidden(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	aks := &mock.APIKeyService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userServiceWithRole(domain.RoleEditor),
+			APIKeyService:                    aks,
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/apikeys", strings.NewReader(`{"name": "partner"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `{"status":"fail","data":{"errors":["permission denied, role admin required"]}}`, w.Body.String())
+	assert.False(t, aks.CreateInvoked)
+}
+
+func TestAccessMatrix_declaresAccessOfEveryRoute(t *testing.T) {
+
+	// given
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// every new route has to show up here, so its access is a deliberate decision
+	expected := [][3]string{
+		{"GET", "/", "public"},
+		{"GET", "/apikeys", "admin"},
+		{"POST", "/apikeys", "admin"},
+		{"DELETE", "/apikeys/:id", "admin"},
+		{"GET", "/audit", "viewer"},
+		{"POST", "/auth/token", "public"},
+		{"DELETE", "/icecreams", "admin"},
+		{"GET", "/icecreams", "viewer"},
+		{"PATCH", "/icecreams", "editor"},
+		{"POST", "/icecreams", "editor"},
+		{"PUT", "/icecreams", "editor"},
+		{"DELETE", "/icecreams/:ids", "admin"},
+		{"GET", "/icecreams/:ids", "viewer"},
+		{"PATCH", "/icecreams/:ids", "editor"},
+		{"PUT", "/icecreams/:ids", "editor"},
+		{"DELETE", "/icecreams/:ids/", "admin"},
+		{"GET", "/icecreams/:ids/", "viewer"},
+		{"GET", "/icecreams/:ids/diff", "viewer"},
+		{"GET", "/icecreams/:ids/history", "viewer"},
+		{"DELETE", "/icecreams/:ids/ingredients", "admin"},
+		{"GET", "/icecreams/:ids/ingredients", "viewer"},
+		{"POST", "/icecreams/:ids/ingredients", "editor"},
+		{"DELETE", "/icecreams/:ids/ingredients/:name", "admin"},
+		{"POST", "/icecreams/:ids/restore", "editor"},
+		{"GET", "/icecreams/:ids/revisions", "viewer"},
+		{"GET", "/icecreams/:ids/revisions/:rev", "viewer"},
+		{"POST", "/icecreams/:ids/revisions/:rev/revert", "editor"},
+		{"DELETE", "/icecreams/:ids/sourcingvalues", "admin"},
+		{"GET", "/icecreams/:ids/sourcingvalues", "viewer"},
+		{"POST", "/icecreams/:ids/sourcingvalues", "editor"},
+		{"DELETE", "/icecreams/:ids/sourcingvalues/:name", "admin"},
+		{"GET", "/icecreams/trash", "viewer"},
+		{"GET", "/ingredients", "viewer"},
+		{"POST", "/ingredients", "editor"},
+		{"DELETE", "/ingredients/:id", "admin"},
+		{"GET", "/ingredients/:id", "viewer"},
+		{"PATCH", "/ingredients/:id", "editor"},
+		{"GET", "/search", "viewer"},
+		{"GET", "/sourcingvalues", "viewer"},
+		{"POST", "/sourcingvalues", "editor"},
+		{"DELETE", "/sourcingvalues/:id", "admin"},
+		{"GET", "/sourcingvalues/:id", "viewer"},
+		{"PATCH", "/sourcingvalues/:id", "editor"},
+	}
+
+	// when
+	matrix := s.AccessMatrix()
+
+	// then
+	var actual [][3]string
+	for _, route := range matrix {
+		actual = append(actual, [3]string{route.Method, route.Path, route.Access.String()})
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestReadIngredients_withoutAuthorization_returnsStatusUnauthorized(t *testing.T) {
+
+	// given
+	ings := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                ings,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/ingredients", nil)
+	assert.Nil(t, err)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, ings.ReadAllInvoked)
+}
+
+func TestReadIngredients_withPublicReadPolicy_returnsStatusOkWithoutAuthorization(t *testing.T) {
+
+	// given
+	ings := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{
+			Mode: gin.ReleaseMode,
+			Policies: map[string]Policy{
+				"/ingredients": {
+					Read:   PublicAccess,
+					Write:  RoleAccess(domain.RoleEditor),
+					Delete: RoleAccess(domain.RoleAdmin),
+				},
+			},
+		},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                ings,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	ings.ReadAllFn = func() ([]*domain.IngredientEntry, error) {
+		return []*domain.IngredientEntry{}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/ingredients", nil)
+	assert.Nil(t, err)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, ings.ReadAllInvoked)
+
+	for _, route := range s.AccessMatrix() {
+		if route.Path == "/ingredients" && route.Method == "POST" {
+			assert.Equal(t, "editor", route.Access.String())
+		}
+		if route.Path == "/ingredients" && route.Method == "GET" {
+			assert.Equal(t, "public", route.Access.String())
+		}
+	}
+}
+
+func TestNewServer_withPolicyOfUnknownGroup_returnsError(t *testing.T) {
+
+	// when
+	_, err := NewServer(
+		&ServerConfig{
+			Mode:     gin.ReleaseMode,
+			Policies: map[string]Policy{"/unknown": {Read: PublicAccess}},
+		},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestReadSingleIcecream_withValidAuthorization_returnsStatusOkAndSingleIcecreamData(t *testing.T) {
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID: icecreamProductId1,
+			// ... more data
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecream struct {
+				domain.Icecream
+			}
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, icecreamProductId1, response.Data.Icecream.ProductID)
+
+	assert.True(t, is.ReadsInvoked)
+}
+
+func TestReadMultipleIcecream_withValidAuthorization_returnsStatusOkAndMultipleIcecreamData(t *testing.T) {
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID: icecreamProductId1,
+			// ... more data
+		}, {
+			ProductID: icecreamProductId2,
+			// ... more data
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+","+icecreamProductId2, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecreams []struct {
+				domain.Icecream
+			}
+		}
 	}{}
 
 	err = json.Unmarshal(w.Body.Bytes(), &response)
@@ -651,8 +1035,3369 @@ func TestCreateIcecream_withNewValidIcecream_returnsSuccessResponse(t *testing.T
 
 	assert.Equal(t, StatusOk, response.Status)
 	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, 2, len(response.Data.Icecreams))
 	assert.Equal(t, icecreamProductId1, response.Data.Icecreams[0].ProductID)
+	assert.Equal(t, icecreamProductId2, response.Data.Icecreams[1].ProductID)
 
 	assert.True(t, is.ReadsInvoked)
-	assert.True(t, is.CreatesInvoked)
+}
+
+func TestCreateIcecream_withWrongContentType_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withNilBody_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", nil)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withEmptyBody_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(""))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withFaultyData_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(`{"data":["foo", "bar"]"}`))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withMissingProductId_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(missingProductIdIcecream))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withMissingName_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(missingNameIcecream))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withFaultyProductId_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(faultyProductIdIcecream))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+}
+
+func TestCreateIcecream_withExistingIcecream_returnsStatusConflict(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.CreatesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		return nil, domain.ErrAlreadyExists
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(icecream))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.NotEmpty(t, response.Data)
+
+	assert.False(t, is.ReadsInvoked)
+	assert.True(t, is.CreatesInvoked)
+}
+
+func TestCreateIcecream_withNewIcecreamButDatabaseError_returnsErrorResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.CreatesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		// simulation database error
+		return nil, fmt.Errorf("foreign key constraint violated")
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(icecream))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusError, response.Status)
+	assert.Empty(t, response.Data)
+	assert.NotEmpty(t, response.Message)
+
+	assert.False(t, is.ReadsInvoked)
+	assert.True(t, is.CreatesInvoked)
+}
+
+func TestCreateIcecream_withNewValidIcecream_returnsSuccessResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.CreatesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		id, _ := strconv.Atoi(icecreamProductId1)
+		return []int64{int64(id)}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(icecream))
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, responseContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecreams []struct {
+				domain.Icecream
+			}
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.NotEmpty(t, response.Data)
+	assert.Equal(t, icecreamProductId1, response.Data.Icecreams[0].ProductID)
+
+	assert.False(t, is.ReadsInvoked)
+	assert.True(t, is.CreatesInvoked)
+}
+
+func TestReadIngredient_withUnknownId_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                is,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadByIdFn = func(id int64) (*domain.IngredientEntry, error) {
+		return nil, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/ingredients/42", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.True(t, is.ReadByIdInvoked)
+}
+
+func TestCreateIngredient_withExistingName_returnsStatusConflict(t *testing.T) {
+
+	// given
+	is := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                is,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.CreateFn = func(ingredient domain.Ingredient) (*domain.IngredientEntry, error) {
+		return nil, domain.ErrAlreadyExists
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/ingredients", strings.NewReader(`{"name": "cream"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.True(t, is.CreateInvoked)
+}
+
+func TestUpdateIngredient_withNewName_returnsSuccessResponse(t *testing.T) {
+
+	// given
+	is := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                is,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.RenameFn = func(id int64, name domain.Ingredient) (*domain.IngredientEntry, error) {
+		return &domain.IngredientEntry{ID: id, Name: name}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/ingredients/7", strings.NewReader(`{"name": "vanilla extract"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Ingredient domain.IngredientEntry
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.Equal(t, int64(7), response.Data.Ingredient.ID)
+	assert.Equal(t, domain.Ingredient("vanilla extract"), response.Data.Ingredient.Name)
+	assert.True(t, is.RenameInvoked)
+}
+
+func TestDeleteIngredient_withReferencedIngredient_returnsStatusConflict(t *testing.T) {
+
+	// given
+	is := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                is,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadByIdFn = func(id int64) (*domain.IngredientEntry, error) {
+		return &domain.IngredientEntry{ID: id, Name: "cream"}, nil
+	}
+
+	is.DeleteFn = func(id int64, force bool) error {
+		if !force {
+			return domain.ErrStillReferenced
+		}
+		return nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/ingredients/7", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.True(t, is.DeleteInvoked)
+}
+
+func TestDeleteIngredient_withDatabaseError_returnsErrorResponseWithoutDetails(t *testing.T) {
+
+	// given
+	is := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                is,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadByIdFn = func(id int64) (*domain.IngredientEntry, error) {
+		return &domain.IngredientEntry{ID: id, Name: "cream"}, nil
+	}
+
+	is.DeleteFn = func(id int64, force bool) error {
+		return fmt.Errorf("pq: relation \"zlr_ca.ingredients\" does not exist")
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/ingredients/7", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusError, response.Status)
+	assert.Empty(t, response.Data)
+	assert.NotContains(t, w.Body.String(), "zlr_ca")
+}
+
+func TestReadSourcingValues_returnsSuccessResponseWithIds(t *testing.T) {
+
+	// given
+	ss := &mock.SourcingValueService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             ss,
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	ss.ReadAllFn = func() ([]*domain.SourcingValueEntry, error) {
+		return []*domain.SourcingValueEntry{
+			{ID: 1, Description: "Fairtrade"},
+			{ID: 2, Description: "Responsibly Sourced Packaging"},
+		}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/sourcingvalues", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response := struct {
+		Status string
+		Data   struct {
+			SourcingValues []domain.SourcingValueEntry `json:"sourcing_values"`
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.Equal(t, 2, len(response.Data.SourcingValues))
+	assert.Equal(t, int64(2), response.Data.SourcingValues[1].ID)
+}
+
+func TestDeleteSourcingValue_withDatabaseError_returnsErrorResponseWithoutDetails(t *testing.T) {
+
+	// given
+	ss := &mock.SourcingValueService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             ss,
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	ss.ReadByIdFn = func(id int64) (*domain.SourcingValueEntry, error) {
+		return &domain.SourcingValueEntry{ID: id, Description: "Fairtrade"}, nil
+	}
+
+	ss.DeleteFn = func(id int64, force bool) error {
+		return fmt.Errorf("pq: relation \"zlr_ca.sourcing_values\" does not exist")
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/sourcingvalues/3", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusError, response.Status)
+	assert.Empty(t, response.Data)
+	assert.NotContains(t, w.Body.String(), "zlr_ca")
+}
+
+func TestUpdateSourcingValue_withUnknownId_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	ss := &mock.SourcingValueService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             ss,
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	ss.RenameFn = func(id int64, description domain.SourcingValue) (*domain.SourcingValueEntry, error) {
+		return nil, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/sourcingvalues/42", strings.NewReader(`{"description": "Recyclable Packaging"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.True(t, ss.RenameInvoked)
+}
+
+func TestCreateSourcingValue_withMissingDescription_returnsFailResponse(t *testing.T) {
+
+	// given
+	ss := &mock.SourcingValueService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             ss,
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/sourcingvalues", strings.NewReader(`{"description": "  "}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.False(t, ss.CreateInvoked)
+}
+
+func TestCreateIcecreamIngredients_withExistingIcecream_returnsSuccessResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	version := int64(1)
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID:   icecreamProductId1,
+			Version:     version,
+			Ingredients: domain.Ingredients{"cream"},
+		}}, nil
+	}
+
+	var patches []*domain.IcecreamPatch
+	is.UpdatesFn = func(p []*domain.IcecreamPatch) error {
+		patches = p
+		version++
+		return nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/"+icecreamProductId1+"/ingredients", strings.NewReader(`["cream", "sugar"]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"1"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	assert.True(t, is.UpdatesInvoked)
+	assert.Equal(t, []*domain.IcecreamPatch{{
+		ProductID:   icecreamProductId1,
+		Version:     1,
+		Ingredients: domain.RelationPatch{Set: true, Add: []string{"cream", "sugar"}},
+	}}, patches)
+}
+
+func TestCreateIcecreamIngredients_withStaleIfMatch_returnsPreconditionFailed(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 4}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/"+icecreamProductId1+"/ingredients", strings.NewReader(`["sugar"]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"3"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestCreateIcecreamIngredients_withoutIfMatch_returnsPreconditionRequired(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/"+icecreamProductId1+"/ingredients", strings.NewReader(`["sugar"]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.False(t, is.ReadsInvoked)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestCreateIcecreamSourcingValues_withUnknownIcecream_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID: icecreamProductId1,
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/"+icecreamProductId1+","+icecreamProductId2+"/sourcingvalues", strings.NewReader(`["Fairtrade"]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", "*")
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestDeleteIcecreamIngredient_withLinkedIngredient_returnsSuccessResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID:   icecreamProductId1,
+			Version:     1,
+			Ingredients: domain.Ingredients{"cream", "egg yolks"},
+		}}, nil
+	}
+
+	var patches []*domain.IcecreamPatch
+	is.UpdatesFn = func(p []*domain.IcecreamPatch) error {
+		patches = p
+		return nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/icecreams/"+icecreamProductId1+"/ingredients/egg%20yolks", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"1"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []*domain.IcecreamPatch{{
+		ProductID:   icecreamProductId1,
+		Ingredients: domain.RelationPatch{Set: true, Remove: []string{"egg yolks"}},
+		Version:     1,
+	}}, patches)
+}
+
+func TestDeleteIcecreamSourcingValue_withUnlinkedSourcingValue_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID:      icecreamProductId1,
+			SourcingValues: domain.SourcingValues{"Cage-Free Eggs"},
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/icecreams/"+icecreamProductId1+"/sourcingvalues/Fairtrade", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", "*")
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.True(t, is.ReadsInvoked)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestListIcecreams_withSortAndFields_returnsSelectedFieldsAndLinks(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var listOptions *domain.IcecreamListOptions
+	is.ListFn = func(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+		listOptions = options
+		return &domain.IcecreamPage{
+			Icecreams: []*domain.Icecream{{
+				ProductID:   icecreamProductId1,
+				Name:        "Banana Split",
+				Description: "Banana & Strawberry Ice Creams",
+				Story:       "We turned the classic ice cream parlor sundae ...",
+			}},
+			Total: 2,
+			Next:  "n3xt",
+		}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams?limit=1&sort=name,-product_id&fields=name,description", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, 1, listOptions.Limit)
+	assert.Equal(t, []domain.SortField{{Name: "name"}, {Name: "product_id", Descending: true}}, listOptions.Sort)
+	assert.Empty(t, listOptions.Include)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecreams []map[string]interface{}
+			Total     int64
+			Links     PageLinks
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.Equal(t, int64(2), response.Data.Total)
+	assert.Equal(t, map[string]interface{}{
+		"productId":   icecreamProductId1,
+		"name":        "Banana Split",
+		"description": "Banana & Strawberry Ice Creams",
+	}, response.Data.Icecreams[0])
+	assert.Contains(t, response.Data.Links.Next, "cursor=n3xt")
+	assert.Empty(t, response.Data.Links.Prev)
+}
+
+func TestListIcecreams_withRelationFields_includesRelations(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var listOptions *domain.IcecreamListOptions
+	is.ListFn = func(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+		listOptions = options
+		return &domain.IcecreamPage{
+			Icecreams: []*domain.Icecream{{
+				ProductID:      icecreamProductId1,
+				Name:           "Banana Split",
+				Ingredients:    domain.Ingredients{"cream", "bananas"},
+				SourcingValues: domain.SourcingValues{"Fairtrade"},
+			}},
+			Total: 1,
+		}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams?fields=name,ingredients", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []domain.Relation{domain.RelationIngredients}, listOptions.Include)
+
+	response := struct {
+		Data struct {
+			Icecreams []map[string]interface{}
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []map[string]interface{}{{
+		"productId":   icecreamProductId1,
+		"name":        "Banana Split",
+		"ingredients": []interface{}{"cream", "bananas"},
+	}}, response.Data.Icecreams)
+}
+
+func TestListIcecreams_withUnknownSortField_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams?sort=story", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.False(t, is.ListInvoked)
+}
+
+func TestListIcecreams_withInvalidCursor_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ListFn = func(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams?cursor=f00", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, is.ListInvoked)
+}
+
+func TestListIcecreams_withFilters_passesFilterToService(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var listOptions *domain.IcecreamListOptions
+	is.ListFn = func(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+		listOptions = options
+		return &domain.IcecreamPage{}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams?ingredient=peanuts&without_ingredient=wheat&without_ingredient=soy"+
+		"&sourcing_value=Fairtrade&without_allergen=tree+nuts&certification=Kosher", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, domain.IcecreamFilter{
+		Ingredients:        []string{"peanuts"},
+		WithoutIngredients: []string{"wheat", "soy"},
+		SourcingValues:     []string{"Fairtrade"},
+		WithoutAllergens:   []string{"tree nuts"},
+		Certifications:     []string{"Kosher"},
+	}, listOptions.Filter)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecreams []domain.Icecream
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.NotNil(t, response.Data.Icecreams)
+	assert.Empty(t, response.Data.Icecreams)
+}
+
+func TestSearchIcecreams_withoutQuery_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/search?q=+", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, is.SearchInvoked)
+}
+
+func TestSearchIcecreams_withQuery_returnsScoredIcecreams(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var searchQuery string
+	is.SearchFn = func(query string, limit int) ([]*domain.IcecreamSearchResult, error) {
+		searchQuery = query
+		return []*domain.IcecreamSearchResult{{
+			Icecream: &domain.Icecream{
+				ProductID: icecreamProductId1,
+				Name:      "Caramel Chocolate Cheesecake",
+			},
+			Score:      0.6,
+			Highlights: map[string]string{"name": "Caramel Chocolate <b>Cheesecake</b>"},
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/search?q=cheesecake", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cheesecake", searchQuery)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecreams []struct {
+				ProductID  string
+				Score      float64
+				Highlights map[string]string
+			}
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.Equal(t, icecreamProductId1, response.Data.Icecreams[0].ProductID)
+	assert.Equal(t, 0.6, response.Data.Icecreams[0].Score)
+	assert.Equal(t, "Caramel Chocolate <b>Cheesecake</b>", response.Data.Icecreams[0].Highlights["name"])
+}
+
+func TestReadIcecream_withoutInclude_loadsAllRelations(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var includes []domain.Relation
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		includes = include
+		return []*domain.Icecream{{
+			ProductID:      icecreamProductId1,
+			Ingredients:    domain.Ingredients{"cream", "sugar"},
+			SourcingValues: domain.SourcingValues{"Fairtrade"},
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1, nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, domain.IcecreamRelations, includes)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Icecream struct {
+				domain.Icecream
+			}
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, domain.Ingredients{"cream", "sugar"}, response.Data.Icecream.Ingredients)
+	assert.Equal(t, domain.SourcingValues{"Fairtrade"}, response.Data.Icecream.SourcingValues)
+}
+
+func TestReadIcecream_withInclude_loadsRequestedRelationsOnly(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var includes []domain.Relation
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		includes = include
+		return []*domain.Icecream{{
+			ProductID: icecreamProductId1,
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+"?include=ingredients", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []domain.Relation{domain.RelationIngredients}, includes)
+}
+
+func TestReadIcecream_withUnknownInclude_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+"?include=allergens", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, is.ReadsInvoked)
+}
+
+func TestReadIcecreamIngredients_withMultipleIds_returnsIngredientsKeyedByProductId(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	ins := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                ins,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}, {ProductID: icecreamProductId2}}, nil
+	}
+
+	ins.ReadsFn = func(icecreamProductIds []int64) (map[int64]domain.Ingredients, error) {
+		return map[int64]domain.Ingredients{
+			602: {"cream", "bananas"},
+			610: {},
+		}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+","+icecreamProductId2+"/ingredients", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	response := struct {
+		Status string
+		Data   struct {
+			Ingredients map[string]domain.Ingredients
+		}
+	}{}
+
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusOk, response.Status)
+	assert.Equal(t, domain.Ingredients{"cream", "bananas"}, response.Data.Ingredients[icecreamProductId1])
+	assert.Equal(t, domain.Ingredients{}, response.Data.Ingredients[icecreamProductId2])
+	assert.True(t, ins.ReadsInvoked)
+}
+
+func TestReadIcecreamIngredients_withTrashedIcecream_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	ins := &mock.IngredientService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                ins,
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// the second icecream is in the trash, so the service does not read it
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+","+icecreamProductId2+"/ingredients", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.True(t, is.ReadsInvoked)
+	assert.False(t, ins.ReadsInvoked)
+}
+
+func TestReadIcecreamSourcingValues_withUnknownIcecream_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	svs := &mock.SourcingValueService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             svs,
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return nil, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/"+icecreamProductId1+"/sourcingvalues", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.True(t, is.ReadsInvoked)
+	assert.False(t, svs.ReadsInvoked)
+}
+
+func TestUpdateIcecream_withNameOnly_leavesOtherFieldsUntouched(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var updatePatches []*domain.IcecreamPatch
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		updatePatches = patches
+		return nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID: icecreamProductId1,
+			Name:      "Banana Split Deluxe",
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams", strings.NewReader(
+		`[{"productId": "602", "name": "Banana Split Deluxe", "story": null, "ingredients": {"add": ["walnuts"], "remove": ["peanuts"]}}]`,
+	))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"3"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.UpdatesInvoked)
+	assert.True(t, is.ReadsInvoked)
+
+	patch := updatePatches[0]
+	assert.Equal(t, domain.OptionalString{Set: true, Valid: true, Value: "Banana Split Deluxe"}, patch.Name)
+	assert.Equal(t, domain.OptionalString{Set: true, Valid: false}, patch.Story)
+	assert.False(t, patch.Description.Set)
+	assert.False(t, patch.SourcingValues.Set)
+	assert.Equal(t, domain.RelationPatch{Set: true, Add: []string{"walnuts"}, Remove: []string{"peanuts"}}, patch.Ingredients)
+	assert.Equal(t, int64(3), patch.Version)
+}
+
+func TestUpdateIcecream_withNullName_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams", strings.NewReader(`[{"productId": "602", "name": null}]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response Response
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StatusFail, response.Status)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestUpdateIcecream_withReplacedSourcingValues_passesReplacementToService(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var updatePatches []*domain.IcecreamPatch
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		updatePatches = patches
+		return nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams", strings.NewReader(
+		`[{"productId": "602", "sourcing_values": ["Fairtrade", "Non-GMO"], "ingredients": null}]`,
+	))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", "*")
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	patch := updatePatches[0]
+	assert.Equal(t, domain.RelationPatch{Set: true, Replace: true, Values: []string{"Fairtrade", "Non-GMO"}}, patch.SourcingValues)
+	assert.Equal(t, domain.RelationPatch{Set: true, Replace: true}, patch.Ingredients)
+	assert.False(t, patch.Name.Set)
+}
+
+func TestUpdateIcecreams_withoutIfMatch_returnsPreconditionRequired(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams", strings.NewReader(`[{"productId": "602", "name": "Banana Split Deluxe"}]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestUpdateIcecreams_withStaleIfMatch_returnsPreconditionFailed(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var updatePatches []*domain.IcecreamPatch
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		updatePatches = patches
+		return domain.ErrVersionMismatch
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams", strings.NewReader(
+		`[{"productId": "602", "name": "Banana Split Deluxe"}, {"productId": "610", "name": "Mint Breeze"}]`,
+	))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"3", "5"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	if assert.Len(t, updatePatches, 2) {
+		assert.Equal(t, int64(3), updatePatches[0].Version)
+		assert.Equal(t, int64(5), updatePatches[1].Version)
+	}
+}
+
+func TestUpdateIcecreams_withUnknownIcecream_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		return domain.ErrNotFound
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams", strings.NewReader(`[{"productId": "602", "name": "Banana Split Deluxe"}]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"3"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, is.ReadsInvoked)
+}
+
+func TestDeleteIcecreams_withIfMatchPerIcecream_deletesThemAtTheirVersions(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var deletedIds, deletedVersions []int64
+	is.DeletesFn = func(ids []int64, versions []int64) error {
+		deletedIds, deletedVersions = ids, versions
+		return nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/icecreams/602,610", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+	r.Header.Set("If-Match", `"2","4"`)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int64{602, 610}, deletedIds)
+	assert.Equal(t, []int64{2, 4}, deletedVersions)
+}
+
+func TestDeleteIcecreams_withoutETagPerIcecream_deletesNothing(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+	}{
+		{"no If-Match", "", http.StatusPreconditionRequired},
+		{"one ETag for two icecreams", `"2"`, http.StatusBadRequest},
+		{"weak ETag", `"2", W/"4"`, http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			// given
+			is := &mock.IcecreamService{}
+
+			s, err := NewServer(
+				&ServerConfig{Mode: gin.ReleaseMode},
+				&repos.Repository{
+					IcecreamService:                  is,
+					IngredientService:                &mock.IngredientService{},
+					SourcingValueService:             &mock.SourcingValueService{},
+					IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+					IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+					AuditService:                     &mock.AuditService{},
+					IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+					UserService:                      userService(),
+					APIKeyService:                    &mock.APIKeyService{},
+				},
+			)
+			assert.Nil(t, err)
+
+			// when
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("DELETE", "/icecreams/602,610", nil)
+			assert.Nil(t, err)
+			r.Header.Set("Authorization", basicAuthHeaderFrank)
+			if test.ifMatch != "" {
+				r.Header.Set("If-Match", test.ifMatch)
+			}
+
+			s.ServeHTTP(w, r)
+
+			// then
+			assert.Equal(t, test.status, w.Code)
+			assert.False(t, is.DeletesInvoked)
+		})
+	}
+}
+
+func TestPatchIcecream_withMergePatch_updatesChangedFieldsOnly(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var updatePatches []*domain.IcecreamPatch
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		updatePatches = patches
+		return nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID:   icecreamProductId1,
+			Version:     1,
+			Name:        "Banana Split",
+			Story:       "Once upon a time",
+			Ingredients: domain.Ingredients{"bananas", "peanuts"},
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(
+		`{"name": "Banana Split Deluxe", "story": null, "ingredients": ["bananas", "walnuts"]}`,
+	))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", MergePatchContentType)
+	r.Header.Set("If-Match", `"1"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.UpdatesInvoked)
+
+	patch := updatePatches[0]
+	assert.Equal(t, icecreamProductId1, patch.ProductID)
+	assert.Equal(t, int64(1), patch.Version)
+	assert.Equal(t, domain.OptionalString{Set: true, Valid: true, Value: "Banana Split Deluxe"}, patch.Name)
+	assert.Equal(t, domain.OptionalString{Set: true, Valid: false}, patch.Story)
+	assert.False(t, patch.Description.Set)
+	assert.False(t, patch.SourcingValues.Set)
+	assert.Equal(t, domain.RelationPatch{Set: true, Add: []string{"walnuts"}, Remove: []string{"peanuts"}}, patch.Ingredients)
+}
+
+func TestPatchIcecream_withJSONPatch_appliesAllOperations(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var updatePatches []*domain.IcecreamPatch
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		updatePatches = patches
+		return nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID:   icecreamProductId1,
+			Version:     1,
+			Name:        "Banana Split",
+			Ingredients: domain.Ingredients{"bananas", "peanuts"},
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(`[
+		{"op": "test", "path": "/name", "value": "Banana Split"},
+		{"op": "replace", "path": "/description", "value": "Bananas all the way"},
+		{"op": "add", "path": "/sourcing_values/-", "value": "Fairtrade"},
+		{"op": "remove", "path": "/ingredients/1"}
+	]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", JSONPatchContentType)
+	r.Header.Set("If-Match", `"1"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	patch := updatePatches[0]
+	assert.False(t, patch.Name.Set)
+	assert.Equal(t, domain.OptionalString{Set: true, Valid: true, Value: "Bananas all the way"}, patch.Description)
+	assert.Equal(t, domain.RelationPatch{Set: true, Add: []string{"Fairtrade"}}, patch.SourcingValues)
+	assert.Equal(t, domain.RelationPatch{Set: true, Remove: []string{"peanuts"}}, patch.Ingredients)
+}
+
+func TestPatchIcecream_withFailingTestOperation_appliesNothing(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 1, Name: "Banana Split"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(`[
+		{"op": "replace", "path": "/description", "value": "Bananas all the way"},
+		{"op": "test", "path": "/name", "value": "Chunky Monkey"}
+	]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", JSONPatchContentType)
+	r.Header.Set("If-Match", `"1"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestPatchIcecream_withPlainJSON_returnsUnsupportedMediaType(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(`{"name": "Banana Split Deluxe"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.False(t, is.ReadsInvoked)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestReadIcecream_withMatchingIfNoneMatch_returnsNotModified(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 3, Name: "Banana Split"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/602", nil)
+	assert.Nil(t, err)
+	r.Header.Set("If-None-Match", `"2", W/"3"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestPatchIcecream_withoutIfMatch_returnsPreconditionRequired(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(`{"description": "Bananas all the way"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", MergePatchContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestPatchIcecream_withStaleIfMatch_returnsPreconditionFailed(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 4, Name: "Banana Split"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(`{"description": "Bananas all the way"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", MergePatchContentType)
+	r.Header.Set("If-Match", `"3"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.False(t, is.UpdatesInvoked)
+}
+
+func TestPatchIcecream_withConcurrentUpdate_returnsPreconditionFailed(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 3, Name: "Banana Split"}}, nil
+	}
+
+	is.UpdatesFn = func(patches []*domain.IcecreamPatch) error {
+		return domain.ErrVersionMismatch
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PATCH", "/icecreams/602", strings.NewReader(`{"description": "Bananas all the way"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", MergePatchContentType)
+	r.Header.Set("If-Match", `"3"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.True(t, is.UpdatesInvoked)
+}
+
+func TestDeleteIcecream_withMatchingIfMatch_deletesCurrentVersion(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 3, Name: "Banana Split"}}, nil
+	}
+
+	var deleteVersion int64
+	is.DeleteFn = func(id int64, version int64) error {
+		deleteVersion = version
+		return nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("DELETE", "/icecreams/602", nil)
+	assert.Nil(t, err)
+	r.Header.Set("If-Match", `"3"`)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.DeleteInvoked)
+	assert.Equal(t, int64(3), deleteVersion)
+}
+
+func TestReplaceIcecream_withNewIcecream_returnsStatusCreated(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var replaced []*domain.Icecream
+	is.ReplacesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		replaced = icecreams
+		return []int64{602}, nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 1, Name: "Banana Split"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/icecreams/602", strings.NewReader(
+		`{"name": "Banana Split", "ingredients": ["bananas"]}`,
+	))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	assert.Equal(t, icecreamProductId1, replaced[0].ProductID)
+	assert.Equal(t, domain.Ingredients{"bananas"}, replaced[0].Ingredients)
+}
+
+func TestReplaceIcecream_withExistingIcecream_returnsStatusOK(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReplacesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		return nil, nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 2, Name: "Banana Split"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/icecreams/602", strings.NewReader(`{"productId": "602", "name": "Banana Split"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.ReplacesInvoked)
+}
+
+func TestReplaceIcecream_withDifferentProductId_returnsFailResponse(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/icecreams/602", strings.NewReader(`{"productId": "603", "name": "Banana Split"}`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, is.ReplacesInvoked)
+}
+
+func TestReplaceIcecreams_withExistingAndNewIcecreams_returnsCreatedIds(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReplacesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		return []int64{603}, nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{
+			{ProductID: icecreamProductId1, Name: "Banana Split"},
+			{ProductID: "603", Name: "Chunky Monkey"},
+		}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/icecreams", strings.NewReader(
+		`[{"productId": "602", "name": "Banana Split"}, {"productId": "603", "name": "Chunky Monkey"}]`,
+	))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.ReplacesInvoked)
+	assert.False(t, is.CreatesInvoked)
+
+	var response struct {
+		Data IcecreamsReplaceResponse `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []int64{603}, response.Data.Created)
+	assert.Len(t, response.Data.Icecreams, 2)
+}
+
+func TestReadTrash_withDeletedIcecreams_returnsDeletedIcecreams(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	deletedAt := time.Date(2018, 8, 1, 12, 0, 0, 0, time.UTC)
+	is.TrashFn = func() ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{
+			ProductID:   icecreamProductId1,
+			Name:        "Banana Split",
+			Ingredients: domain.Ingredients{"bananas"},
+			DeletedAt:   &deletedAt,
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/trash", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, is.TrashInvoked)
+	assert.False(t, is.ReadsInvoked)
+
+	var response struct {
+		Data IcecreamsResponse `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Len(t, response.Data.Icecreams, 1)
+	assert.Equal(t, domain.Ingredients{"bananas"}, response.Data.Icecreams[0].Ingredients)
+	assert.Equal(t, deletedAt, *response.Data.Icecreams[0].DeletedAt)
+}
+
+func TestRestoreIcecreams_withIcecreamsInTrash_returnsRestoredIcecreams(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var restoredIds []int64
+	is.RestoresFn = func(ids []int64) error {
+		restoredIds = ids
+		return nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Name: "Banana Split"}, {ProductID: "603", Name: "Chunky Monkey"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/602,603/restore", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int64{602, 603}, restoredIds)
+}
+
+func TestRestoreIcecreams_withIcecreamNotInTrash_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.RestoresFn = func(ids []int64) error {
+		return domain.ErrNotDeleted
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/602/restore", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, is.ReadsInvoked)
+}
+
+func TestCreateIcecreams_withIcecreamInTrash_returnsStatusConflict(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return nil, nil
+	}
+
+	is.CreatesFn = func(icecreams []*domain.Icecream) ([]int64, error) {
+		return nil, domain.ErrAlreadyExists
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams", strings.NewReader(`[{"productId": "602", "name": "Banana Split"}]`))
+	assert.Nil(t, err)
+	r.Header.Set("Content-Type", requestContentType)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestReadIcecreamHistory_withRecordedChanges_returnsEntries(t *testing.T) {
+
+	// given
+	as := &mock.AuditService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     as,
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var historyEntity domain.AuditEntity
+	var historyId string
+	as.HistoryFn = func(entity domain.AuditEntity, entityId string) ([]*domain.AuditEntry, error) {
+		historyEntity, historyId = entity, entityId
+		return []*domain.AuditEntry{{
+			ID:       1,
+			Entity:   domain.AuditEntityIcecream,
+			EntityID: icecreamProductId1,
+			Action:   domain.AuditActionUpdate,
+			User:     "frank",
+			Before:   json.RawMessage(`{"allergy_info": "may contain nuts"}`),
+			After:    json.RawMessage(`{"allergy_info": "contains peanuts"}`),
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/602/history", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, domain.AuditEntityIcecream, historyEntity)
+	assert.Equal(t, icecreamProductId1, historyId)
+
+	var response struct {
+		Data AuditEntriesResponse `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Len(t, response.Data.Entries, 1)
+	assert.Equal(t, "frank", response.Data.Entries[0].User)
+	assert.JSONEq(t, `{"allergy_info": "contains peanuts"}`, string(response.Data.Entries[0].After))
+}
+
+func TestReadAudit_withUserAndSince_passesFilterToService(t *testing.T) {
+
+	// given
+	as := &mock.AuditService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     as,
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var searchFilter *domain.AuditFilter
+	as.SearchFn = func(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+		searchFilter = filter
+		return []*domain.AuditEntry{}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/audit?user=seb&since=2018-08-01T00:00:00Z&limit=50", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, &domain.AuditFilter{
+		User:  "seb",
+		Since: time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC),
+		Limit: 50,
+	}, searchFilter)
+}
+
+func TestReadAudit_withInvalidSince_returnsFailResponse(t *testing.T) {
+
+	// given
+	as := &mock.AuditService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     as,
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/audit?since=yesterday", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.False(t, as.SearchInvoked)
+}
+
+func TestRequestId_withClientRequestId_isEchoed(t *testing.T) {
+
+	// given
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          &mock.IcecreamRevisionService{},
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/", nil)
+	assert.Nil(t, err)
+	r.Header.Set(RequestIdHeader, "sync-4711")
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, "sync-4711", w.Header().Get(RequestIdHeader))
+}
+
+func TestReadIcecream_withAsOf_returnsRevisionValidAtThatTime(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	irs := &mock.IcecreamRevisionService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          irs,
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	var asOf time.Time
+	irs.AsOfFn = func(productId int64, at time.Time) (*domain.IcecreamRevision, error) {
+		asOf = at
+		return &domain.IcecreamRevision{
+			ProductID: icecreamProductId1,
+			Revision:  2,
+			Icecream: &domain.Icecream{
+				ProductID:   icecreamProductId1,
+				Name:        "Banana Split",
+				Ingredients: domain.Ingredients{"bananas", "peanuts"},
+			},
+		}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/602?as_of=2018-08-01T00:00:00Z", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, is.ReadsInvoked)
+	assert.Equal(t, time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC), asOf)
+
+	var response struct {
+		Data IcecreamRevisionResponse `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(2), response.Data.Revision.Revision)
+	assert.Equal(t, domain.Ingredients{"bananas", "peanuts"}, response.Data.Revision.Icecream.Ingredients)
+}
+
+func TestReadIcecream_withAsOfBeforeCreation_returnsStatusNotFound(t *testing.T) {
+
+	// given
+	irs := &mock.IcecreamRevisionService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          irs,
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	irs.AsOfFn = func(productId int64, at time.Time) (*domain.IcecreamRevision, error) {
+		return nil, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/602?as_of=2010-01-01T00:00:00Z", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDiffIcecreamRevisions_withTwoRevisions_returnsChanges(t *testing.T) {
+
+	// given
+	irs := &mock.IcecreamRevisionService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  &mock.IcecreamService{},
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          irs,
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	irs.RevisionFn = func(productId int64, revision int64) (*domain.IcecreamRevision, error) {
+		if revision == 1 {
+			return &domain.IcecreamRevision{Revision: 1, Icecream: &domain.Icecream{
+				Name:        "Banana Split",
+				AllergyInfo: "may contain nuts",
+				Ingredients: domain.Ingredients{"bananas", "walnuts"},
+			}}, nil
+		}
+		return &domain.IcecreamRevision{Revision: 3, Icecream: &domain.Icecream{
+			Name:        "Banana Split",
+			AllergyInfo: "contains peanuts",
+			Ingredients: domain.Ingredients{"bananas", "peanuts"},
+		}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/icecreams/602/diff?from=1&to=3", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Data IcecreamDiffResponse `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Nil(t, err)
+
+	diff := response.Data.Diff
+	assert.Equal(t, map[string]domain.FieldChange{
+		"allergy_info": {From: "may contain nuts", To: "contains peanuts"},
+	}, diff.Fields)
+	assert.Equal(t, domain.RelationChange{Added: []string{"peanuts"}, Removed: []string{"walnuts"}}, diff.Ingredients)
+}
+
+func TestRevertIcecream_withEarlierRevision_revertsIcecream(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	irs := &mock.IcecreamRevisionService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          irs,
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	irs.RevisionFn = func(productId int64, revision int64) (*domain.IcecreamRevision, error) {
+		return &domain.IcecreamRevision{Revision: revision, Icecream: &domain.Icecream{ProductID: icecreamProductId1, Name: "Banana Split"}}, nil
+	}
+
+	var revertedRevision int64
+	is.RevertFn = func(id int64, revision int64) error {
+		revertedRevision = revision
+		return nil
+	}
+
+	is.ReadsFn = func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
+		return []*domain.Icecream{{ProductID: icecreamProductId1, Version: 5, Name: "Banana Split"}}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/602/revisions/2/revert", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(2), revertedRevision)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+}
+
+func TestRevertIcecream_withDeletingRevision_returnsUnprocessableEntity(t *testing.T) {
+
+	// given
+	is := &mock.IcecreamService{}
+	irs := &mock.IcecreamRevisionService{}
+
+	s, err := NewServer(
+		&ServerConfig{Mode: gin.ReleaseMode},
+		&repos.Repository{
+			IcecreamService:                  is,
+			IngredientService:                &mock.IngredientService{},
+			SourcingValueService:             &mock.SourcingValueService{},
+			IcecreamHasIngredientsService:    &mock.IcecreamHasIngredientsService{},
+			IcecreamHasSourcingValuesService: &mock.IcecreamHasSourcingValuesService{},
+			AuditService:                     &mock.AuditService{},
+			IcecreamRevisionService:          irs,
+			UserService:                      userService(),
+			APIKeyService:                    &mock.APIKeyService{},
+		},
+	)
+	assert.Nil(t, err)
+
+	irs.RevisionFn = func(productId int64, revision int64) (*domain.IcecreamRevision, error) {
+		return &domain.IcecreamRevision{Revision: revision}, nil
+	}
+
+	// when
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/icecreams/602/revisions/4/revert", nil)
+	assert.Nil(t, err)
+	r.Header.Set("Authorization", basicAuthHeaderFrank)
+
+	s.ServeHTTP(w, r)
+
+	// then
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.False(t, is.RevertInvoked)
 }
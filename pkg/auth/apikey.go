@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix tells an api key apart from a JWT as bearer token
+const APIKeyPrefix = "zlr_"
+
+// NewAPIKey returns a random api key and its hash. Only the hash gets stored,
+// the key itself is shown just once to the client.
+func NewAPIKey() (key string, hash string, err error) {
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key = APIKeyPrefix + hex.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hash of the api key. Api keys are random and long
+// enough that a plain SHA-256 suffices, unlike for passwords.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether the bearer token is an api key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
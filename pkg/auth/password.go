@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash is compared against if there is no hash at all, e.g. for an
+// unknown user, so that a failing login takes as long as for an existing user
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("no password at all"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of the password
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// CheckPassword reports whether the password matches the hash. The comparison
+// takes constant time and always fails for an empty hash.
+func CheckPassword(hash []byte, password string) bool {
+	if len(hash) == 0 {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+
+	tokenIssuer = "zlr-ca"
+)
+
+// Tokens issues and verifies the signed JWTs which authenticate a user
+// as bearer for the lifetime of the token
+type Tokens struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	ttl       time.Duration
+}
+
+// NewTokens signs with the key in keyFile: the shared secret for HS256 or the
+// PEM encoded RSA private key for RS256. Without a keyFile HS256 uses a random
+// secret, so all tokens become invalid with a restart.
+func NewTokens(algorithm, keyFile string, ttl time.Duration) (*Tokens, error) {
+
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token lifetime must be positive")
+	}
+
+	var key []byte
+	if keyFile != "" {
+		b, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read token key: %v", err)
+		}
+		key = b
+		if strings.ToUpper(algorithm) == HS256 {
+			key = []byte(strings.TrimSpace(string(b)))
+		}
+	}
+
+	switch strings.ToUpper(algorithm) {
+	case HS256:
+		if key == nil {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("could not generate token secret: %v", err)
+			}
+		}
+		if len(key) < 32 {
+			return nil, fmt.Errorf("token secret must have at least 32 bytes")
+		}
+		return &Tokens{method: jwt.SigningMethodHS256, signKey: key, verifyKey: key, ttl: ttl}, nil
+
+	case RS256:
+		if key == nil {
+			return nil, fmt.Errorf("RS256 needs a private key file")
+		}
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse token key: %v", err)
+		}
+		return &Tokens{method: jwt.SigningMethodRS256, signKey: privateKey, verifyKey: &privateKey.PublicKey, ttl: ttl}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported token algorithm: %s", algorithm)
+}
+
+// Issue returns a token for the subject which expires after the lifetime
+func (t *Tokens) Issue(subject string) (string, time.Time, error) {
+
+	now := time.Now()
+	expiresAt := now.Add(t.ttl)
+
+	token, err := jwt.NewWithClaims(t.method, jwt.StandardClaims{
+		Subject:   subject,
+		Issuer:    tokenIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}).SignedString(t.signKey)
+
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("could not sign token: %v", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// Verify checks signature, issuer and expiry of the token and returns its subject
+func (t *Tokens) Verify(token string) (string, error) {
+
+	var claims jwt.StandardClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		// only the configured algorithm, otherwise e.g. the public key could be used as HS256 secret
+		if token.Method.Alg() != t.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+		}
+		return t.verifyKey, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if !claims.VerifyIssuer(tokenIssuer, true) || claims.Subject == "" {
+		return "", fmt.Errorf("invalid token claims")
+	}
+
+	return claims.Subject, nil
+}
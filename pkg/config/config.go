@@ -0,0 +1,374 @@
+// Package config loads the settings of the commands. Every setting is taken from, by
+// rising precedence, its default, the config file, the environment and the flags: the
+// setting db.password is password in the section db of the file, the environment
+// variable ZLR_DB_PASSWORD and the flag -p. A secret can be read from a file instead,
+// named by db.password_file or ZLR_DB_PASSWORD_FILE, e.g. a mounted kubernetes secret.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// EnvPrefix starts the environment variables of all settings
+	EnvPrefix = "ZLR_"
+
+	// FileSuffix is appended to the key of a secret to name a file holding it
+	FileSuffix = "_file"
+
+	redacted = "<redacted>"
+)
+
+// ErrPrintConfig is returned by Load after printing the settings if -print-config is given
+var ErrPrintConfig = errors.New("config printed")
+
+type setting struct {
+	key    string
+	flag   *flag.Flag
+	secret bool
+	source string
+}
+
+// Loader loads the settings registered with it, the flags of the command
+// are registered along with them
+type Loader struct {
+	flags    *flag.FlagSet
+	settings []*setting
+	verifies []func() error
+
+	file  string
+	print bool
+
+	output    io.Writer
+	lookupEnv func(key string) (string, bool)
+}
+
+func NewLoader(name string) *Loader {
+
+	l := &Loader{
+		flags:     flag.NewFlagSet(name, flag.ContinueOnError),
+		output:    os.Stdout,
+		lookupEnv: os.LookupEnv,
+	}
+
+	l.flags.StringVar(&l.file, "config", "", "YAML or TOML file with the settings, "+Env("config"))
+	l.flags.BoolVar(&l.print, "print-config", false, "print the settings and where they come from, secrets redacted, and exit")
+
+	return l
+}
+
+// Env returns the environment variable of the setting key, e.g. ZLR_DB_HOST for db.host
+func Env(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+func (l *Loader) String(p *string, key, name, value, usage string) {
+	l.flags.StringVar(p, name, value, l.usage(key, usage, false))
+	l.add(key, name, false)
+}
+
+// Secret is a string setting without a default, which is never printed
+// and may be read from a file, see FileSuffix
+func (l *Loader) Secret(p *string, key, name, usage string) {
+	l.flags.StringVar(p, name, "", l.usage(key, usage, true))
+	l.add(key, name, true)
+}
+
+func (l *Loader) Int(p *int, key, name string, value int, usage string) {
+	l.flags.IntVar(p, name, value, l.usage(key, usage, false))
+	l.add(key, name, false)
+}
+
+func (l *Loader) Bool(p *bool, key, name string, value bool, usage string) {
+	l.flags.BoolVar(p, name, value, l.usage(key, usage, false))
+	l.add(key, name, false)
+}
+
+func (l *Loader) Duration(p *time.Duration, key, name string, value time.Duration, usage string) {
+	l.flags.DurationVar(p, name, value, l.usage(key, usage, false))
+	l.add(key, name, false)
+}
+
+// Verify registers a check of the settings, which runs after loading them
+func (l *Loader) Verify(fn func() error) {
+	l.verifies = append(l.verifies, fn)
+}
+
+// Args returns the arguments remaining after the flags
+func (l *Loader) Args() []string {
+	return l.flags.Args()
+}
+
+// Parse loads the settings with the arguments of the command. Like flag.Parse it
+// exits on an error, as well as after printing the settings for -print-config.
+func (l *Loader) Parse() {
+
+	// the flag set reports its errors itself
+	if err := l.flags.Parse(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+
+	if err := l.load(); err == ErrPrintConfig {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// Load loads the settings with the arguments, the flags among them take
+// precedence over the environment, which takes precedence over the config file
+func (l *Loader) Load(args []string) error {
+
+	if err := l.flags.Parse(args); err != nil {
+		return err
+	}
+
+	return l.load()
+}
+
+func (l *Loader) load() error {
+
+	given := make(map[string]bool)
+	l.flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, s := range l.settings {
+		s.source = "default"
+	}
+
+	file := l.file
+	if value, ok := l.lookupEnv(Env("config")); ok && !given["config"] {
+		file = value
+	}
+
+	if file != "" {
+		values, err := readFile(file)
+		if err != nil {
+			return err
+		}
+
+		if err = l.known(values, file); err != nil {
+			return err
+		}
+
+		err = l.apply(given, func(key string) (string, string, bool) {
+			value, ok := values[key]
+			return value, key + " in " + file, ok
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := l.apply(given, func(key string) (string, string, bool) {
+		value, ok := l.lookupEnv(Env(key))
+		return value, Env(key), ok
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range l.settings {
+		if given[s.flag.Name] {
+			s.source = "flag -" + s.flag.Name
+		}
+	}
+
+	if l.print {
+		l.Print()
+	}
+
+	for _, verify := range l.verifies {
+		if err := verify(); err != nil {
+			return fmt.Errorf("invalid config: %v", err)
+		}
+	}
+
+	if l.print {
+		return ErrPrintConfig
+	}
+
+	return nil
+}
+
+// Print writes every setting with its value and where it comes from, secrets redacted
+func (l *Loader) Print() {
+
+	w := tabwriter.NewWriter(l.output, 0, 4, 2, ' ', 0)
+
+	for _, s := range l.settings {
+		value := s.flag.Value.String()
+		if s.secret && value != "" {
+			value = redacted
+		}
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.key, value, s.source)
+	}
+
+	w.Flush()
+}
+
+// apply sets the settings not given as flag to the values found by lookup, which
+// returns where it found them as well. A secret may be read from the file found by
+// its key with the FileSuffix instead.
+func (l *Loader) apply(given map[string]bool, lookup func(key string) (value, source string, ok bool)) error {
+
+	for _, s := range l.settings {
+
+		if given[s.flag.Name] {
+			continue
+		}
+
+		value, source, ok := lookup(s.key)
+
+		if s.secret {
+			if file, fileSource, fileOk := lookup(s.key + FileSuffix); fileOk {
+				if ok {
+					return fmt.Errorf("both %s and %s are given, use only one", source, fileSource)
+				}
+
+				b, err := ioutil.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("could not read %s: %v", fileSource, err)
+				}
+
+				value, source, ok = strings.TrimRight(string(b), "\r\n"), fileSource, true
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := s.flag.Value.Set(value); err != nil {
+			if s.secret {
+				value = redacted
+			}
+			return fmt.Errorf("invalid value %q of %s: %v", value, source, err)
+		}
+
+		s.source = source
+	}
+
+	return nil
+}
+
+// known makes sure every value of the config file in a section of the settings belongs to
+// one of them, so a typo does not go unnoticed. The other sections are left to the other
+// commands, which may share the file.
+func (l *Loader) known(values map[string]string, file string) error {
+
+	keys := make(map[string]bool)
+	sections := make(map[string]bool)
+	for _, s := range l.settings {
+		keys[s.key] = true
+		if s.secret {
+			keys[s.key+FileSuffix] = true
+		}
+		sections[section(s.key)] = true
+	}
+
+	for key := range values {
+		if !keys[key] && sections[section(key)] {
+			return fmt.Errorf("unknown setting %s in %s", key, file)
+		}
+	}
+
+	return nil
+}
+
+func (l *Loader) add(key, name string, secret bool) {
+	l.settings = append(l.settings, &setting{key: key, flag: l.flags.Lookup(name), secret: secret})
+}
+
+func (l *Loader) usage(key, usage string, secret bool) string {
+	if secret {
+		return fmt.Sprintf("%s, %s or a file with it in %s", usage, Env(key), Env(key+FileSuffix))
+	}
+	return fmt.Sprintf("%s, %s", usage, Env(key))
+}
+
+// readFile reads the config file and flattens its sections into keys like db.host
+func readFile(file string) (map[string]string, error) {
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %v", err)
+	}
+
+	content := make(map[string]interface{})
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &content)
+	case ".toml":
+		err = toml.Unmarshal(b, &content)
+	default:
+		return nil, fmt.Errorf("unknown format of config %s, use .yaml, .yml or .toml", file)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read config %s: %v", file, err)
+	}
+
+	values := make(map[string]string)
+	if err = flatten(values, "", content); err != nil {
+		return nil, fmt.Errorf("could not read config %s: %v", file, err)
+	}
+
+	return values, nil
+}
+
+func flatten(values map[string]string, key string, content interface{}) error {
+
+	switch content := content.(type) {
+	case map[string]interface{}:
+		for name, value := range content {
+			if err := flatten(values, join(key, name), value); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for name, value := range content {
+			if err := flatten(values, join(key, fmt.Sprint(name)), value); err != nil {
+				return err
+			}
+		}
+	case []interface{}, []map[string]interface{}:
+		return fmt.Errorf("%s must be a single value", key)
+	case nil:
+	default:
+		values[key] = fmt.Sprint(content)
+	}
+
+	return nil
+}
+
+func section(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+func join(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader_Load_withoutAnySource_usesDefaults(t *testing.T) {
+
+	// given
+	loader := newLoader(nil)
+	db := Database(loader)
+	server := Server(loader)
+
+	// when
+	err := loader.Load(nil)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres", db.Driver)
+	assert.Equal(t, "localhost", db.Host)
+	assert.Equal(t, "5432", db.Port)
+	assert.Empty(t, db.Password)
+	assert.Equal(t, "zlr_ca", db.Schema)
+	assert.Equal(t, "8080", server.Port)
+	assert.Equal(t, time.Hour, server.TokenTTL)
+}
+
+func TestLoader_Load_withAllSources_flagsOverEnvOverFile(t *testing.T) {
+
+	// given
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "zlr-ca.yaml", `
+db:
+  host: file-host
+  port: 5433
+  user: file-user
+  name: file-name
+server:
+  port: 9090
+jwt:
+  ttl: 2h
+`)
+
+	loader := newLoader(map[string]string{
+		"ZLR_DB_HOST": "env-host",
+		"ZLR_DB_USER": "env-user",
+	})
+	db := Database(loader)
+	server := Server(loader)
+
+	// when
+	err := loader.Load([]string{"-config", file, "-u", "flag-user"})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "env-host", db.Host)
+	assert.Equal(t, "5433", db.Port)
+	assert.Equal(t, "flag-user", db.Username)
+	assert.Equal(t, "file-name", db.Database)
+	assert.Equal(t, "9090", server.Port)
+	assert.Equal(t, 2*time.Hour, server.TokenTTL)
+}
+
+func TestLoader_Load_withTomlFileFromEnv_readsIt(t *testing.T) {
+
+	// given
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "zlr-ca.toml", `
+[db]
+driver = "sqlite"
+dsn = "kiosk.db"
+
+[server]
+max_failed_logins = 3
+`)
+
+	loader := newLoader(map[string]string{"ZLR_CONFIG": file})
+	db := Database(loader)
+	server := Server(loader)
+
+	// when
+	err := loader.Load(nil)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlite", db.Driver)
+	assert.Equal(t, "kiosk.db", db.DSN)
+	assert.Equal(t, 3, server.MaxFailedLogins)
+}
+
+func TestLoader_Load_withSecretFile_readsSecretWithoutTrailingNewline(t *testing.T) {
+
+	// given
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	secret := writeFile(t, dir, "db-password", "s3cr3t!\n")
+
+	loader := newLoader(map[string]string{"ZLR_DB_PASSWORD_FILE": secret})
+	db := Database(loader)
+
+	// when
+	err := loader.Load(nil)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t!", db.Password)
+}
+
+func TestLoader_Load_withSecretAndSecretFile_returnsError(t *testing.T) {
+
+	// given
+	loader := newLoader(map[string]string{
+		"ZLR_DB_PASSWORD":      "s3cr3t!",
+		"ZLR_DB_PASSWORD_FILE": "/run/secrets/db-password",
+	})
+	Database(loader)
+
+	// when
+	err := loader.Load(nil)
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestLoader_Load_withUnknownSettingInFile_returnsError(t *testing.T) {
+
+	// given
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "zlr-ca.yml", `
+db:
+  hots: localhost
+`)
+
+	loader := newLoader(nil)
+	Database(loader)
+
+	// when
+	err := loader.Load([]string{"-config", file})
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestLoader_Load_withSettingOfOtherCommandInFile_ignoresIt(t *testing.T) {
+
+	// given
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "zlr-ca.yml", `
+db:
+  host: postgres
+server:
+  port: 9090
+`)
+
+	loader := newLoader(nil)
+	db := Database(loader)
+
+	// when
+	err := loader.Load([]string{"-config", file})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres", db.Host)
+}
+
+func TestLoader_Load_withInvalidSettings_returnsError(t *testing.T) {
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"sqlite without dsn", map[string]string{"ZLR_DB_DRIVER": "sqlite"}},
+		{"unknown driver", map[string]string{"ZLR_DB_DRIVER": "mysql"}},
+		{"invalid database port", map[string]string{"ZLR_DB_PORT": "54x"}},
+		{"invalid schema", map[string]string{"ZLR_DB_SCHEMA": "zlr; drop"}},
+		{"invalid server port", map[string]string{"ZLR_SERVER_PORT": "http"}},
+		{"unknown mode", map[string]string{"ZLR_SERVER_MODE": "production"}},
+		{"unknown token algorithm", map[string]string{"ZLR_JWT_ALGORITHM": "none"}},
+		{"invalid duration", map[string]string{"ZLR_JWT_TTL": "one hour"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			// given
+			loader := newLoader(test.env)
+			Database(loader)
+			Server(loader)
+
+			// when
+			err := loader.Load(nil)
+
+			// then
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoader_Load_withPrintConfig_printsSettingsWithRedactedSecrets(t *testing.T) {
+
+	// given
+	loader := newLoader(map[string]string{"ZLR_DB_PASSWORD": "s3cr3t!"})
+	output := &bytes.Buffer{}
+	loader.output = output
+	Database(loader)
+
+	// when
+	err := loader.Load([]string{"-print-config", "-h", "postgres"})
+
+	// then
+	assert.Equal(t, ErrPrintConfig, err)
+	assert.NotContains(t, output.String(), "s3cr3t!")
+	assert.Regexp(t, `db.password\s+<redacted>\s+ZLR_DB_PASSWORD\n`, output.String())
+	assert.Regexp(t, `db.host\s+postgres\s+flag -h\n`, output.String())
+	assert.Regexp(t, `db.schema\s+zlr_ca\s+default\n`, output.String())
+}
+
+func newLoader(env map[string]string) *Loader {
+	loader := NewLoader("test")
+	loader.lookupEnv = func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	return loader
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	return dir
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
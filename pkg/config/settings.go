@@ -0,0 +1,44 @@
+package config
+
+import (
+	"github.com/fraenky8/zlr-ca/pkg/api"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Database registers the settings of the database, which every command connects to
+func Database(l *Loader) *storage.Config {
+
+	config := &storage.Config{}
+
+	l.String(&config.Driver, "db.driver", "driver", "postgres", "database to use, postgres or sqlite")
+	l.Secret(&config.DSN, "db.dsn", "dsn", "data source name of the database, required for sqlite, e.g. zlr-ca.db")
+	l.String(&config.Host, "db.host", "h", "localhost", "database host")
+	l.String(&config.Port, "db.port", "pt", "5432", "database port")
+	l.String(&config.Username, "db.user", "u", "postgres", "user to connect to the database")
+	l.Secret(&config.Password, "db.password", "p", "password for user to connect to the database")
+	l.String(&config.Database, "db.name", "d", "postgres", "name of database")
+	l.String(&config.Schema, "db.schema", "s", "zlr_ca", "schema to use in database")
+
+	l.Verify(config.Verify)
+
+	return config
+}
+
+// Server registers the settings of the api server, the policies are not among them
+func Server(l *Loader) *api.ServerConfig {
+
+	config := &api.ServerConfig{}
+
+	l.String(&config.Port, "server.port", "port", api.DefaultPort, "port the api listens on")
+	l.String(&config.Mode, "server.mode", "mode", gin.DebugMode, "mode of gin, debug, release or test")
+	l.Int(&config.MaxFailedLogins, "server.max_failed_logins", "max-failed-logins", api.DefaultMaxFailedLogins, "failed logins in a row which lock a user")
+	l.Duration(&config.Lockout, "server.lockout", "lockout", api.DefaultLockout, "how long a user stays locked")
+	l.String(&config.TokenAlgorithm, "jwt.algorithm", "jwt-alg", api.DefaultTokenAlgorithm, "algorithm to sign the tokens, HS256 or RS256")
+	l.String(&config.TokenKeyFile, "jwt.key_file", "jwt-key", "", "file with the HS256 secret or the RS256 private key, a random secret if empty")
+	l.Duration(&config.TokenTTL, "jwt.ttl", "jwt-ttl", api.DefaultTokenTTL, "lifetime of the tokens")
+
+	l.Verify(config.Verify)
+
+	return config
+}
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type APIKeyService interface {
+	Create(apiKey *APIKey) (*APIKey, error)
+	ReadAll() ([]*APIKey, error)
+	ReadById(id int64) (*APIKey, error)
+	ReadByHash(hash string) (*APIKey, error)
+	Delete(id int64) error
+}
+
+// APIKey authenticates a machine client which cannot store a password.
+// Only the hash of the key is kept, the prefix helps to recognize it.
+type APIKey struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Role      Role      `json:"role"`
+	Hash      string    `json:"-"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (k APIKey) Verify() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return fmt.Errorf("missing valid name")
+	}
+	if len(k.Name) > 100 {
+		return fmt.Errorf("name must not be longer than 100 characters")
+	}
+	if err := k.Role.Verify(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Principal is the name under which the client of the key acts, e.g. in the
+// audit log. It cannot be mistaken for a user as usernames contain no colon.
+func (k APIKey) Principal() string {
+	return "apikey:" + k.Name
+}
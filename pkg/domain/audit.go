@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SystemUser is recorded for changes which are not made on behalf of
+// an authenticated user, e.g. by the import
+const SystemUser = "system"
+
+type AuditService interface {
+	Record(entry *AuditEntry) error
+	History(entity AuditEntity, entityId string) ([]*AuditEntry, error)
+	Search(filter *AuditFilter) ([]*AuditEntry, error)
+}
+
+// AuditEntity names the kind of entity an audit entry is about
+type AuditEntity string
+
+const (
+	AuditEntityIcecream      AuditEntity = "icecream"
+	AuditEntityIngredient    AuditEntity = "ingredient"
+	AuditEntitySourcingValue AuditEntity = "sourcing_value"
+)
+
+type AuditAction string
+
+const (
+	AuditActionCreate  AuditAction = "create"
+	AuditActionUpdate  AuditAction = "update"
+	AuditActionDelete  AuditAction = "delete"
+	AuditActionRestore AuditAction = "restore"
+	AuditActionPurge   AuditAction = "purge"
+)
+
+// Actor is the one on whose behalf changes are made
+type Actor struct {
+	User      string
+	RequestID string
+}
+
+// AuditEntry records a single change of an entity: who did it, when and
+// how the entity looked before and after as json
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Entity    AuditEntity     `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Action    AuditAction     `json:"action"`
+	User      string          `json:"user"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter restricts the audit entries to the ones of a user and/or
+// to the ones created since a point in time. Empty values match all.
+type AuditFilter struct {
+	User  string
+	Since time.Time
+	Limit int
+}
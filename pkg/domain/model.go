@@ -1,38 +1,67 @@
 package domain
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
+)
+
+var (
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrNotFound        = errors.New("does not exist")
+	ErrStillReferenced = errors.New("still referenced by at least one icecream")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrVersionMismatch = errors.New("changed in the meantime")
+	ErrNotDeleted      = errors.New("not in the trash")
 )
 
 type IcecreamService interface {
 	Creates(icecreams []*Icecream) ([]int64, error)
-	Reads(ids []int64) ([]*Icecream, error)
-	Updates(icecreams []*Icecream) error
-	Deletes(ids []int64) error
+	Replaces(icecreams []*Icecream) ([]int64, error)
+	Reads(ids []int64, include ...Relation) ([]*Icecream, error)
+	List(options *IcecreamListOptions) (*IcecreamPage, error)
+	Search(query string, limit int) ([]*IcecreamSearchResult, error)
+	Updates(patches []*IcecreamPatch) error
+	Delete(id int64, version int64) error
+	Deletes(ids []int64, versions []int64) error
+	Trash() ([]*Icecream, error)
+	Restores(ids []int64) error
+	Purge(before time.Time) (int64, error)
+	Revert(id int64, revision int64) error
 }
 
 type IngredientService interface {
 	Creates(ingredients Ingredients) ([]int64, error)
 	Read(icecreamProductId int64) (Ingredients, error)
-	Reads(icecreamProductIds []int64) ([]Ingredients, error)
-	ReadAll() (Ingredients, error)
+	Reads(icecreamProductIds []int64) (map[int64]Ingredients, error)
+	ReadAll() ([]*IngredientEntry, error)
+	ReadById(id int64) (*IngredientEntry, error)
+	Create(ingredient Ingredient) (*IngredientEntry, error)
+	Rename(id int64, name Ingredient) (*IngredientEntry, error)
+	Delete(id int64, force bool) error
 }
 
 type SourcingValueService interface {
 	Creates(sourcingValues SourcingValues) ([]int64, error)
 	Read(icecreamProductId int64) (SourcingValues, error)
-	Reads(icecreamProductIds []int64) ([]SourcingValues, error)
-	ReadAll() (SourcingValues, error)
+	Reads(icecreamProductIds []int64) (map[int64]SourcingValues, error)
+	ReadAll() ([]*SourcingValueEntry, error)
+	ReadById(id int64) (*SourcingValueEntry, error)
+	Create(sourcingValue SourcingValue) (*SourcingValueEntry, error)
+	Rename(id int64, description SourcingValue) (*SourcingValueEntry, error)
+	Delete(id int64, force bool) error
 	Deletes(icecreamProductIds []int64) error
 }
 
 type IcecreamHasIngredientsService interface {
 	Create(icecreamProductId int64, ingredientIds []int64) error
+	Deletes(icecreamProductIds []int64, ingredient Ingredient) (int64, error)
 }
 
 type IcecreamHasSourcingValuesService interface {
 	Create(icecreamProductId int64, sourcingValueIds []int64) error
+	Deletes(icecreamProductIds []int64, sourcingValue SourcingValue) (int64, error)
 }
 
 type Ingredient string
@@ -54,6 +83,16 @@ func (is Ingredients) Verify() error {
 	return nil
 }
 
+// IngredientEntry is a single ingredient of the catalogue together with its id
+type IngredientEntry struct {
+	ID   int64      `json:"id"`
+	Name Ingredient `json:"name"`
+}
+
+func (i IngredientEntry) Verify() error {
+	return i.Name.Verify()
+}
+
 type SourcingValue string
 type SourcingValues []SourcingValue
 
@@ -73,6 +112,16 @@ func (sv SourcingValues) Verify() error {
 	return nil
 }
 
+// SourcingValueEntry is a single sourcing value of the catalogue together with its id
+type SourcingValueEntry struct {
+	ID          int64         `json:"id"`
+	Description SourcingValue `json:"description"`
+}
+
+func (s SourcingValueEntry) Verify() error {
+	return s.Description.Verify()
+}
+
 type Icecream struct {
 	ProductID             string `json:"productId"`
 	Name                  string `json:"name"`
@@ -84,6 +133,12 @@ type Icecream struct {
 	DietaryCertifications string `json:"dietary_certifications"`
 	SourcingValues        `json:"sourcing_values,omitempty"`
 	Ingredients           `json:"ingredients,omitempty"`
+
+	// Version is incremented with every update, it is exposed as ETag only
+	Version int64 `json:"-"`
+
+	// DeletedAt is set while the icecream is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func (i Icecream) Verify() error {
@@ -95,3 +150,79 @@ func (i Icecream) Verify() error {
 	}
 	return nil
 }
+
+// Relation names a relationship of an icecream which can be loaded together with it
+type Relation string
+
+const (
+	RelationIngredients    Relation = "ingredients"
+	RelationSourcingValues Relation = "sourcing_values"
+)
+
+// IcecreamRelations are all relations of an icecream
+var IcecreamRelations = []Relation{RelationIngredients, RelationSourcingValues}
+
+func (r Relation) Verify() error {
+	for _, relation := range IcecreamRelations {
+		if r == relation {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown relation %q, use any of %s, %s", r, RelationIngredients, RelationSourcingValues)
+}
+
+// IcecreamSortFields are the fields a listing of icecreams can be sorted by
+var IcecreamSortFields = []string{"product_id", "name"}
+
+type SortField struct {
+	Name       string
+	Descending bool
+}
+
+func (s SortField) Verify() error {
+	for _, f := range IcecreamSortFields {
+		if s.Name == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot sort by %q, use one of %s", s.Name, strings.Join(IcecreamSortFields, ", "))
+}
+
+// IcecreamListOptions controls which page of the icecreams gets listed.
+// Cursor is an opaque value taken from a previously returned IcecreamPage.
+type IcecreamListOptions struct {
+	Limit  int
+	Cursor string
+	Sort   []SortField
+	Filter IcecreamFilter
+
+	// Include names the relations loaded together with the icecreams
+	Include []Relation
+}
+
+// IcecreamFilter restricts a listing to icecreams matching all given criteria.
+// Ingredients, allergens and certifications match partially, e.g. "wheat"
+// matches "wheat flour", while sourcing values have to match exactly.
+type IcecreamFilter struct {
+	Ingredients        []string
+	WithoutIngredients []string
+	SourcingValues     []string
+	Allergens          []string
+	WithoutAllergens   []string
+	Certifications     []string
+}
+
+type IcecreamPage struct {
+	Icecreams []*Icecream
+	Total     int64
+	Next      string
+	Prev      string
+}
+
+// IcecreamSearchResult is an icecream matching a full-text search. Highlights
+// holds snippets of the matching fields with the search terms marked.
+type IcecreamSearchResult struct {
+	*Icecream
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// IcecreamPatch is a partial update of an icecream. Fields absent in the
+// request are left untouched, fields explicitly set to null get cleared.
+type IcecreamPatch struct {
+	ProductID             string         `json:"productId"`
+	Name                  OptionalString `json:"name"`
+	Description           OptionalString `json:"description"`
+	Story                 OptionalString `json:"story"`
+	ImageClosed           OptionalString `json:"image_closed"`
+	ImageOpen             OptionalString `json:"image_open"`
+	AllergyInfo           OptionalString `json:"allergy_info"`
+	DietaryCertifications OptionalString `json:"dietary_certifications"`
+	SourcingValues        RelationPatch  `json:"sourcing_values"`
+	Ingredients           RelationPatch  `json:"ingredients"`
+
+	// Version, if given, must be the current version of the icecream,
+	// otherwise the patch fails with ErrVersionMismatch
+	Version int64 `json:"-"`
+}
+
+func (p IcecreamPatch) Verify() error {
+	if strings.TrimSpace(p.ProductID) == "" {
+		return fmt.Errorf("missing valid product id")
+	}
+	if p.Name.Set && (!p.Name.Valid || strings.TrimSpace(p.Name.Value) == "") {
+		return fmt.Errorf("missing valid name")
+	}
+	if err := p.Ingredients.Verify(); err != nil {
+		return fmt.Errorf("ingredients: %v", err)
+	}
+	if err := p.SourcingValues.Verify(); err != nil {
+		return fmt.Errorf("sourcing values: %v", err)
+	}
+	return nil
+}
+
+// OptionalString remembers whether it was present in the json at all (Set)
+// and whether it was null (not Valid).
+type OptionalString struct {
+	Set   bool
+	Valid bool
+	Value string
+}
+
+func (o *OptionalString) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(bytes.TrimSpace(b)) == "null" {
+		o.Valid = false
+		o.Value = ""
+		return nil
+	}
+	o.Valid = true
+	return json.Unmarshal(b, &o.Value)
+}
+
+// RelationPatch changes the ingredients or sourcing values of an icecream. A json
+// array replaces the whole set, null clears it and an object like
+// {"add": ["peanuts"], "remove": ["wheat"]} changes only the given values.
+type RelationPatch struct {
+	Set     bool
+	Replace bool
+	Values  []string
+	Add     []string
+	Remove  []string
+}
+
+func (p *RelationPatch) UnmarshalJSON(b []byte) error {
+	p.Set = true
+
+	b = bytes.TrimSpace(b)
+	if string(b) == "null" {
+		p.Replace = true
+		p.Values = nil
+		return nil
+	}
+
+	if len(b) > 0 && b[0] == '[' {
+		p.Replace = true
+		return json.Unmarshal(b, &p.Values)
+	}
+
+	var diff struct {
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.Unmarshal(b, &diff); err != nil {
+		return fmt.Errorf("expected an array, null or an object with add and remove: %v", err)
+	}
+
+	p.Add = diff.Add
+	p.Remove = diff.Remove
+	return nil
+}
+
+func (p RelationPatch) Verify() error {
+	for _, values := range [][]string{p.Values, p.Add, p.Remove} {
+		for _, v := range values {
+			if strings.TrimSpace(v) == "" {
+				return fmt.Errorf("empty value provided")
+			}
+		}
+	}
+	return nil
+}
+
+// NewIcecreamPatch returns the patch which turns icecream before into icecream after.
+// Fields which became empty are cleared, ingredients and sourcing values are changed
+// by adding and removing only the differing values.
+func NewIcecreamPatch(before, after *Icecream) *IcecreamPatch {
+	patch := &IcecreamPatch{
+		ProductID:             before.ProductID,
+		Name:                  diffString(before.Name, after.Name),
+		Description:           diffString(before.Description, after.Description),
+		Story:                 diffString(before.Story, after.Story),
+		ImageClosed:           diffString(before.ImageClosed, after.ImageClosed),
+		ImageOpen:             diffString(before.ImageOpen, after.ImageOpen),
+		AllergyInfo:           diffString(before.AllergyInfo, after.AllergyInfo),
+		DietaryCertifications: diffString(before.DietaryCertifications, after.DietaryCertifications),
+	}
+
+	var beforeValues, afterValues []string
+	for _, v := range before.Ingredients {
+		beforeValues = append(beforeValues, string(v))
+	}
+	for _, v := range after.Ingredients {
+		afterValues = append(afterValues, string(v))
+	}
+	patch.Ingredients = diffRelation(beforeValues, afterValues)
+
+	beforeValues, afterValues = nil, nil
+	for _, v := range before.SourcingValues {
+		beforeValues = append(beforeValues, string(v))
+	}
+	for _, v := range after.SourcingValues {
+		afterValues = append(afterValues, string(v))
+	}
+	patch.SourcingValues = diffRelation(beforeValues, afterValues)
+
+	return patch
+}
+
+func diffString(before, after string) OptionalString {
+	if before == after {
+		return OptionalString{}
+	}
+	if after == "" {
+		return OptionalString{Set: true}
+	}
+	return OptionalString{Set: true, Valid: true, Value: after}
+}
+
+func diffRelation(before, after []string) RelationPatch {
+	var p RelationPatch
+	for _, v := range after {
+		if !containsString(before, v) && !containsString(p.Add, v) {
+			p.Add = append(p.Add, v)
+		}
+	}
+	for _, v := range before {
+		if !containsString(after, v) && !containsString(p.Remove, v) {
+			p.Remove = append(p.Remove, v)
+		}
+	}
+	p.Set = len(p.Add) > 0 || len(p.Remove) > 0
+	return p
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"time"
+)
+
+type IcecreamRevisionService interface {
+	Revisions(productId int64) ([]*IcecreamRevision, error)
+	Revision(productId int64, revision int64) (*IcecreamRevision, error)
+	AsOf(productId int64, at time.Time) (*IcecreamRevision, error)
+}
+
+// IcecreamRevision is the full state of an icecream, including its ingredients and
+// sourcing values, valid from a point in time until the next revision. Icecream
+// is nil for a revision which deleted the icecream.
+type IcecreamRevision struct {
+	ProductID string    `json:"productId"`
+	Revision  int64     `json:"revision"`
+	Icecream  *Icecream `json:"icecream"`
+	ValidFrom time.Time `json:"valid_from"`
+	User      string    `json:"user"`
+}
+
+// IcecreamDiff lists what changed between two revisions of an icecream
+type IcecreamDiff struct {
+	From           int64                  `json:"from"`
+	To             int64                  `json:"to"`
+	Fields         map[string]FieldChange `json:"fields"`
+	Ingredients    RelationChange         `json:"ingredients"`
+	SourcingValues RelationChange         `json:"sourcing_values"`
+}
+
+type FieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type RelationChange struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// NewIcecreamDiff compares two revisions. A deleted icecream compares like
+// an icecream without any values.
+func NewIcecreamDiff(from, to *IcecreamRevision) *IcecreamDiff {
+
+	before, after := &Icecream{}, &Icecream{}
+	if from.Icecream != nil {
+		before = from.Icecream
+	}
+	if to.Icecream != nil {
+		after = to.Icecream
+	}
+
+	diff := &IcecreamDiff{
+		From:   from.Revision,
+		To:     to.Revision,
+		Fields: map[string]FieldChange{},
+	}
+
+	fields := []struct {
+		name          string
+		before, after string
+	}{
+		{"name", before.Name, after.Name},
+		{"description", before.Description, after.Description},
+		{"story", before.Story, after.Story},
+		{"image_closed", before.ImageClosed, after.ImageClosed},
+		{"image_open", before.ImageOpen, after.ImageOpen},
+		{"allergy_info", before.AllergyInfo, after.AllergyInfo},
+		{"dietary_certifications", before.DietaryCertifications, after.DietaryCertifications},
+	}
+
+	for _, field := range fields {
+		if field.before != field.after {
+			diff.Fields[field.name] = FieldChange{From: field.before, To: field.after}
+		}
+	}
+
+	patch := NewIcecreamPatch(before, after)
+	diff.Ingredients = RelationChange{Added: patch.Ingredients.Add, Removed: patch.Ingredients.Remove}
+	diff.SourcingValues = RelationChange{Added: patch.SourcingValues.Add, Removed: patch.SourcingValues.Remove}
+
+	return diff
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// roleRanks orders the roles, every role includes the permissions of the lower ranked ones
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+type UserService interface {
+	Create(username string, passwordHash []byte, role Role) (*User, error)
+	Read(username string) (*User, error)
+	ReadAll() ([]*User, error)
+	SetPassword(username string, passwordHash []byte) error
+	SetDisabled(username string, disabled bool) error
+	SetRole(username string, role Role) error
+	LoginFailed(username string, maxFailures int, lockout time.Duration) error
+	LoginSucceeded(username string) error
+}
+
+// User is allowed to access the api once authenticated by its password.
+// A user gets locked for a while after too many failed logins in a row.
+type User struct {
+	ID           int64      `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash []byte     `json:"-"`
+	Role         Role       `json:"role"`
+	Disabled     bool       `json:"disabled"`
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+}
+
+func (u User) Verify() error {
+	if strings.TrimSpace(u.Username) == "" {
+		return fmt.Errorf("missing valid username")
+	}
+	// a colon separates username and password in the BasicAuth header
+	if strings.Contains(u.Username, ":") {
+		return fmt.Errorf("username must not contain a colon")
+	}
+	return nil
+}
+
+// Locked reports whether the user is locked at the given time
+func (u User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// Role grants permissions: a viewer reads, an editor creates and changes,
+// an admin also deletes and manages the access to the api
+type Role string
+
+func (r Role) Verify() error {
+	if _, ok := roleRanks[r]; !ok {
+		return fmt.Errorf("invalid role %q, must be one of viewer, editor or admin", r)
+	}
+	return nil
+}
+
+// Includes reports whether the role grants at least the permissions of the other role
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[other]
+}
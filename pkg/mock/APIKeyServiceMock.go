@@ -0,0 +1,47 @@
+package mock
+
+import (
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type APIKeyService struct {
+	CreateFn      func(apiKey *domain.APIKey) (*domain.APIKey, error)
+	CreateInvoked bool
+
+	ReadAllFn      func() ([]*domain.APIKey, error)
+	ReadAllInvoked bool
+
+	ReadByIdFn      func(id int64) (*domain.APIKey, error)
+	ReadByIdInvoked bool
+
+	ReadByHashFn      func(hash string) (*domain.APIKey, error)
+	ReadByHashInvoked bool
+
+	DeleteFn      func(id int64) error
+	DeleteInvoked bool
+}
+
+func (s *APIKeyService) Create(apiKey *domain.APIKey) (*domain.APIKey, error) {
+	s.CreateInvoked = true
+	return s.CreateFn(apiKey)
+}
+
+func (s *APIKeyService) ReadAll() ([]*domain.APIKey, error) {
+	s.ReadAllInvoked = true
+	return s.ReadAllFn()
+}
+
+func (s *APIKeyService) ReadById(id int64) (*domain.APIKey, error) {
+	s.ReadByIdInvoked = true
+	return s.ReadByIdFn(id)
+}
+
+func (s *APIKeyService) ReadByHash(hash string) (*domain.APIKey, error) {
+	s.ReadByHashInvoked = true
+	return s.ReadByHashFn(hash)
+}
+
+func (s *APIKeyService) Delete(id int64) error {
+	s.DeleteInvoked = true
+	return s.DeleteFn(id)
+}
@@ -0,0 +1,29 @@
+package mock
+
+import "github.com/fraenky8/zlr-ca/pkg/domain"
+
+type AuditService struct {
+	RecordFn      func(entry *domain.AuditEntry) error
+	RecordInvoked bool
+
+	HistoryFn      func(entity domain.AuditEntity, entityId string) ([]*domain.AuditEntry, error)
+	HistoryInvoked bool
+
+	SearchFn      func(filter *domain.AuditFilter) ([]*domain.AuditEntry, error)
+	SearchInvoked bool
+}
+
+func (s *AuditService) Record(entry *domain.AuditEntry) error {
+	s.RecordInvoked = true
+	return s.RecordFn(entry)
+}
+
+func (s *AuditService) History(entity domain.AuditEntity, entityId string) ([]*domain.AuditEntry, error) {
+	s.HistoryInvoked = true
+	return s.HistoryFn(entity, entityId)
+}
+
+func (s *AuditService) Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	s.SearchInvoked = true
+	return s.SearchFn(filter)
+}
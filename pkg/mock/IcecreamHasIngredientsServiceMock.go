@@ -1,11 +1,21 @@
 package mock
 
+import "github.com/fraenky8/zlr-ca/pkg/domain"
+
 type IcecreamHasIngredientsService struct {
 	CreateFn      func(icecreamProductId int64, ingredientIds []int64) error
 	CreateInvoked bool
+
+	DeletesFn      func(icecreamProductIds []int64, ingredient domain.Ingredient) (int64, error)
+	DeletesInvoked bool
 }
 
 func (s *IcecreamHasIngredientsService) Create(icecreamProductId int64, ingredientIds []int64) error {
 	s.CreateInvoked = true
 	return s.CreateFn(icecreamProductId, ingredientIds)
 }
+
+func (s *IcecreamHasIngredientsService) Deletes(icecreamProductIds []int64, ingredient domain.Ingredient) (int64, error) {
+	s.DeletesInvoked = true
+	return s.DeletesFn(icecreamProductIds, ingredient)
+}
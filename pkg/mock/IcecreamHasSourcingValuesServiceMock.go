@@ -1,11 +1,21 @@
 package mock
 
+import "github.com/fraenky8/zlr-ca/pkg/domain"
+
 type IcecreamHasSourcingValuesService struct {
 	CreateFn      func(icecreamProductId int64, ingredientIds []int64) error
 	CreateInvoked bool
+
+	DeletesFn      func(icecreamProductIds []int64, sourcingValue domain.SourcingValue) (int64, error)
+	DeletesInvoked bool
 }
 
 func (s *IcecreamHasSourcingValuesService) Create(icecreamProductId int64, sourcingValueIds []int64) error {
 	s.CreateInvoked = true
 	return s.CreateFn(icecreamProductId, sourcingValueIds)
 }
+
+func (s *IcecreamHasSourcingValuesService) Deletes(icecreamProductIds []int64, sourcingValue domain.SourcingValue) (int64, error) {
+	s.DeletesInvoked = true
+	return s.DeletesFn(icecreamProductIds, sourcingValue)
+}
@@ -0,0 +1,33 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type IcecreamRevisionService struct {
+	RevisionsFn      func(productId int64) ([]*domain.IcecreamRevision, error)
+	RevisionsInvoked bool
+
+	RevisionFn      func(productId int64, revision int64) (*domain.IcecreamRevision, error)
+	RevisionInvoked bool
+
+	AsOfFn      func(productId int64, at time.Time) (*domain.IcecreamRevision, error)
+	AsOfInvoked bool
+}
+
+func (s *IcecreamRevisionService) Revisions(productId int64) ([]*domain.IcecreamRevision, error) {
+	s.RevisionsInvoked = true
+	return s.RevisionsFn(productId)
+}
+
+func (s *IcecreamRevisionService) Revision(productId int64, revision int64) (*domain.IcecreamRevision, error) {
+	s.RevisionInvoked = true
+	return s.RevisionFn(productId, revision)
+}
+
+func (s *IcecreamRevisionService) AsOf(productId int64, at time.Time) (*domain.IcecreamRevision, error) {
+	s.AsOfInvoked = true
+	return s.AsOfFn(productId, at)
+}
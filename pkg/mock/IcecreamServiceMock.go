@@ -1,19 +1,47 @@
 package mock
 
-import "github.com/fraenky8/zlr-ca/pkg/domain"
+import (
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
 
 type IcecreamService struct {
 	CreatesFn      func(icecreams []*domain.Icecream) ([]int64, error)
 	CreatesInvoked bool
 
-	ReadsFn      func(ids []int64) ([]*domain.Icecream, error)
+	ReplacesFn      func(icecreams []*domain.Icecream) ([]int64, error)
+	ReplacesInvoked bool
+
+	ReadsFn      func(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error)
 	ReadsInvoked bool
 
-	UpdatesFn      func(icecreams []*domain.Icecream) error
+	ListFn      func(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error)
+	ListInvoked bool
+
+	SearchFn      func(query string, limit int) ([]*domain.IcecreamSearchResult, error)
+	SearchInvoked bool
+
+	UpdatesFn      func(patches []*domain.IcecreamPatch) error
 	UpdatesInvoked bool
 
-	DeletesFn      func(ids []int64) error
+	DeleteFn      func(id int64, version int64) error
+	DeleteInvoked bool
+
+	DeletesFn      func(ids []int64, versions []int64) error
 	DeletesInvoked bool
+
+	TrashFn      func() ([]*domain.Icecream, error)
+	TrashInvoked bool
+
+	RestoresFn      func(ids []int64) error
+	RestoresInvoked bool
+
+	PurgeFn      func(before time.Time) (int64, error)
+	PurgeInvoked bool
+
+	RevertFn      func(id int64, revision int64) error
+	RevertInvoked bool
 }
 
 func (s *IcecreamService) Creates(icecreams []*domain.Icecream) ([]int64, error) {
@@ -21,17 +49,57 @@ func (s *IcecreamService) Creates(icecreams []*domain.Icecream) ([]int64, error)
 	return s.CreatesFn(icecreams)
 }
 
-func (s *IcecreamService) Reads(ids []int64) ([]*domain.Icecream, error) {
+func (s *IcecreamService) Replaces(icecreams []*domain.Icecream) ([]int64, error) {
+	s.ReplacesInvoked = true
+	return s.ReplacesFn(icecreams)
+}
+
+func (s *IcecreamService) Reads(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
 	s.ReadsInvoked = true
-	return s.ReadsFn(ids)
+	return s.ReadsFn(ids, include...)
+}
+
+func (s *IcecreamService) List(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+	s.ListInvoked = true
+	return s.ListFn(options)
 }
 
-func (s *IcecreamService) Updates(icecreams []*domain.Icecream) error {
+func (s *IcecreamService) Search(query string, limit int) ([]*domain.IcecreamSearchResult, error) {
+	s.SearchInvoked = true
+	return s.SearchFn(query, limit)
+}
+
+func (s *IcecreamService) Updates(patches []*domain.IcecreamPatch) error {
 	s.UpdatesInvoked = true
-	return s.UpdatesFn(icecreams)
+	return s.UpdatesFn(patches)
+}
+
+func (s *IcecreamService) Delete(id int64, version int64) error {
+	s.DeleteInvoked = true
+	return s.DeleteFn(id, version)
 }
 
-func (s *IcecreamService) Deletes(ids []int64) error {
+func (s *IcecreamService) Deletes(ids []int64, versions []int64) error {
 	s.DeletesInvoked = true
-	return s.DeletesFn(ids)
+	return s.DeletesFn(ids, versions)
+}
+
+func (s *IcecreamService) Trash() ([]*domain.Icecream, error) {
+	s.TrashInvoked = true
+	return s.TrashFn()
+}
+
+func (s *IcecreamService) Restores(ids []int64) error {
+	s.RestoresInvoked = true
+	return s.RestoresFn(ids)
+}
+
+func (s *IcecreamService) Purge(before time.Time) (int64, error) {
+	s.PurgeInvoked = true
+	return s.PurgeFn(before)
+}
+
+func (s *IcecreamService) Revert(id int64, revision int64) error {
+	s.RevertInvoked = true
+	return s.RevertFn(id, revision)
 }
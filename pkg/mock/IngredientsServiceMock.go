@@ -9,11 +9,23 @@ type IngredientService struct {
 	ReadFn      func(icecreamProductId int64) (domain.Ingredients, error)
 	ReadInvoked bool
 
-	ReadsFn      func(icecreamProductIds []int64) ([]domain.Ingredients, error)
+	ReadsFn      func(icecreamProductIds []int64) (map[int64]domain.Ingredients, error)
 	ReadsInvoked bool
 
-	ReadAllFn      func() (domain.Ingredients, error)
+	ReadAllFn      func() ([]*domain.IngredientEntry, error)
 	ReadAllInvoked bool
+
+	ReadByIdFn      func(id int64) (*domain.IngredientEntry, error)
+	ReadByIdInvoked bool
+
+	CreateFn      func(ingredient domain.Ingredient) (*domain.IngredientEntry, error)
+	CreateInvoked bool
+
+	RenameFn      func(id int64, name domain.Ingredient) (*domain.IngredientEntry, error)
+	RenameInvoked bool
+
+	DeleteFn      func(id int64, force bool) error
+	DeleteInvoked bool
 }
 
 func (s *IngredientService) Creates(ingredients domain.Ingredients) ([]int64, error) {
@@ -21,7 +33,7 @@ func (s *IngredientService) Creates(ingredients domain.Ingredients) ([]int64, er
 	return s.CreatesFn(ingredients)
 }
 
-func (s *IngredientService) Reads(icecreamProductIds []int64) ([]domain.Ingredients, error) {
+func (s *IngredientService) Reads(icecreamProductIds []int64) (map[int64]domain.Ingredients, error) {
 	s.ReadsInvoked = true
 	return s.ReadsFn(icecreamProductIds)
 }
@@ -31,7 +43,27 @@ func (s *IngredientService) Read(icecreamProductIds int64) (domain.Ingredients,
 	return s.ReadFn(icecreamProductIds)
 }
 
-func (s *IngredientService) ReadAll() (domain.Ingredients, error) {
-	s.ReadsInvoked = true
+func (s *IngredientService) ReadAll() ([]*domain.IngredientEntry, error) {
+	s.ReadAllInvoked = true
 	return s.ReadAllFn()
 }
+
+func (s *IngredientService) ReadById(id int64) (*domain.IngredientEntry, error) {
+	s.ReadByIdInvoked = true
+	return s.ReadByIdFn(id)
+}
+
+func (s *IngredientService) Create(ingredient domain.Ingredient) (*domain.IngredientEntry, error) {
+	s.CreateInvoked = true
+	return s.CreateFn(ingredient)
+}
+
+func (s *IngredientService) Rename(id int64, name domain.Ingredient) (*domain.IngredientEntry, error) {
+	s.RenameInvoked = true
+	return s.RenameFn(id, name)
+}
+
+func (s *IngredientService) Delete(id int64, force bool) error {
+	s.DeleteInvoked = true
+	return s.DeleteFn(id, force)
+}
@@ -9,12 +9,24 @@ type SourcingValueService struct {
 	ReadFn      func(icecreamProductId int64) (domain.SourcingValues, error)
 	ReadInvoked bool
 
-	ReadsFn      func(icecreamProductIds []int64) ([]domain.SourcingValues, error)
+	ReadsFn      func(icecreamProductIds []int64) (map[int64]domain.SourcingValues, error)
 	ReadsInvoked bool
 
-	ReadAllFn      func() (domain.SourcingValues, error)
+	ReadAllFn      func() ([]*domain.SourcingValueEntry, error)
 	ReadAllInvoked bool
 
+	ReadByIdFn      func(id int64) (*domain.SourcingValueEntry, error)
+	ReadByIdInvoked bool
+
+	CreateFn      func(sourcingValue domain.SourcingValue) (*domain.SourcingValueEntry, error)
+	CreateInvoked bool
+
+	RenameFn      func(id int64, description domain.SourcingValue) (*domain.SourcingValueEntry, error)
+	RenameInvoked bool
+
+	DeleteFn      func(id int64, force bool) error
+	DeleteInvoked bool
+
 	DeletesFn      func(icecreamProductIds []int64) error
 	DeletesInvoked bool
 }
@@ -24,7 +36,7 @@ func (s *SourcingValueService) Creates(sourcingValues domain.SourcingValues) ([]
 	return s.CreatesFn(sourcingValues)
 }
 
-func (s *SourcingValueService) Reads(icecreamProductIds []int64) ([]domain.SourcingValues, error) {
+func (s *SourcingValueService) Reads(icecreamProductIds []int64) (map[int64]domain.SourcingValues, error) {
 	s.ReadsInvoked = true
 	return s.ReadsFn(icecreamProductIds)
 }
@@ -34,11 +46,31 @@ func (s *SourcingValueService) Read(icecreamProductIds int64) (domain.SourcingVa
 	return s.ReadFn(icecreamProductIds)
 }
 
-func (s *SourcingValueService) ReadAll() (domain.SourcingValues, error) {
-	s.ReadsInvoked = true
+func (s *SourcingValueService) ReadAll() ([]*domain.SourcingValueEntry, error) {
+	s.ReadAllInvoked = true
 	return s.ReadAllFn()
 }
 
+func (s *SourcingValueService) ReadById(id int64) (*domain.SourcingValueEntry, error) {
+	s.ReadByIdInvoked = true
+	return s.ReadByIdFn(id)
+}
+
+func (s *SourcingValueService) Create(sourcingValue domain.SourcingValue) (*domain.SourcingValueEntry, error) {
+	s.CreateInvoked = true
+	return s.CreateFn(sourcingValue)
+}
+
+func (s *SourcingValueService) Rename(id int64, description domain.SourcingValue) (*domain.SourcingValueEntry, error) {
+	s.RenameInvoked = true
+	return s.RenameFn(id, description)
+}
+
+func (s *SourcingValueService) Delete(id int64, force bool) error {
+	s.DeleteInvoked = true
+	return s.DeleteFn(id, force)
+}
+
 func (s *SourcingValueService) Deletes(icecreamProductIds []int64) error {
 	s.DeletesInvoked = true
 	return s.DeletesFn(icecreamProductIds)
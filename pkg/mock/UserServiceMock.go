@@ -0,0 +1,73 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type UserService struct {
+	CreateFn      func(username string, passwordHash []byte, role domain.Role) (*domain.User, error)
+	CreateInvoked bool
+
+	ReadFn      func(username string) (*domain.User, error)
+	ReadInvoked bool
+
+	ReadAllFn      func() ([]*domain.User, error)
+	ReadAllInvoked bool
+
+	SetPasswordFn      func(username string, passwordHash []byte) error
+	SetPasswordInvoked bool
+
+	SetDisabledFn      func(username string, disabled bool) error
+	SetDisabledInvoked bool
+
+	SetRoleFn      func(username string, role domain.Role) error
+	SetRoleInvoked bool
+
+	LoginFailedFn      func(username string, maxFailures int, lockout time.Duration) error
+	LoginFailedInvoked bool
+
+	LoginSucceededFn      func(username string) error
+	LoginSucceededInvoked bool
+}
+
+func (s *UserService) Create(username string, passwordHash []byte, role domain.Role) (*domain.User, error) {
+	s.CreateInvoked = true
+	return s.CreateFn(username, passwordHash, role)
+}
+
+func (s *UserService) Read(username string) (*domain.User, error) {
+	s.ReadInvoked = true
+	return s.ReadFn(username)
+}
+
+func (s *UserService) ReadAll() ([]*domain.User, error) {
+	s.ReadAllInvoked = true
+	return s.ReadAllFn()
+}
+
+func (s *UserService) SetPassword(username string, passwordHash []byte) error {
+	s.SetPasswordInvoked = true
+	return s.SetPasswordFn(username, passwordHash)
+}
+
+func (s *UserService) SetDisabled(username string, disabled bool) error {
+	s.SetDisabledInvoked = true
+	return s.SetDisabledFn(username, disabled)
+}
+
+func (s *UserService) SetRole(username string, role domain.Role) error {
+	s.SetRoleInvoked = true
+	return s.SetRoleFn(username, role)
+}
+
+func (s *UserService) LoginFailed(username string, maxFailures int, lockout time.Duration) error {
+	s.LoginFailedInvoked = true
+	return s.LoginFailedFn(username, maxFailures, lockout)
+}
+
+func (s *UserService) LoginSucceeded(username string) error {
+	s.LoginSucceededInvoked = true
+	return s.LoginSucceededFn(username)
+}
@@ -1,14 +1,22 @@
 package storage
 
 import (
-	"flag"
+	"database/sql"
 	"fmt"
+	"regexp"
+	"strconv"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
 type Config struct {
+	// Driver is the database to use, postgres or sqlite
+	Driver string
+	// DSN connects to the database, for postgres it replaces host, port, user, password and
+	// database. For sqlite it is the file keeping the data, ":memory:" keeps it in memory.
+	DSN string
+
 	Host     string
 	Port     string
 	Username string
@@ -17,25 +25,72 @@ type Config struct {
 	Schema   string
 }
 
-func NewConfigByCmdArgs() *Config {
-	config := &Config{}
-
-	flag.StringVar(&config.Host, "h", "192.168.99.100", "database host")
-	flag.StringVar(&config.Port, "pt", "5432", "database port")
-	flag.StringVar(&config.Username, "u", "postgres", "user to connect to the database")
-	flag.StringVar(&config.Password, "p", "mysecretpassword", "password für user to connect to the database")
-	flag.StringVar(&config.Database, "d", "postgres", "name of database")
-	flag.StringVar(&config.Schema, "s", "zlr_ca", "schema to use in database")
-	flag.Parse()
-
-	return config
+// Verify checks the config before connecting to the database
+func (c *Config) Verify() error {
+	switch c.Driver {
+	case "", "postgres":
+		if c.DSN != "" {
+			break
+		}
+		if c.Host == "" {
+			return fmt.Errorf("missing database host or dsn")
+		}
+		if port, err := strconv.Atoi(c.Port); c.Port != "" && (err != nil || port < 1 || port > 65535) {
+			return fmt.Errorf("invalid database port %q", c.Port)
+		}
+		if !identifier.MatchString(c.Schema) {
+			return fmt.Errorf("invalid database schema %q, use letters, digits and underscores", c.Schema)
+		}
+	case "sqlite":
+		if c.DSN == "" {
+			return fmt.Errorf("missing dsn, the file of the sqlite database")
+		}
+	default:
+		return fmt.Errorf("unknown database driver %q, use postgres or sqlite", c.Driver)
+	}
+	return nil
 }
 
+// identifier is what a schema name may look like, it becomes part of every statement
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type Database interface {
 	Connect() error
 	Close() error
 	DB() *sqlx.DB
 	Config() *Config
+	// Dialect tells how the SQL of the database differs
+	Dialect() Dialect
+	// Executor runs the statements, within a transaction if there is one
+	Executor() Executor
+	// Transaction is the unit of work: fn gets a Database whose Executor runs everything
+	// in one transaction, committed if fn succeeds and rolled back otherwise
+	Transaction(fn func(tx Database) error) error
+}
+
+// Executor is implemented by both *sqlx.DB and *sqlx.Tx
+type Executor interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Preparex(query string) (*sqlx.Stmt, error)
+	Rebind(query string) string
+}
+
+// Open connects to the database of the configured driver
+func Open(config *Config) (Database, error) {
+	if err := config.Verify(); err != nil {
+		return nil, err
+	}
+
+	switch config.Driver {
+	case "", "postgres":
+		return NewPostgres(config)
+	case "sqlite":
+		return NewSQLite(config)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q, use postgres or sqlite", config.Driver)
+	}
 }
 
 type Postgres struct {
@@ -58,8 +113,11 @@ func NewPostgres(config *Config) (*Postgres, error) {
 }
 
 func (pg *Postgres) Connect() (err error) {
-	dsn := fmt.Sprintf("host=%v port=%v user=%v dbname=%v password=%v sslmode=disable",
-		pg.cfg.Host, pg.cfg.Port, pg.cfg.Username, pg.cfg.Database, pg.cfg.Password)
+	dsn := pg.cfg.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf("host=%v port=%v user=%v dbname=%v password=%v sslmode=disable",
+			pg.cfg.Host, pg.cfg.Port, pg.cfg.Username, pg.cfg.Database, pg.cfg.Password)
+	}
 
 	pg.db, err = sqlx.Open("postgres", dsn)
 	if err != nil {
@@ -84,3 +142,68 @@ func (pg *Postgres) DB() *sqlx.DB {
 func (pg *Postgres) Config() *Config {
 	return pg.cfg
 }
+
+func (pg *Postgres) Dialect() Dialect {
+	return PostgresDialect{}
+}
+
+func (pg *Postgres) Executor() Executor {
+	return pg.db
+}
+
+func (pg *Postgres) Transaction(fn func(tx Database) error) (err error) {
+
+	tx, err := pg.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(&PostgresTx{tx: tx, pg: pg}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PostgresTx is a Database bound to a running transaction
+type PostgresTx struct {
+	tx *sqlx.Tx
+	pg *Postgres
+}
+
+func (t *PostgresTx) Connect() error {
+	return fmt.Errorf("cannot connect within a transaction")
+}
+
+func (t *PostgresTx) Close() error {
+	return fmt.Errorf("cannot close a transaction")
+}
+
+func (t *PostgresTx) DB() *sqlx.DB {
+	return t.pg.DB()
+}
+
+func (t *PostgresTx) Config() *Config {
+	return t.pg.Config()
+}
+
+func (t *PostgresTx) Dialect() Dialect {
+	return t.pg.Dialect()
+}
+
+func (t *PostgresTx) Executor() Executor {
+	return t.tx
+}
+
+// Transaction joins the already running transaction
+func (t *PostgresTx) Transaction(fn func(tx Database) error) error {
+	return fn(t)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"regexp"
+	"time"
+)
+
+// Dialect covers the differences between the SQL of the supported databases.
+// The repos write their statements with $n placeholders, schema prefixed tables,
+// ON CONFLICT and RETURNING clauses, which all supported databases understand
+// or get translated by the executor of the database.
+type Dialect interface {
+	Name() string
+	// Rebind turns the $n placeholders into the ones of the database
+	Rebind(query string) string
+	// Now is the expression of the current time
+	Now() string
+	// Time turns t into an argument comparable with the times kept by the database
+	Time(t time.Time) interface{}
+	// JSON casts the placeholder to the json type of the database
+	JSON(placeholder string) string
+	// ILike is the operator of a case-insensitive LIKE
+	ILike() string
+	// FullTextSearch reports whether the database ranks texts by itself
+	FullTextSearch() bool
+}
+
+type PostgresDialect struct{}
+
+func (PostgresDialect) Name() string {
+	return "postgres"
+}
+
+func (PostgresDialect) Rebind(query string) string {
+	return query
+}
+
+func (PostgresDialect) Now() string {
+	return "now()"
+}
+
+func (PostgresDialect) Time(t time.Time) interface{} {
+	return t
+}
+
+func (PostgresDialect) JSON(placeholder string) string {
+	return placeholder + "::jsonb"
+}
+
+func (PostgresDialect) ILike() string {
+	return "ILIKE"
+}
+
+func (PostgresDialect) FullTextSearch() bool {
+	return true
+}
+
+// SQLiteTimeFormat is how sqlite keeps times: text in UTC which sorts like the time itself
+const SQLiteTimeFormat = "2006-01-02 15:04:05.000"
+
+var placeholders = regexp.MustCompile(`\$(\d+)`)
+
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Name() string {
+	return "sqlite"
+}
+
+// Rebind turns $n into ?n, which sqlite binds by number like postgres
+func (SQLiteDialect) Rebind(query string) string {
+	return placeholders.ReplaceAllString(query, "?$1")
+}
+
+func (SQLiteDialect) Now() string {
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+func (SQLiteDialect) Time(t time.Time) interface{} {
+	return t.UTC().Format(SQLiteTimeFormat)
+}
+
+// JSON leaves the placeholder as it is, sqlite keeps json as text
+func (SQLiteDialect) JSON(placeholder string) string {
+	return placeholder
+}
+
+// ILike is LIKE, which ignores the case of ASCII letters in sqlite
+func (SQLiteDialect) ILike() string {
+	return "LIKE"
+}
+
+func (SQLiteDialect) FullTextSearch() bool {
+	return false
+}
@@ -0,0 +1,15 @@
+package dtos
+
+import (
+	"time"
+)
+
+type APIKey struct {
+	Id        int64     `db:"id"`
+	Name      string    `db:"name"`
+	Prefix    string    `db:"prefix"`
+	Role      string    `db:"role"`
+	KeyHash   string    `db:"key_hash"`
+	CreatedBy string    `db:"created_by"`
+	CreatedAt time.Time `db:"created_at"`
+}
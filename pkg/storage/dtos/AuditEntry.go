@@ -0,0 +1,18 @@
+package dtos
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AuditEntry struct {
+	Id        int64          `db:"id"`
+	Entity    string         `db:"entity"`
+	EntityId  string         `db:"entity_id"`
+	Action    string         `db:"action"`
+	Username  string         `db:"username"`
+	RequestId sql.NullString `db:"request_id"`
+	Before    []byte         `db:"before"`
+	After     []byte         `db:"after"`
+	CreatedAt time.Time      `db:"created_at"`
+}
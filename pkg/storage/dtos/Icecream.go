@@ -2,6 +2,7 @@ package dtos
 
 import (
 	"database/sql"
+	"time"
 )
 
 type Icecream struct {
@@ -13,4 +14,6 @@ type Icecream struct {
 	ImageClosed           sql.NullString `db:"image_closed"`
 	AllergyInfo           sql.NullString `db:"allergy_info"`
 	DietaryCertifications sql.NullString `db:"dietary_certifications"`
+	Version               int64          `db:"version"`
+	DeletedAt             *time.Time     `db:"deleted_at"`
 }
@@ -0,0 +1,7 @@
+package dtos
+
+// IcecreamIngredient is an ingredient together with the icecream it belongs to
+type IcecreamIngredient struct {
+	IcecreamProductId int64 `db:"icecream_product_id"`
+	Ingredients
+}
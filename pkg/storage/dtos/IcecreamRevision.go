@@ -0,0 +1,13 @@
+package dtos
+
+import (
+	"time"
+)
+
+type IcecreamRevision struct {
+	IcecreamProductId int64     `db:"icecream_product_id"`
+	Revision          int64     `db:"revision"`
+	Icecream          []byte    `db:"icecream"`
+	ValidFrom         time.Time `db:"valid_from"`
+	Username          string    `db:"username"`
+}
@@ -0,0 +1,9 @@
+package dtos
+
+type IcecreamSearchResult struct {
+	Icecream
+	Score                float64 `db:"score"`
+	NameHighlight        string  `db:"name_highlight"`
+	DescriptionHighlight string  `db:"description_highlight"`
+	StoryHighlight       string  `db:"story_highlight"`
+}
@@ -0,0 +1,7 @@
+package dtos
+
+// IcecreamSourcingValue is a sourcing value together with the icecream it belongs to
+type IcecreamSourcingValue struct {
+	IcecreamProductId int64 `db:"icecream_product_id"`
+	SourcingValues
+}
@@ -0,0 +1,11 @@
+package dtos
+
+import (
+	"time"
+)
+
+type SchemaMigration struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	AppliedAt time.Time `db:"applied_at"`
+}
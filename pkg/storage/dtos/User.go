@@ -0,0 +1,15 @@
+package dtos
+
+import (
+	"time"
+)
+
+type User struct {
+	Id           int64      `db:"id"`
+	Username     string     `db:"username"`
+	PasswordHash []byte     `db:"password_hash"`
+	Role         string     `db:"role"`
+	Disabled     bool       `db:"disabled"`
+	FailedLogins int        `db:"failed_logins"`
+	LockedUntil  *time.Time `db:"locked_until"`
+}
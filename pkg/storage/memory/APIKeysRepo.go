@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type APIKeysRepo struct {
+	store *Store
+}
+
+func (r *APIKeysRepo) Create(apiKey *domain.APIKey) (created *domain.APIKey, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		name := strings.TrimSpace(apiKey.Name)
+		for _, existing := range d.apiKeys {
+			if existing.Name == name {
+				return domain.ErrAlreadyExists
+			}
+			if existing.Hash == apiKey.Hash {
+				return fmt.Errorf("could not create api key: key hash is not unique")
+			}
+		}
+
+		d.apiKeySequence++
+		key := *apiKey
+		key.ID = d.apiKeySequence
+		key.Name = name
+		key.CreatedAt = time.Now()
+		d.apiKeys[key.ID] = key
+
+		created = &key
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (r *APIKeysRepo) ReadAll() (apiKeys []*domain.APIKey, err error) {
+	err = r.store.read(func(d *data) error {
+		apiKeys = []*domain.APIKey{}
+		var ids []int64
+		for id := range d.apiKeys {
+			ids = append(ids, id)
+		}
+		sortIds(ids)
+		for _, id := range ids {
+			apiKey := d.apiKeys[id]
+			apiKeys = append(apiKeys, &apiKey)
+		}
+		return nil
+	})
+	return apiKeys, err
+}
+
+func (r *APIKeysRepo) ReadById(id int64) (apiKey *domain.APIKey, err error) {
+	return r.read(func(key domain.APIKey) bool { return key.ID == id })
+}
+
+func (r *APIKeysRepo) ReadByHash(hash string) (apiKey *domain.APIKey, err error) {
+	return r.read(func(key domain.APIKey) bool { return key.Hash == hash })
+}
+
+func (r *APIKeysRepo) Delete(id int64) error {
+	return r.store.write(func(d *data) error {
+		if _, ok := d.apiKeys[id]; !ok {
+			return fmt.Errorf("api key with id = %d does not exist", id)
+		}
+		delete(d.apiKeys, id)
+		return nil
+	})
+}
+
+func (r *APIKeysRepo) read(match func(key domain.APIKey) bool) (apiKey *domain.APIKey, err error) {
+	err = r.store.read(func(d *data) error {
+		for _, key := range d.apiKeys {
+			if match(key) {
+				apiKey = &key
+				return nil
+			}
+		}
+		return nil
+	})
+	return apiKey, err
+}
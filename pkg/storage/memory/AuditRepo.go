@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type AuditRepo struct {
+	store *Store
+}
+
+func (r *AuditRepo) Record(entry *domain.AuditEntry) error {
+	return r.store.write(func(d *data) error {
+		d.append(entry)
+		return nil
+	})
+}
+
+// History returns all changes of the entity, oldest first
+func (r *AuditRepo) History(entity domain.AuditEntity, entityId string) (entries []*domain.AuditEntry, err error) {
+	err = r.store.read(func(d *data) error {
+		entries = []*domain.AuditEntry{}
+		for _, entry := range d.audit {
+			if entry.Entity == entity && entry.EntityID == entityId {
+				entries = append(entries, copyAuditEntry(entry))
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Search returns the changes matching the filter, oldest first
+func (r *AuditRepo) Search(filter *domain.AuditFilter) (entries []*domain.AuditEntry, err error) {
+	err = r.store.read(func(d *data) error {
+		entries = []*domain.AuditEntry{}
+		for _, entry := range d.audit {
+			if filter.Limit > 0 && len(entries) == filter.Limit {
+				break
+			}
+			if filter.User != "" && entry.User != filter.User {
+				continue
+			}
+			if !filter.Since.IsZero() && entry.CreatedAt.Before(filter.Since) {
+				continue
+			}
+			entries = append(entries, copyAuditEntry(entry))
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// append adds the entry to the audit log and sets its id and creation time
+func (d *data) append(entry *domain.AuditEntry) {
+	d.auditSequence++
+	entry.ID = d.auditSequence
+	entry.CreatedAt = time.Now()
+	d.audit = append(d.audit, copyAuditEntry(entry))
+}
+
+// record writes the audit entry of a change made on behalf of the actor
+func (d *data) record(actor *domain.Actor, entity domain.AuditEntity, entityId string, action domain.AuditAction, before, after interface{}) error {
+
+	entry := &domain.AuditEntry{
+		Entity:   entity,
+		EntityID: entityId,
+		Action:   action,
+		User:     domain.SystemUser,
+	}
+
+	if actor != nil {
+		entry.User = actor.User
+		entry.RequestID = actor.RequestID
+	}
+
+	var err error
+	if entry.Before, err = marshalState(before); err != nil {
+		return err
+	}
+	if entry.After, err = marshalState(after); err != nil {
+		return err
+	}
+
+	d.append(entry)
+	return nil
+}
+
+func copyAuditEntry(entry *domain.AuditEntry) *domain.AuditEntry {
+	c := *entry
+	return &c
+}
+
+// marshalState marshals the state of an entity, nothing at all if there is none
+func marshalState(state interface{}) (json.RawMessage, error) {
+
+	if state == nil {
+		return nil, nil
+	}
+	if v := reflect.ValueOf(state); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal state for audit log: %v", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type IcecreamHasIngredientsRepo struct {
+	store *Store
+}
+
+func (r *IcecreamHasIngredientsRepo) Create(productId int64, ingredientIds []int64) error {
+	return r.store.write(func(d *data) error {
+		return d.link(d.ingredients, productId, ingredientIds, "ingredient")
+	})
+}
+
+// Deletes removes the relationship between the given icecreams and the ingredient
+// and returns the number of removed relationships. The ingredient itself is kept.
+func (r *IcecreamHasIngredientsRepo) Deletes(productIds []int64, ingredient domain.Ingredient) (deleted int64, err error) {
+	err = r.store.write(func(d *data) error {
+		for _, id := range productIds {
+			if d.ingredients.unlink(id, string(ingredient)) {
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
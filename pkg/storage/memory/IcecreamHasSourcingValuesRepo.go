@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type IcecreamHasSourcingValuesRepo struct {
+	store *Store
+}
+
+func (r *IcecreamHasSourcingValuesRepo) Create(productId int64, sourcingValueIds []int64) error {
+	return r.store.write(func(d *data) error {
+		return d.link(d.sourcingValues, productId, sourcingValueIds, "sourcing value")
+	})
+}
+
+// Deletes removes the relationship between the given icecreams and the sourcing value
+// and returns the number of removed relationships. The sourcing value itself is kept.
+func (r *IcecreamHasSourcingValuesRepo) Deletes(productIds []int64, sourcingValue domain.SourcingValue) (deleted int64, err error) {
+	err = r.store.write(func(d *data) error {
+		for _, id := range productIds {
+			if d.sourcingValues.unlink(id, string(sourcingValue)) {
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,805 @@
+package memory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/search"
+)
+
+type IcecreamRepo struct {
+	store *Store
+	actor *domain.Actor
+}
+
+// Creates inserts the icecreams together with their ingredients and sourcing values.
+// Either all icecreams get created or none. ErrAlreadyExists is returned if one of
+// the icecreams exists, even if in the trash.
+func (r *IcecreamRepo) Creates(icecreams []*domain.Icecream) (ids []int64, err error) {
+
+	err = r.store.write(func(d *data) error {
+		for _, icecream := range icecreams {
+
+			productId, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+			if err != nil {
+				return fmt.Errorf("could not create icecream: faulty productID = %s: %v", icecream.ProductID, err)
+			}
+
+			if _, ok := d.icecreams[productId]; ok {
+				return domain.ErrAlreadyExists
+			}
+
+			d.icecreams[productId] = stored(icecream, d.firstVersion(productId))
+			if err = d.relate(r.actor, productId, icecream); err != nil {
+				return err
+			}
+
+			if err = r.record(d, productId, domain.AuditActionCreate, nil, d.icecream(productId)); err != nil {
+				return err
+			}
+
+			ids = append(ids, productId)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Replaces creates the icecreams or, if they already exist, replaces them entirely
+// including their ingredients and sourcing values. Icecreams in the trash are restored.
+// It returns the product ids of the icecreams which did not exist before.
+func (r *IcecreamRepo) Replaces(icecreams []*domain.Icecream) (created []int64, err error) {
+
+	err = r.store.write(func(d *data) error {
+		for _, icecream := range icecreams {
+			inserted, err := r.replace(d, icecream)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				productId, _ := strconv.ParseInt(icecream.ProductID, 10, 64)
+				created = append(created, productId)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// replace upserts a single icecream and reports whether it has been inserted
+func (r *IcecreamRepo) replace(d *data, icecream *domain.Icecream) (inserted bool, err error) {
+
+	productId, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("faulty productID = %s: %v", icecream.ProductID, err)
+	}
+
+	before := d.icecream(productId)
+
+	existing, ok := d.icecreams[productId]
+	inserted = !ok
+
+	version := d.firstVersion(productId)
+	if ok {
+		version = existing.Version + 1
+	}
+
+	d.icecreams[productId] = stored(icecream, version)
+
+	d.ingredients.unlinkAll(productId)
+	d.sourcingValues.unlinkAll(productId)
+	if err = d.relate(r.actor, productId, icecream); err != nil {
+		return false, err
+	}
+
+	action := domain.AuditActionUpdate
+	if inserted {
+		action = domain.AuditActionCreate
+	}
+
+	if err = r.record(d, productId, action, before, d.icecream(productId)); err != nil {
+		return false, err
+	}
+
+	return inserted, nil
+}
+
+// Reads returns the icecreams with the given ids together with the requested relations
+func (r *IcecreamRepo) Reads(ids []int64, include ...domain.Relation) (icecreams []*domain.Icecream, err error) {
+
+	for _, relation := range include {
+		if err := relation.Verify(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.store.read(func(d *data) error {
+		for _, id := range ids {
+			if icecream := d.icecreamWith(id, include); icecream != nil {
+				icecreams = append(icecreams, icecream)
+			}
+		}
+		return nil
+	})
+
+	return icecreams, err
+}
+
+// List returns a page of icecreams using keyset pagination. The product id is
+// always used as last sort key so the order of the icecreams is stable.
+func (r *IcecreamRepo) List(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+
+	sorting, err := keysetSort(options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor *icecreamCursor
+	if options.Cursor != "" {
+		if cursor, err = decodeIcecreamCursor(options.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// walking backwards means reading in reverse order and flipping the result afterwards
+	before := cursor != nil && cursor.Before
+	if before {
+		sorting = reverseSort(sorting)
+	}
+
+	var matching []*domain.Icecream
+	err = r.store.read(func(d *data) error {
+		for id := range d.icecreams {
+			if icecream := d.icecreamWith(id, options.Include); icecream != nil && d.matches(id, icecream, &options.Filter) {
+				matching = append(matching, icecream)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return compareIcecreams(sorting, keyOf(matching[i]), keyOf(matching[j])) < 0
+	})
+
+	var icecreams []*domain.Icecream
+	for _, icecream := range matching {
+		if cursor != nil && compareIcecreams(sorting, keyOf(icecream), *cursor) <= 0 {
+			continue
+		}
+		icecreams = append(icecreams, icecream)
+		if len(icecreams) > options.Limit {
+			break
+		}
+	}
+
+	more := len(icecreams) > options.Limit
+	if more {
+		icecreams = icecreams[:options.Limit]
+	}
+
+	if before {
+		for i, j := 0, len(icecreams)-1; i < j; i, j = i+1, j-1 {
+			icecreams[i], icecreams[j] = icecreams[j], icecreams[i]
+		}
+	}
+
+	page := &domain.IcecreamPage{
+		Icecreams: icecreams,
+		Total:     int64(len(matching)),
+	}
+
+	if len(icecreams) == 0 {
+		return page, nil
+	}
+
+	hasNext, hasPrev := more, cursor != nil
+	if before {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		last := keyOf(icecreams[len(icecreams)-1])
+		page.Next = last.encode()
+	}
+
+	if hasPrev {
+		first := keyOf(icecreams[0])
+		first.Before = true
+		page.Prev = first.encode()
+	}
+
+	return page, nil
+}
+
+// Search ranks the icecreams by how many of the search terms their name, description,
+// story and ingredient names contain, see package search
+func (r *IcecreamRepo) Search(query string, limit int) ([]*domain.IcecreamSearchResult, error) {
+
+	terms, excluded := search.Terms(query)
+
+	results := []*domain.IcecreamSearchResult{}
+	err := r.store.read(func(d *data) error {
+		for id := range d.icecreams {
+			icecream := d.icecreamWith(id, nil)
+			if icecream == nil {
+				continue
+			}
+			if result := search.Match(icecream, d.ingredients.of(id), terms, excluded); result != nil {
+				results = append(results, result)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("could not search icecreams: %v", err)
+	}
+
+	return search.Rank(results, limit), nil
+}
+
+// Updates applies the patches including the changes of the ingredients and
+// sourcing values. Either all patches are applied or none.
+func (r *IcecreamRepo) Updates(patches []*domain.IcecreamPatch) error {
+	return r.store.write(func(d *data) error {
+		for _, patch := range patches {
+			if err := r.update(d, patch); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *IcecreamRepo) update(d *data, patch *domain.IcecreamPatch) error {
+
+	productId, err := strconv.ParseInt(patch.ProductID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("faulty productID = %s: %v", patch.ProductID, err)
+	}
+
+	before := d.icecream(productId)
+	if before == nil || (patch.Version != 0 && patch.Version != before.Version) {
+		return notUpdated(before, patch.Version)
+	}
+
+	icecream := d.icecreams[productId]
+
+	fields := []struct {
+		field *string
+		value domain.OptionalString
+	}{
+		{&icecream.Name, patch.Name},
+		{&icecream.Description, patch.Description},
+		{&icecream.Story, patch.Story},
+		{&icecream.ImageOpen, patch.ImageOpen},
+		{&icecream.ImageClosed, patch.ImageClosed},
+		{&icecream.AllergyInfo, patch.AllergyInfo},
+		{&icecream.DietaryCertifications, patch.DietaryCertifications},
+	}
+
+	for _, f := range fields {
+		if f.value.Set {
+			*f.field = f.value.Value
+		}
+	}
+
+	// every update, even one of the relations only, creates a new version
+	icecream.Version++
+	d.icecreams[productId] = icecream
+
+	err = updateRelation(d.ingredients, productId, &patch.Ingredients, func(name string) (int64, error) {
+		return d.createIngredient(r.actor, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = updateRelation(d.sourcingValues, productId, &patch.SourcingValues, func(description string) (int64, error) {
+		return d.createSourcingValue(r.actor, description)
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.record(d, productId, domain.AuditActionUpdate, before, d.icecream(productId))
+}
+
+// notUpdated tells why a conditional update or delete did not affect the icecream:
+// either it does not exist, ErrNotFound, or it is not at the expected version anymore,
+// ErrVersionMismatch
+func notUpdated(icecream *domain.Icecream, version int64) error {
+	if version == 0 || icecream == nil {
+		return domain.ErrNotFound
+	}
+	return domain.ErrVersionMismatch
+}
+
+// updateRelation applies the patch to the links of the icecream, create returns the id
+// of an added value and creates it if it is missing
+func updateRelation(e *entries, productId int64, patch *domain.RelationPatch, create func(value string) (int64, error)) error {
+
+	if !patch.Set {
+		return nil
+	}
+
+	add := patch.Add
+	if patch.Replace {
+		e.unlinkAll(productId)
+		add = patch.Values
+	}
+
+	for _, value := range patch.Remove {
+		e.unlink(productId, value)
+	}
+
+	for _, value := range add {
+		id, err := create(value)
+		if err != nil {
+			return err
+		}
+		e.link(productId, id)
+	}
+
+	return nil
+}
+
+// Delete moves the icecream into the trash, but only if it is still at the given
+// version, otherwise ErrVersionMismatch is returned
+func (r *IcecreamRepo) Delete(id int64, version int64) error {
+	return r.store.write(func(d *data) error {
+
+		before := d.icecream(id)
+		if before == nil || before.Version != version {
+			return notUpdated(before, version)
+		}
+
+		d.trash(id)
+
+		return r.record(d, id, domain.AuditActionDelete, before, nil)
+	})
+}
+
+// Deletes moves the icecreams into the trash. Their ingredients and sourcing values
+// are kept, so they come back on restore. If versions are given, every icecream must
+// still be at the version of the same index, otherwise ErrVersionMismatch is returned.
+func (r *IcecreamRepo) Deletes(ids []int64, versions []int64) error {
+	if versions != nil && len(versions) != len(ids) {
+		return fmt.Errorf("%d versions given for %d icecreams", len(versions), len(ids))
+	}
+
+	return r.store.write(func(d *data) error {
+		for k, id := range ids {
+
+			var version int64
+			if versions != nil {
+				version = versions[k]
+			}
+
+			before := d.icecream(id)
+			if before == nil || (version != 0 && version != before.Version) {
+				return notUpdated(before, version)
+			}
+
+			d.trash(id)
+
+			if err := r.record(d, id, domain.AuditActionDelete, before, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Trash returns the deleted icecreams including all their relations, latest deleted first
+func (r *IcecreamRepo) Trash() (icecreams []*domain.Icecream, err error) {
+
+	err = r.store.read(func(d *data) error {
+		for id, icecream := range d.icecreams {
+			if icecream.DeletedAt != nil {
+				icecreams = append(icecreams, d.withRelations(id, icecream, domain.IcecreamRelations))
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(icecreams, func(i, j int) bool {
+		if !icecreams[i].DeletedAt.Equal(*icecreams[j].DeletedAt) {
+			return icecreams[i].DeletedAt.After(*icecreams[j].DeletedAt)
+		}
+		return keyOf(icecreams[i]).ProductId < keyOf(icecreams[j]).ProductId
+	})
+
+	return icecreams, err
+}
+
+// Restores takes the icecreams out of the trash. If one of them is not in
+// the trash, none gets restored and ErrNotDeleted is returned.
+func (r *IcecreamRepo) Restores(ids []int64) error {
+	return r.store.write(func(d *data) error {
+		for _, id := range ids {
+
+			icecream, ok := d.icecreams[id]
+			if !ok || icecream.DeletedAt == nil {
+				return domain.ErrNotDeleted
+			}
+
+			icecream.DeletedAt = nil
+			icecream.Version++
+			d.icecreams[id] = icecream
+
+			if err := r.record(d, id, domain.AuditActionRestore, nil, d.icecream(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Purge finally deletes the icecreams which were moved into the trash before the given
+// time together with their relations. It returns the number of purged icecreams.
+func (r *IcecreamRepo) Purge(before time.Time) (purged int64, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		var ids []int64
+		for id, icecream := range d.icecreams {
+			if icecream.DeletedAt != nil && icecream.DeletedAt.Before(before) {
+				ids = append(ids, id)
+			}
+		}
+		sortIds(ids)
+
+		for _, id := range ids {
+			delete(d.icecreams, id)
+			d.ingredients.unlinkAll(id)
+			d.sourcingValues.unlinkAll(id)
+
+			if err := r.record(d, id, domain.AuditActionPurge, nil, nil); err != nil {
+				return err
+			}
+		}
+
+		purged = int64(len(ids))
+		return nil
+	})
+
+	return purged, err
+}
+
+// Revert replaces the icecream by the state of the given revision, which creates
+// a new revision. An icecream in the trash gets restored by that.
+func (r *IcecreamRepo) Revert(id int64, number int64) error {
+	return r.store.write(func(d *data) error {
+
+		var revision *domain.IcecreamRevision
+		for _, rev := range d.revisions[id] {
+			if rev.number == number {
+				var err error
+				if revision, err = convertRevision(id, rev); err != nil {
+					return fmt.Errorf("could not read revision %d of icecream with productID = %d: %v", number, id, err)
+				}
+			}
+		}
+
+		if revision == nil || revision.Icecream == nil {
+			return fmt.Errorf("revision %d of icecream with productID = %d does not hold an icecream", number, id)
+		}
+
+		_, err := r.replace(d, revision.Icecream)
+		return err
+	})
+}
+
+// record writes the change of the icecream into the audit log and keeps
+// the state after the change as a new revision of the icecream
+func (r *IcecreamRepo) record(d *data, productId int64, action domain.AuditAction, before, after *domain.Icecream) error {
+
+	err := d.record(r.actor, domain.AuditEntityIcecream, strconv.FormatInt(productId, 10), action, before, after)
+	if err != nil {
+		return err
+	}
+
+	user := domain.SystemUser
+	if r.actor != nil {
+		user = r.actor.User
+	}
+
+	return d.revise(productId, after, user)
+}
+
+// changed gives every icecream whose relations were changed by other means than an
+// update, e.g. by renaming one of its ingredients, a new version and records the change
+// like an update. before holds the icecreams as they were before the change.
+func (r *IcecreamRepo) changed(d *data, before []*domain.Icecream) error {
+
+	for _, icecream := range before {
+
+		productId, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("faulty productID = %s: %v", icecream.ProductID, err)
+		}
+
+		after := d.icecream(productId)
+		if after == nil || sameRelations(icecream, after) {
+			continue
+		}
+
+		stored := d.icecreams[productId]
+		stored.Version++
+		d.icecreams[productId] = stored
+
+		if err = r.record(d, productId, domain.AuditActionUpdate, icecream, d.icecream(productId)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameRelations reports whether both icecreams have the same ingredients and sourcing values
+func sameRelations(a, b *domain.Icecream) bool {
+	return reflect.DeepEqual(a.Ingredients, b.Ingredients) && reflect.DeepEqual(a.SourcingValues, b.SourcingValues)
+}
+
+// stored returns the icecream as it is kept: without relations, trash or version of the given one
+func stored(icecream *domain.Icecream, version int64) domain.Icecream {
+	s := *icecream
+	s.Ingredients = nil
+	s.SourcingValues = nil
+	s.DeletedAt = nil
+	s.Version = version
+	return s
+}
+
+// firstVersion continues after the revisions of a purged icecream with the same product id,
+// so an ETag of it never matches the new icecream
+func (d *data) firstVersion(productId int64) int64 {
+	return int64(len(d.revisions[productId])) + 1
+}
+
+// relate creates the missing ingredients and sourcing values of the icecream as the actor
+// and links them to it
+func (d *data) relate(actor *domain.Actor, productId int64, icecream *domain.Icecream) error {
+	for _, ingredient := range icecream.Ingredients {
+		id, err := d.createIngredient(actor, string(ingredient))
+		if err != nil {
+			return err
+		}
+		d.ingredients.link(productId, id)
+	}
+	for _, sourcingValue := range icecream.SourcingValues {
+		id, err := d.createSourcingValue(actor, string(sourcingValue))
+		if err != nil {
+			return err
+		}
+		d.sourcingValues.link(productId, id)
+	}
+	return nil
+}
+
+func (d *data) trash(productId int64) {
+	now := time.Now()
+	icecream := d.icecreams[productId]
+	icecream.DeletedAt = &now
+	icecream.Version++
+	d.icecreams[productId] = icecream
+}
+
+// linked returns the icecreams with all their relations linked to the entry with the given id
+func (d *data) linked(e *entries, id int64) []*domain.Icecream {
+	var productIds []int64
+	for productId, ids := range e.links {
+		if ids[id] {
+			productIds = append(productIds, productId)
+		}
+	}
+	sortIds(productIds)
+
+	var icecreams []*domain.Icecream
+	for _, productId := range productIds {
+		if icecream := d.icecream(productId); icecream != nil {
+			icecreams = append(icecreams, icecream)
+		}
+	}
+	return icecreams
+}
+
+// icecream returns the icecream with all its relations or nil if it does not exist
+func (d *data) icecream(productId int64) *domain.Icecream {
+	return d.icecreamWith(productId, domain.IcecreamRelations)
+}
+
+// icecreamWith returns the icecream with the given relations, nil if it does not exist or is in the trash
+func (d *data) icecreamWith(productId int64, include []domain.Relation) *domain.Icecream {
+	icecream, ok := d.icecreams[productId]
+	if !ok || icecream.DeletedAt != nil {
+		return nil
+	}
+	return d.withRelations(productId, icecream, include)
+}
+
+func (d *data) withRelations(productId int64, icecream domain.Icecream, include []domain.Relation) *domain.Icecream {
+	if icecream.DeletedAt != nil {
+		deletedAt := *icecream.DeletedAt
+		icecream.DeletedAt = &deletedAt
+	}
+	for _, relation := range include {
+		switch relation {
+		case domain.RelationIngredients:
+			icecream.Ingredients = d.ingredientsOf(productId)
+		case domain.RelationSourcingValues:
+			icecream.SourcingValues = d.sourcingValuesOf(productId)
+		}
+	}
+	return &icecream
+}
+
+// matches reports whether the icecream meets all criteria of the filter. Like in
+// the database, partial matches ignore the case and sourcing values match exactly.
+func (d *data) matches(productId int64, icecream *domain.Icecream, filter *domain.IcecreamFilter) bool {
+
+	ingredients := d.ingredients.of(productId)
+
+	for _, ingredient := range filter.Ingredients {
+		if !anyContains(ingredients, ingredient) {
+			return false
+		}
+	}
+	for _, ingredient := range filter.WithoutIngredients {
+		if anyContains(ingredients, ingredient) {
+			return false
+		}
+	}
+
+	for _, sourcingValue := range filter.SourcingValues {
+		found := false
+		for _, description := range d.sourcingValues.of(productId) {
+			if strings.EqualFold(description, strings.TrimSpace(sourcingValue)) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, allergen := range filter.Allergens {
+		if !contains(icecream.AllergyInfo, allergen) {
+			return false
+		}
+	}
+	for _, allergen := range filter.WithoutAllergens {
+		if contains(icecream.AllergyInfo, allergen) {
+			return false
+		}
+	}
+	for _, certification := range filter.Certifications {
+		if !contains(icecream.DietaryCertifications, certification) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contains reports whether s contains the trimmed value ignoring the case
+func contains(s, value string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(strings.TrimSpace(value)))
+}
+
+func anyContains(values []string, value string) bool {
+	for _, v := range values {
+		if contains(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// icecreamCursor marks the position of an icecream within a sorted listing.
+// It is encoded like the cursor of the database, so both are interchangeable.
+type icecreamCursor struct {
+	ProductId int64  `json:"id"`
+	Name      string `json:"name"`
+	Before    bool   `json:"before,omitempty"`
+}
+
+func keyOf(icecream *domain.Icecream) icecreamCursor {
+	productId, _ := strconv.ParseInt(icecream.ProductID, 10, 64)
+	return icecreamCursor{ProductId: productId, Name: icecream.Name}
+}
+
+func (c icecreamCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeIcecreamCursor(s string) (*icecreamCursor, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var cursor icecreamCursor
+	if err = json.Unmarshal(b, &cursor); err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// compareIcecreams orders a before b by the sort fields: negative if a comes first
+func compareIcecreams(sorting []domain.SortField, a, b icecreamCursor) int {
+	for _, field := range sorting {
+
+		var c int
+		switch field.Name {
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		default:
+			switch {
+			case a.ProductId < b.ProductId:
+				c = -1
+			case a.ProductId > b.ProductId:
+				c = 1
+			}
+		}
+
+		if field.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// keysetSort verifies the requested sort fields and makes sure the listing ends
+// with the unique product id. Fields after the product id have no effect and are dropped.
+func keysetSort(fields []domain.SortField) ([]domain.SortField, error) {
+
+	var sorting []domain.SortField
+	for _, field := range fields {
+		if err := field.Verify(); err != nil {
+			return nil, err
+		}
+		sorting = append(sorting, field)
+		if field.Name == "product_id" {
+			return sorting, nil
+		}
+	}
+
+	return append(sorting, domain.SortField{Name: "product_id"}), nil
+}
+
+func reverseSort(fields []domain.SortField) []domain.SortField {
+	var reversed []domain.SortField
+	for _, field := range fields {
+		reversed = append(reversed, domain.SortField{Name: field.Name, Descending: !field.Descending})
+	}
+	return reversed
+}
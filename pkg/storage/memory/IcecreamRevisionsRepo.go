@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type IcecreamRevisionsRepo struct {
+	store *Store
+}
+
+// Revisions returns all revisions of the icecream, oldest first
+func (r *IcecreamRevisionsRepo) Revisions(productId int64) (revisions []*domain.IcecreamRevision, err error) {
+	err = r.store.read(func(d *data) error {
+		revisions = []*domain.IcecreamRevision{}
+		for _, rev := range d.revisions[productId] {
+			revision, err := convertRevision(productId, rev)
+			if err != nil {
+				return err
+			}
+			revisions = append(revisions, revision)
+		}
+		return nil
+	})
+	return revisions, err
+}
+
+func (r *IcecreamRevisionsRepo) Revision(productId int64, number int64) (revision *domain.IcecreamRevision, err error) {
+	err = r.store.read(func(d *data) error {
+		for _, rev := range d.revisions[productId] {
+			if rev.number == number {
+				revision, err = convertRevision(productId, rev)
+				return err
+			}
+		}
+		return nil
+	})
+	return revision, err
+}
+
+// AsOf returns the revision of the icecream which was valid at the given time
+func (r *IcecreamRevisionsRepo) AsOf(productId int64, at time.Time) (revision *domain.IcecreamRevision, err error) {
+	err = r.store.read(func(d *data) error {
+		revisions := d.revisions[productId]
+		for i := len(revisions) - 1; i >= 0; i-- {
+			if !revisions[i].validFrom.After(at) {
+				revision, err = convertRevision(productId, revisions[i])
+				return err
+			}
+		}
+		return nil
+	})
+	return revision, err
+}
+
+// revise adds the next revision of the icecream, nil marks it as deleted
+func (d *data) revise(productId int64, icecream *domain.Icecream, user string) error {
+
+	state, err := marshalState(icecream)
+	if err != nil {
+		return err
+	}
+
+	revisions := d.revisions[productId]
+	d.revisions[productId] = append(revisions, &revision{
+		number:    int64(len(revisions)) + 1,
+		icecream:  state,
+		validFrom: time.Now(),
+		user:      user,
+	})
+
+	return nil
+}
+
+func convertRevision(productId int64, rev *revision) (*domain.IcecreamRevision, error) {
+
+	revision := &domain.IcecreamRevision{
+		ProductID: strconv.FormatInt(productId, 10),
+		Revision:  rev.number,
+		ValidFrom: rev.validFrom,
+		User:      rev.user,
+	}
+
+	if rev.icecream != nil {
+		if err := json.Unmarshal(rev.icecream, &revision.Icecream); err != nil {
+			return nil, fmt.Errorf("faulty revision %d of icecream with productID = %d: %v", rev.number, productId, err)
+		}
+	}
+
+	return revision, nil
+}
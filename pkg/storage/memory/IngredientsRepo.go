@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"strconv"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type IngredientsRepo struct {
+	store *Store
+	actor *domain.Actor
+}
+
+// Creates returns the ids of the ingredients, the missing ones get created
+func (r *IngredientsRepo) Creates(ingredients domain.Ingredients) (ids []int64, err error) {
+	err = r.store.write(func(d *data) error {
+		for _, ingredient := range ingredients {
+			id, err := d.createIngredient(r.actor, string(ingredient))
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (r *IngredientsRepo) Read(icecreamProductId int64) (ingredients domain.Ingredients, err error) {
+	err = r.store.read(func(d *data) error {
+		ingredients = d.ingredientsOf(icecreamProductId)
+		return nil
+	})
+	return ingredients, err
+}
+
+// Reads returns the ingredients of all given icecreams keyed by their product id.
+// Icecreams without any ingredient are contained with an empty list.
+func (r *IngredientsRepo) Reads(icecreamProductIds []int64) (map[int64]domain.Ingredients, error) {
+	ingredients := make(map[int64]domain.Ingredients)
+	err := r.store.read(func(d *data) error {
+		for _, id := range icecreamProductIds {
+			ingredients[id] = d.ingredientsOf(id)
+		}
+		return nil
+	})
+	return ingredients, err
+}
+
+func (r *IngredientsRepo) ReadAll() (ingredients []*domain.IngredientEntry, err error) {
+	err = r.store.read(func(d *data) error {
+		ingredients = []*domain.IngredientEntry{}
+		for _, id := range d.ingredients.ids() {
+			ingredients = append(ingredients, d.ingredient(id))
+		}
+		return nil
+	})
+	return ingredients, err
+}
+
+func (r *IngredientsRepo) ReadById(id int64) (ingredient *domain.IngredientEntry, err error) {
+	err = r.store.read(func(d *data) error {
+		ingredient = d.ingredient(id)
+		return nil
+	})
+	return ingredient, err
+}
+
+func (r *IngredientsRepo) Create(ingredient domain.Ingredient) (created *domain.IngredientEntry, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		if _, ok := d.ingredients.id(string(ingredient)); ok {
+			return domain.ErrAlreadyExists
+		}
+
+		created = d.ingredient(d.ingredients.create(string(ingredient)))
+		return r.record(d, created.ID, domain.AuditActionCreate, nil, created)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Rename renames the ingredient with the given id. If another ingredient already
+// carries the new name, both are merged: all icecreams of the renamed ingredient
+// are linked to the existing one and the renamed ingredient gets removed.
+// Every icecream whose ingredients change this way gets a new version.
+func (r *IngredientsRepo) Rename(id int64, name domain.Ingredient) (ingredient *domain.IngredientEntry, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		before := d.ingredient(id)
+		if before == nil {
+			return nil
+		}
+
+		linked := d.linked(d.ingredients, id)
+
+		ingredient = d.ingredient(d.ingredients.rename(id, string(name)))
+		if err := r.record(d, id, domain.AuditActionUpdate, before, ingredient); err != nil {
+			return err
+		}
+
+		return r.icecreams().changed(d, linked)
+	})
+
+	return ingredient, err
+}
+
+// Delete removes the ingredient with the given id. As long as an icecream
+// references the ingredient it is only removed if force is set.
+// Every icecream losing the ingredient this way gets a new version.
+func (r *IngredientsRepo) Delete(id int64, force bool) error {
+
+	return r.store.write(func(d *data) error {
+
+		before := d.ingredient(id)
+
+		if !force && d.ingredients.references(id) > 0 {
+			return domain.ErrStillReferenced
+		}
+
+		if before == nil {
+			return domain.ErrNotFound
+		}
+
+		linked := d.linked(d.ingredients, id)
+		d.ingredients.remove(id)
+
+		if err := r.record(d, id, domain.AuditActionDelete, before, nil); err != nil {
+			return err
+		}
+
+		return r.icecreams().changed(d, linked)
+	})
+}
+
+// icecreams returns the IcecreamRepo acting on behalf of the same actor
+func (r *IngredientsRepo) icecreams() *IcecreamRepo {
+	return &IcecreamRepo{store: r.store, actor: r.actor}
+}
+
+// record writes the change of the ingredient into the audit log
+func (r *IngredientsRepo) record(d *data, id int64, action domain.AuditAction, before, after *domain.IngredientEntry) error {
+	return d.record(r.actor, domain.AuditEntityIngredient, strconv.FormatInt(id, 10), action, before, after)
+}
+
+// createIngredient returns the id of the ingredient, a missing one gets created and
+// recorded as created by the actor
+func (d *data) createIngredient(actor *domain.Actor, name string) (int64, error) {
+	if id, ok := d.ingredients.id(name); ok {
+		return id, nil
+	}
+	id := d.ingredients.create(name)
+	return id, d.record(actor, domain.AuditEntityIngredient, strconv.FormatInt(id, 10), domain.AuditActionCreate, nil, d.ingredient(id))
+}
+
+func (d *data) ingredient(id int64) *domain.IngredientEntry {
+	name, ok := d.ingredients.values[id]
+	if !ok {
+		return nil
+	}
+	return &domain.IngredientEntry{
+		ID:   id,
+		Name: domain.Ingredient(name),
+	}
+}
+
+func (d *data) ingredientsOf(productId int64) domain.Ingredients {
+	ingredients := domain.Ingredients{}
+	for _, name := range d.ingredients.of(productId) {
+		ingredients = append(ingredients, domain.Ingredient(name))
+	}
+	return ingredients
+}
@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"strconv"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type SourcingValuesRepo struct {
+	store *Store
+	actor *domain.Actor
+}
+
+// Creates returns the ids of the sourcing values, the missing ones get created
+func (r *SourcingValuesRepo) Creates(sourcingValues domain.SourcingValues) (ids []int64, err error) {
+	err = r.store.write(func(d *data) error {
+		for _, sourcingValue := range sourcingValues {
+			id, err := d.createSourcingValue(r.actor, string(sourcingValue))
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func (r *SourcingValuesRepo) Read(icecreamProductId int64) (sourcingValues domain.SourcingValues, err error) {
+	err = r.store.read(func(d *data) error {
+		sourcingValues = d.sourcingValuesOf(icecreamProductId)
+		return nil
+	})
+	return sourcingValues, err
+}
+
+// Reads returns the sourcing values of all given icecreams keyed by their product id.
+// Icecreams without any sourcing value are contained with an empty list.
+func (r *SourcingValuesRepo) Reads(icecreamProductIds []int64) (map[int64]domain.SourcingValues, error) {
+	sourcingValues := make(map[int64]domain.SourcingValues)
+	err := r.store.read(func(d *data) error {
+		for _, id := range icecreamProductIds {
+			sourcingValues[id] = d.sourcingValuesOf(id)
+		}
+		return nil
+	})
+	return sourcingValues, err
+}
+
+func (r *SourcingValuesRepo) ReadAll() (sourcingValues []*domain.SourcingValueEntry, err error) {
+	err = r.store.read(func(d *data) error {
+		sourcingValues = []*domain.SourcingValueEntry{}
+		for _, id := range d.sourcingValues.ids() {
+			sourcingValues = append(sourcingValues, d.sourcingValue(id))
+		}
+		return nil
+	})
+	return sourcingValues, err
+}
+
+func (r *SourcingValuesRepo) ReadById(id int64) (sourcingValue *domain.SourcingValueEntry, err error) {
+	err = r.store.read(func(d *data) error {
+		sourcingValue = d.sourcingValue(id)
+		return nil
+	})
+	return sourcingValue, err
+}
+
+func (r *SourcingValuesRepo) Create(sourcingValue domain.SourcingValue) (created *domain.SourcingValueEntry, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		if _, ok := d.sourcingValues.id(string(sourcingValue)); ok {
+			return domain.ErrAlreadyExists
+		}
+
+		created = d.sourcingValue(d.sourcingValues.create(string(sourcingValue)))
+		return r.record(d, created.ID, domain.AuditActionCreate, nil, created)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Rename changes the description of the sourcing value with the given id. If another
+// sourcing value already has the new description, both are merged: all icecreams of
+// the renamed sourcing value are linked to the existing one and it gets removed.
+// Every icecream whose sourcing values change this way gets a new version.
+func (r *SourcingValuesRepo) Rename(id int64, description domain.SourcingValue) (sourcingValue *domain.SourcingValueEntry, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		before := d.sourcingValue(id)
+		if before == nil {
+			return nil
+		}
+
+		linked := d.linked(d.sourcingValues, id)
+
+		sourcingValue = d.sourcingValue(d.sourcingValues.rename(id, string(description)))
+		if err := r.record(d, id, domain.AuditActionUpdate, before, sourcingValue); err != nil {
+			return err
+		}
+
+		return r.icecreams().changed(d, linked)
+	})
+
+	return sourcingValue, err
+}
+
+// Delete removes the sourcing value with the given id. As long as an icecream
+// references the sourcing value it is only removed if force is set.
+// Every icecream losing the sourcing value this way gets a new version.
+func (r *SourcingValuesRepo) Delete(id int64, force bool) error {
+
+	return r.store.write(func(d *data) error {
+
+		before := d.sourcingValue(id)
+
+		if !force && d.sourcingValues.references(id) > 0 {
+			return domain.ErrStillReferenced
+		}
+
+		if before == nil {
+			return domain.ErrNotFound
+		}
+
+		linked := d.linked(d.sourcingValues, id)
+		d.sourcingValues.remove(id)
+
+		if err := r.record(d, id, domain.AuditActionDelete, before, nil); err != nil {
+			return err
+		}
+
+		return r.icecreams().changed(d, linked)
+	})
+}
+
+func (r *SourcingValuesRepo) Deletes(icecreamProductIds []int64) error {
+	return r.store.write(func(d *data) error {
+		for _, id := range icecreamProductIds {
+			d.sourcingValues.unlinkAll(id)
+		}
+		return nil
+	})
+}
+
+// icecreams returns the IcecreamRepo acting on behalf of the same actor
+func (r *SourcingValuesRepo) icecreams() *IcecreamRepo {
+	return &IcecreamRepo{store: r.store, actor: r.actor}
+}
+
+// record writes the change of the sourcing value into the audit log
+func (r *SourcingValuesRepo) record(d *data, id int64, action domain.AuditAction, before, after *domain.SourcingValueEntry) error {
+	return d.record(r.actor, domain.AuditEntitySourcingValue, strconv.FormatInt(id, 10), action, before, after)
+}
+
+// createSourcingValue returns the id of the sourcing value, a missing one gets created and
+// recorded as created by the actor
+func (d *data) createSourcingValue(actor *domain.Actor, description string) (int64, error) {
+	if id, ok := d.sourcingValues.id(description); ok {
+		return id, nil
+	}
+	id := d.sourcingValues.create(description)
+	return id, d.record(actor, domain.AuditEntitySourcingValue, strconv.FormatInt(id, 10), domain.AuditActionCreate, nil, d.sourcingValue(id))
+}
+
+func (d *data) sourcingValue(id int64) *domain.SourcingValueEntry {
+	description, ok := d.sourcingValues.values[id]
+	if !ok {
+		return nil
+	}
+	return &domain.SourcingValueEntry{
+		ID:          id,
+		Description: domain.SourcingValue(description),
+	}
+}
+
+func (d *data) sourcingValuesOf(productId int64) domain.SourcingValues {
+	sourcingValues := domain.SourcingValues{}
+	for _, description := range d.sourcingValues.of(productId) {
+		sourcingValues = append(sourcingValues, domain.SourcingValue(description))
+	}
+	return sourcingValues
+}
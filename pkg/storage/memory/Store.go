@@ -0,0 +1,300 @@
+// Package memory keeps everything in memory, e.g. to run the api locally or
+// in tests without a database. Its repos behave like the ones in package repos.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+)
+
+// Store holds all data. Every change works on a copy of the data, which replaces
+// the data only if the change succeeds, so changes are applied entirely or not at all.
+type Store struct {
+	mu   sync.RWMutex
+	data *data
+}
+
+func NewStore() *Store {
+	return &Store{
+		data: newData(),
+	}
+}
+
+// NewRepository returns the repository of all services working on the store
+func NewRepository(store *Store) (*repos.Repository, error) {
+	return repos.NewRepositoryFunc(func(actor *domain.Actor) *repos.Repository {
+		return &repos.Repository{
+			IcecreamService:                  &IcecreamRepo{store: store, actor: actor},
+			IngredientService:                &IngredientsRepo{store: store, actor: actor},
+			SourcingValueService:             &SourcingValuesRepo{store: store, actor: actor},
+			IcecreamHasIngredientsService:    &IcecreamHasIngredientsRepo{store: store},
+			IcecreamHasSourcingValuesService: &IcecreamHasSourcingValuesRepo{store: store},
+			AuditService:                     &AuditRepo{store: store},
+			IcecreamRevisionService:          &IcecreamRevisionsRepo{store: store},
+			UserService:                      &UsersRepo{store: store},
+			APIKeyService:                    &APIKeysRepo{store: store},
+		}
+	})
+}
+
+// read runs fn on the current data, which fn must not change
+func (s *Store) read(fn func(d *data) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.data)
+}
+
+// write runs fn on a copy of the data, which becomes the current data if fn succeeds
+func (s *Store) write(fn func(d *data) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.data.clone()
+	if err := fn(d); err != nil {
+		return err
+	}
+
+	s.data = d
+	return nil
+}
+
+type data struct {
+	// icecreams are kept without their relations
+	icecreams      map[int64]domain.Icecream
+	ingredients    *entries
+	sourcingValues *entries
+
+	audit     []*domain.AuditEntry
+	revisions map[int64][]*revision
+
+	users   map[string]domain.User
+	apiKeys map[int64]domain.APIKey
+
+	auditSequence  int64
+	userSequence   int64
+	apiKeySequence int64
+}
+
+// revision keeps the icecream as json like the icecream_revisions table
+type revision struct {
+	number    int64
+	icecream  json.RawMessage
+	validFrom time.Time
+	user      string
+}
+
+func newData() *data {
+	return &data{
+		icecreams:      make(map[int64]domain.Icecream),
+		ingredients:    newEntries(),
+		sourcingValues: newEntries(),
+		revisions:      make(map[int64][]*revision),
+		users:          make(map[string]domain.User),
+		apiKeys:        make(map[int64]domain.APIKey),
+	}
+}
+
+// clone copies the data. Values behind pointers are never changed, only
+// replaced, so they are shared between the copies.
+func (d *data) clone() *data {
+
+	c := *d
+
+	c.icecreams = make(map[int64]domain.Icecream, len(d.icecreams))
+	for id, icecream := range d.icecreams {
+		c.icecreams[id] = icecream
+	}
+
+	c.ingredients = d.ingredients.clone()
+	c.sourcingValues = d.sourcingValues.clone()
+
+	c.audit = append([]*domain.AuditEntry(nil), d.audit...)
+
+	c.revisions = make(map[int64][]*revision, len(d.revisions))
+	for id, revisions := range d.revisions {
+		c.revisions[id] = append([]*revision(nil), revisions...)
+	}
+
+	c.users = make(map[string]domain.User, len(d.users))
+	for username, user := range d.users {
+		c.users[username] = user
+	}
+
+	c.apiKeys = make(map[int64]domain.APIKey, len(d.apiKeys))
+	for id, apiKey := range d.apiKeys {
+		c.apiKeys[id] = apiKey
+	}
+
+	return &c
+}
+
+// link relates the icecream to the entries with the given ids, which must exist like
+// the foreign keys of the icecream_has_* tables demand
+func (d *data) link(e *entries, productId int64, ids []int64, kind string) error {
+
+	if _, ok := d.icecreams[productId]; !ok {
+		return fmt.Errorf("could not create %s relationship: icecream with productID = %d does not exist", kind, productId)
+	}
+
+	for _, id := range ids {
+		if _, ok := e.values[id]; !ok {
+			return fmt.Errorf("could not create %s relationship: %s with id = %d does not exist", kind, kind, id)
+		}
+		e.link(productId, id)
+	}
+
+	return nil
+}
+
+// entries are the ingredients or the sourcing values: unique, trimmed values
+// with an id and the icecreams they are linked to
+type entries struct {
+	values   map[int64]string
+	links    map[int64]map[int64]bool
+	sequence int64
+}
+
+func newEntries() *entries {
+	return &entries{
+		values: make(map[int64]string),
+		links:  make(map[int64]map[int64]bool),
+	}
+}
+
+func (e *entries) clone() *entries {
+
+	c := &entries{
+		values:   make(map[int64]string, len(e.values)),
+		links:    make(map[int64]map[int64]bool, len(e.links)),
+		sequence: e.sequence,
+	}
+
+	for id, value := range e.values {
+		c.values[id] = value
+	}
+
+	for productId, ids := range e.links {
+		c.links[productId] = make(map[int64]bool, len(ids))
+		for id := range ids {
+			c.links[productId][id] = true
+		}
+	}
+
+	return c
+}
+
+func (e *entries) id(value string) (int64, bool) {
+	value = strings.TrimSpace(value)
+	for id, v := range e.values {
+		if v == value {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// create adds the value if it does not exist yet and returns its id
+func (e *entries) create(value string) int64 {
+	if id, ok := e.id(value); ok {
+		return id
+	}
+	e.sequence++
+	e.values[e.sequence] = strings.TrimSpace(value)
+	return e.sequence
+}
+
+// of returns the values linked to the icecream ordered by their id
+func (e *entries) of(productId int64) []string {
+	var ids []int64
+	for id := range e.links[productId] {
+		ids = append(ids, id)
+	}
+	sortIds(ids)
+
+	values := []string{}
+	for _, id := range ids {
+		values = append(values, e.values[id])
+	}
+	return values
+}
+
+// ids returns the ids of all values in order
+func (e *entries) ids() []int64 {
+	var ids []int64
+	for id := range e.values {
+		ids = append(ids, id)
+	}
+	sortIds(ids)
+	return ids
+}
+
+func (e *entries) link(productId int64, id int64) {
+	if e.links[productId] == nil {
+		e.links[productId] = make(map[int64]bool)
+	}
+	e.links[productId][id] = true
+}
+
+// unlink removes the link between the icecream and the value, it reports whether there was one
+func (e *entries) unlink(productId int64, value string) bool {
+	id, ok := e.id(value)
+	if !ok || !e.links[productId][id] {
+		return false
+	}
+	delete(e.links[productId], id)
+	return true
+}
+
+func (e *entries) unlinkAll(productId int64) {
+	delete(e.links, productId)
+}
+
+// references counts the icecreams linked to the value
+func (e *entries) references(id int64) int {
+	var references int
+	for _, ids := range e.links {
+		if ids[id] {
+			references++
+		}
+	}
+	return references
+}
+
+// remove deletes the value together with all its links
+func (e *entries) remove(id int64) {
+	delete(e.values, id)
+	for _, ids := range e.links {
+		delete(ids, id)
+	}
+}
+
+// rename gives the value with the id a new value. If another value is equal to the
+// new one already, both get merged and the id of the remaining one is returned.
+func (e *entries) rename(id int64, value string) int64 {
+
+	existing, ok := e.id(value)
+	if !ok || existing == id {
+		e.values[id] = strings.TrimSpace(value)
+		return id
+	}
+
+	for _, ids := range e.links {
+		if ids[id] {
+			ids[existing] = true
+		}
+	}
+	e.remove(id)
+
+	return existing
+}
+
+func sortIds(ids []int64) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
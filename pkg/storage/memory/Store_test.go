@@ -0,0 +1,20 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/fraenky8/zlr-ca/pkg/storage/memory"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos/repotest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_withMemoryStore(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) *repos.Repository {
+
+		repo, err := memory.NewRepository(memory.NewStore())
+		require.NoError(t, err)
+
+		return repo
+	})
+}
@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+type UsersRepo struct {
+	store *Store
+}
+
+func (r *UsersRepo) Create(username string, passwordHash []byte, role domain.Role) (created *domain.User, err error) {
+
+	err = r.store.write(func(d *data) error {
+
+		if _, ok := d.users[username]; ok {
+			return domain.ErrAlreadyExists
+		}
+
+		d.userSequence++
+		d.users[username] = domain.User{
+			ID:           d.userSequence,
+			Username:     username,
+			PasswordHash: append([]byte(nil), passwordHash...),
+			Role:         role,
+		}
+
+		created = d.user(username)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (r *UsersRepo) Read(username string) (user *domain.User, err error) {
+	err = r.store.read(func(d *data) error {
+		user = d.user(username)
+		return nil
+	})
+	return user, err
+}
+
+func (r *UsersRepo) ReadAll() (users []*domain.User, err error) {
+	err = r.store.read(func(d *data) error {
+		users = []*domain.User{}
+		for username := range d.users {
+			users = append(users, d.user(username))
+		}
+		return nil
+	})
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, err
+}
+
+// SetPassword changes the password of the user and lifts a lock
+func (r *UsersRepo) SetPassword(username string, passwordHash []byte) error {
+	return r.update(username, func(user *domain.User) {
+		user.PasswordHash = append([]byte(nil), passwordHash...)
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+	})
+}
+
+func (r *UsersRepo) SetDisabled(username string, disabled bool) error {
+	return r.update(username, func(user *domain.User) {
+		user.Disabled = disabled
+	})
+}
+
+func (r *UsersRepo) SetRole(username string, role domain.Role) error {
+	return r.update(username, func(user *domain.User) {
+		user.Role = role
+	})
+}
+
+// LoginFailed counts a failed login of the user. With the maxFailures-th failure
+// in a row the user gets locked for the lockout duration and the count starts over.
+func (r *UsersRepo) LoginFailed(username string, maxFailures int, lockout time.Duration) error {
+	return r.update(username, func(user *domain.User) {
+		if user.FailedLogins+1 >= maxFailures {
+			lockedUntil := time.Now().Add(lockout)
+			user.LockedUntil = &lockedUntil
+			user.FailedLogins = 0
+			return
+		}
+		user.FailedLogins++
+	})
+}
+
+func (r *UsersRepo) LoginSucceeded(username string) error {
+	return r.update(username, func(user *domain.User) {
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+	})
+}
+
+func (r *UsersRepo) update(username string, change func(user *domain.User)) error {
+	return r.store.write(func(d *data) error {
+
+		user, ok := d.users[username]
+		if !ok {
+			return fmt.Errorf("user %s does not exist", username)
+		}
+
+		change(&user)
+		d.users[username] = user
+
+		return nil
+	})
+}
+
+// user returns a copy of the user, so the stored one cannot be changed by accident
+func (d *data) user(username string) *domain.User {
+	user, ok := d.users[username]
+	if !ok {
+		return nil
+	}
+	user.PasswordHash = append([]byte(nil), user.PasswordHash...)
+	if user.LockedUntil != nil {
+		lockedUntil := *user.LockedUntil
+		user.LockedUntil = &lockedUntil
+	}
+	return &user
+}
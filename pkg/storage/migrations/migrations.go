@@ -0,0 +1,282 @@
+// Package migrations versions the schema of the databases. The migrations are
+// compiled into the binaries and the applied ones are tracked in the table
+// schema_migrations, so a schema change never needs the data to be wiped.
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+)
+
+// Migration changes the schema from the previous version to its own (Up) and back
+// again (Down). A released migration is never changed, every change of the schema
+// is a new migration with the next version.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status tells whether and when a migration has been applied. Name is all
+// there is of a migration applied by a newer version of the server.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// source are the migrations of a database and the statements running first within
+// the transaction of every migration, which take care of the schema_migrations table
+type source struct {
+	migrations []Migration
+	begin      string
+}
+
+var sources = map[string]source{
+	"postgres": {migrations: postgresMigrations, begin: postgresBegin},
+	"sqlite":   {migrations: sqliteMigrations, begin: sqliteBegin},
+}
+
+// Migrator applies and reverts the migrations of the database
+type Migrator struct {
+	db     storage.Database
+	source source
+}
+
+func NewMigrator(db storage.Database) (*Migrator, error) {
+
+	source, ok := sources[db.Dialect().Name()]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for database %s", db.Dialect().Name())
+	}
+
+	migrations := append([]Migration(nil), source.migrations...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	source.migrations = migrations
+
+	return &Migrator{db: db, source: source}, nil
+}
+
+// Migrations returns all known migrations ordered by version
+func (m *Migrator) Migrations() []Migration {
+	return m.source.migrations
+}
+
+// Up applies all pending migrations ordered by version and returns them. Every
+// migration runs within its own transaction, so a failing one is not applied at
+// all, while the ones before stay applied.
+func (m *Migrator) Up() (applied []Migration, err error) {
+
+	for _, migration := range m.source.migrations {
+
+		var done bool
+		err = m.transaction(func(tx storage.Database, versions map[int64]*dtos.SchemaMigration) error {
+
+			// another server may have applied it meanwhile
+			if versions[migration.Version] != nil {
+				return nil
+			}
+
+			if _, err := tx.Executor().Exec(migration.Up); err != nil {
+				return fmt.Errorf("could not apply migration %d %s: %v", migration.Version, migration.Name, err)
+			}
+
+			done = true
+			return m.record(tx, migration)
+		})
+
+		if err != nil {
+			return applied, err
+		}
+
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// Down reverts the latest n applied migrations, latest first, and returns them.
+// Every migration is reverted within its own transaction.
+func (m *Migrator) Down(n int) (reverted []Migration, err error) {
+
+	for i := 0; i < n; i++ {
+
+		var migration *Migration
+		err = m.transaction(func(tx storage.Database, versions map[int64]*dtos.SchemaMigration) error {
+
+			latest := latestVersion(versions)
+			if latest == 0 {
+				return nil
+			}
+
+			if migration = m.migration(latest); migration == nil {
+				return fmt.Errorf("cannot revert migration %d %s, it is unknown to this version", latest, versions[latest].Name)
+			}
+
+			if _, err := tx.Executor().Exec(migration.Down); err != nil {
+				return fmt.Errorf("could not revert migration %d %s: %v", migration.Version, migration.Name, err)
+			}
+
+			_, err := tx.Executor().Exec(fmt.Sprintf(`
+				DELETE FROM %s.schema_migrations WHERE version = $1
+			`, tx.Config().Schema), migration.Version)
+
+			if err != nil {
+				return fmt.Errorf("could not revert migration %d %s: %v", migration.Version, migration.Name, err)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return reverted, err
+		}
+
+		// nothing left to revert
+		if migration == nil {
+			return reverted, nil
+		}
+
+		reverted = append(reverted, *migration)
+	}
+
+	return reverted, nil
+}
+
+// Status returns all known migrations and the applied unknown ones ordered by version
+func (m *Migrator) Status() (statuses []*Status, err error) {
+
+	err = m.transaction(func(tx storage.Database, versions map[int64]*dtos.SchemaMigration) error {
+
+		for _, migration := range m.source.migrations {
+			status := &Status{Migration: migration}
+			if applied := versions[migration.Version]; applied != nil {
+				status.AppliedAt = &applied.AppliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		for _, applied := range versions {
+			if m.migration(applied.Version) == nil {
+				applied := applied
+				statuses = append(statuses, &Status{
+					Migration: Migration{Version: applied.Version, Name: applied.Name},
+					AppliedAt: &applied.AppliedAt,
+				})
+			}
+		}
+
+		return nil
+	})
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, err
+}
+
+// Version returns the latest applied version, 0 if no migration has been applied
+func (m *Migrator) Version() (version int64, err error) {
+	err = m.transaction(func(tx storage.Database, versions map[int64]*dtos.SchemaMigration) error {
+		version = latestVersion(versions)
+		return nil
+	})
+	return version, err
+}
+
+// Force records the migrations up to the version as applied and all later ones as
+// not applied, without running any of them. It adopts a database whose schema has
+// been set up or fixed by hand, version 0 forgets all migrations.
+func (m *Migrator) Force(version int64) error {
+
+	if version != 0 && m.migration(version) == nil {
+		return fmt.Errorf("unknown migration %d", version)
+	}
+
+	return m.transaction(func(tx storage.Database, versions map[int64]*dtos.SchemaMigration) error {
+
+		_, err := tx.Executor().Exec(fmt.Sprintf(`
+			DELETE FROM %s.schema_migrations
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not force version %d: %v", version, err)
+		}
+
+		for _, migration := range m.source.migrations {
+			if migration.Version > version {
+				break
+			}
+			if err = m.record(tx, migration); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// transaction runs fn within a transaction, which begins with the statements of the
+// source, and passes the applied migrations keyed by their version
+func (m *Migrator) transaction(fn func(tx storage.Database, versions map[int64]*dtos.SchemaMigration) error) error {
+	return m.db.Transaction(func(tx storage.Database) error {
+
+		if _, err := tx.Executor().Exec(fmt.Sprintf(m.source.begin, tx.Config().Schema)); err != nil {
+			return fmt.Errorf("could not prepare migrations: %v", err)
+		}
+
+		var applied []*dtos.SchemaMigration
+		err := tx.Executor().Select(&applied, fmt.Sprintf(`
+			SELECT version, name, applied_at
+			FROM %s.schema_migrations
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not read applied migrations: %v", err)
+		}
+
+		versions := make(map[int64]*dtos.SchemaMigration, len(applied))
+		for _, migration := range applied {
+			versions[migration.Version] = migration
+		}
+
+		return fn(tx, versions)
+	})
+}
+
+// record marks the migration as applied
+func (m *Migrator) record(tx storage.Database, migration Migration) error {
+
+	_, err := tx.Executor().Exec(fmt.Sprintf(`
+		INSERT INTO %s.schema_migrations (version, name, applied_at) VALUES ($1, $2, %s)
+	`, tx.Config().Schema, tx.Dialect().Now()), migration.Version, migration.Name)
+
+	if err != nil {
+		return fmt.Errorf("could not record migration %d %s: %v", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) migration(version int64) *Migration {
+	for i := range m.source.migrations {
+		if m.source.migrations[i].Version == version {
+			return &m.source.migrations[i]
+		}
+	}
+	return nil
+}
+
+func latestVersion(versions map[int64]*dtos.SchemaMigration) (latest int64) {
+	for version := range versions {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,238 @@
+package migrations_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/migrations"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator_Up_withEmptyDatabase_appliesAllMigrations(t *testing.T) {
+
+	// given
+	db, migrator := newMigrator(t)
+	defer db.Close()
+
+	// when
+	applied, err := migrator.Up()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(applied))
+	assert.Equal(t, int64(3), version(t, migrator))
+	assert.True(t, tableExists(t, db, "icecream"))
+	assert.True(t, tableExists(t, db, "audit_log"))
+	assert.True(t, tableExists(t, db, "api_keys"))
+
+	again, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Empty(t, again)
+}
+
+func TestMigrator_Down_withAppliedMigrations_revertsLatestFirst(t *testing.T) {
+
+	// given
+	db, migrator := newMigrator(t)
+	defer db.Close()
+	_, err := migrator.Up()
+	require.NoError(t, err)
+
+	// when
+	reverted, err := migrator.Down(2)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, versions(reverted))
+	assert.Equal(t, int64(1), version(t, migrator))
+	assert.True(t, tableExists(t, db, "icecream"))
+	assert.False(t, tableExists(t, db, "audit_log"))
+	assert.False(t, tableExists(t, db, "users"))
+
+	rest, err := migrator.Down(5)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, versions(rest))
+	assert.Equal(t, int64(0), version(t, migrator))
+	assert.False(t, tableExists(t, db, "icecream"))
+}
+
+func TestMigrator_Status_withPartlyAppliedMigrations_returnsAllMigrations(t *testing.T) {
+
+	// given
+	db, migrator := newMigrator(t)
+	defer db.Close()
+	_, err := migrator.Up()
+	require.NoError(t, err)
+	_, err = migrator.Down(1)
+	require.NoError(t, err)
+
+	// when
+	statuses, err := migrator.Status()
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 3) {
+		assert.Equal(t, "catalogue", statuses[0].Name)
+		assert.NotNil(t, statuses[0].AppliedAt)
+		assert.NotNil(t, statuses[1].AppliedAt)
+		assert.Equal(t, "access", statuses[2].Name)
+		assert.Nil(t, statuses[2].AppliedAt)
+	}
+}
+
+func TestMigrator_Force_withVersion_recordsMigrationsWithoutRunningThem(t *testing.T) {
+
+	// given
+	db, migrator := newMigrator(t)
+	defer db.Close()
+
+	// when
+	err := migrator.Force(2)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), version(t, migrator))
+	assert.False(t, tableExists(t, db, "icecream"))
+
+	applied, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3}, versions(applied))
+
+	assert.Error(t, migrator.Force(7))
+	assert.NoError(t, migrator.Force(0))
+	assert.Equal(t, int64(0), version(t, migrator))
+}
+
+func TestMigrator_Up_withSQLiteDatabaseFromBeforeMigrations_adoptsIt(t *testing.T) {
+
+	// given
+	db, migrator := newMigrator(t)
+	defer db.Close()
+	execFile(t, db, "testdata/baseline.sqlite.sql")
+
+	// when
+	applied, err := migrator.Up()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, versions(applied))
+	assertAdopted(t, db)
+}
+
+func TestMigrator_Up_withPostgresBaseline_adoptsIt(t *testing.T) {
+
+	dsn := os.Getenv(postgresDSN)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSN)
+	}
+
+	// given
+	db, err := storage.NewPostgres(&storage.Config{DSN: dsn, Schema: "zlr_ca"})
+	require.NoError(t, err)
+	defer db.Close()
+	execFile(t, db, "testdata/baseline.postgres.sql")
+
+	migrator, err := migrations.NewMigrator(db)
+	require.NoError(t, err)
+
+	// when
+	applied, err := migrator.Up()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9}, versions(applied))
+	assertAdopted(t, db)
+
+	results, err := repository(t, db).IcecreamService.Search("vanilla", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	reverted, err := migrator.Down(9)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 9)
+
+	_, err = migrator.Up()
+	assert.NoError(t, err)
+}
+
+// assertAdopted checks that the data of the database from before the migrations
+// is kept and works with the repos, which need the columns added since
+func assertAdopted(t *testing.T, db storage.Database) {
+
+	repo := repository(t, db)
+
+	icecreams, err := repo.IcecreamService.Reads([]int64{1}, domain.IcecreamRelations...)
+	require.NoError(t, err)
+	if assert.Len(t, icecreams, 1) {
+		assert.Equal(t, "Vanilla Dream", icecreams[0].Name)
+		assert.Equal(t, domain.Ingredients{"milk"}, icecreams[0].Ingredients)
+		assert.Equal(t, int64(1), icecreams[0].Version)
+	}
+
+	err = repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Story:     domain.OptionalString{Set: true, Valid: true, Value: "Made with milk"},
+		Version:   1,
+	}})
+	assert.NoError(t, err)
+
+	icecreams, err = repo.IcecreamService.Reads([]int64{1})
+	require.NoError(t, err)
+	if assert.Len(t, icecreams, 1) {
+		assert.Equal(t, int64(2), icecreams[0].Version)
+	}
+}
+
+func newMigrator(t *testing.T) (storage.Database, *migrations.Migrator) {
+	db, err := storage.NewSQLite(&storage.Config{Driver: "sqlite", DSN: ":memory:"})
+	if err == storage.ErrNoSQLite {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	migrator, err := migrations.NewMigrator(db)
+	require.NoError(t, err)
+	return db, migrator
+}
+
+// postgresDSN names the environment variable with the dsn of a postgres database to
+// run the tests against. The tests drop and recreate the schema zlr_ca in it!
+const postgresDSN = "ZLR_TEST_POSTGRES_DSN"
+
+func execFile(t *testing.T, db storage.Database, file string) {
+	b, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	_, err = db.DB().Exec(string(b))
+	require.NoError(t, err)
+}
+
+func repository(t *testing.T, db storage.Database) *repos.Repository {
+	repo, err := repos.NewRepository(db)
+	require.NoError(t, err)
+	return repo.As(&domain.Actor{User: "frank"})
+}
+
+func version(t *testing.T, migrator *migrations.Migrator) int64 {
+	version, err := migrator.Version()
+	require.NoError(t, err)
+	return version
+}
+
+func versions(applied []migrations.Migration) []int64 {
+	versions := []int64{}
+	for _, migration := range applied {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func tableExists(t *testing.T, db storage.Database, table string) bool {
+	var tables int
+	err := db.DB().Get(&tables, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table)
+	require.NoError(t, err)
+	return tables == 1
+}
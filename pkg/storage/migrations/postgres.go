@@ -0,0 +1,270 @@
+package migrations
+
+// postgresBegin takes an advisory lock, which keeps servers starting at the same time
+// from migrating at once, and sets the search path to the schema, so the migrations
+// create everything in the configured schema without naming it
+const postgresBegin = `
+SELECT pg_advisory_xact_lock(7023518);
+
+CREATE SCHEMA IF NOT EXISTS %[1]s;
+
+create table if not exists %[1]s.schema_migrations
+(
+  version    bigint       not null
+    constraint schema_migrations_pkey
+    primary key,
+  name       varchar(200) not null,
+  applied_at timestamptz  not null
+);
+
+SET LOCAL search_path TO %[1]s;
+`
+
+// postgresMigrations start with the baseline, the schema of build/db/database.sql before there
+// were migrations, and then follow the changes of the schema since. The baseline and the later
+// migrations skip what already exists, so "up" adopts a database set up by any former
+// database.sql and adds only what it misses.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: `
+create table if not exists icecream
+(
+  product_id             integer      not null
+    constraint icecream_pkey
+    primary key,
+  name                   varchar(200) not null,
+  description            varchar(200),
+  story                  text,
+  image_open             varchar(200),
+  image_closed           varchar(200),
+  allergy_info           varchar(200),
+  dietary_certifications varchar(50)
+);
+
+create unique index if not exists icecream_product_id_uindex
+  on icecream (product_id);
+
+create table if not exists ingredients
+(
+  id   serial      not null,
+  name varchar(50) not null,
+  constraint ingredients_id_name_pk
+  primary key (id, name)
+);
+
+create unique index if not exists ingredients_id_uindex
+  on ingredients (id);
+
+create unique index if not exists ingredients_name_uindex
+  on ingredients (name);
+
+create table if not exists sourcing_values
+(
+  id          serial       not null,
+  description varchar(200) not null,
+  constraint sourcing_values_id_description_pk
+  primary key (id, description)
+);
+
+create unique index if not exists sourcing_values_id_uindex
+  on sourcing_values (id);
+
+create unique index if not exists sourcing_values_description_uindex
+  on sourcing_values (description);
+
+create table if not exists icecream_has_ingredients
+(
+  icecream_product_id integer not null
+    constraint icecream_has_ingredients_icecream_product_id_fk
+    references icecream (product_id)
+    on delete cascade,
+  ingredients_id      integer not null
+    constraint icecream_has_ingredients_ingredients_id_fk
+    references ingredients (id)
+    on delete cascade,
+  constraint icecream_has_ingredients_icecream_product_id_ingredients_id_pk
+  primary key (icecream_product_id, ingredients_id)
+);
+
+create table if not exists icecream_has_sourcing_values
+(
+  icecream_product_id integer not null
+    constraint icecream_has_sourcing_values_icecream_product_id_fk
+    references icecream (product_id)
+    on delete cascade,
+  sourcing_values_id  integer not null
+    constraint icecream_has_sourcing_values_sourcing_values_id_fk
+    references sourcing_values (id)
+    on delete cascade,
+  constraint icecream_has_sourcing_values_icecream_id_sourcing_values_id_pk
+  primary key (icecream_product_id, sourcing_values_id)
+);
+`,
+		Down: `
+drop table icecream_has_sourcing_values;
+drop table icecream_has_ingredients;
+drop table sourcing_values;
+drop table ingredients;
+drop table icecream;
+`,
+	},
+	{
+		Version: 2,
+		Name:    "search",
+		Up: `
+alter table icecream
+  add column if not exists search_vector tsvector generated always as (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(story, '')), 'C')
+  ) stored;
+
+create index if not exists icecream_search_vector_index
+  on icecream using gin (search_vector);
+`,
+		Down: `
+drop index icecream_search_vector_index;
+alter table icecream drop column search_vector;
+`,
+	},
+	{
+		Version: 3,
+		Name:    "versions",
+		Up: `
+alter table icecream
+  add column if not exists version    integer     not null default 1,
+  add column if not exists updated_at timestamptz not null default now();
+`,
+		Down: `
+alter table icecream
+  drop column updated_at,
+  drop column version;
+`,
+	},
+	{
+		Version: 4,
+		Name:    "trash",
+		Up: `
+alter table icecream
+  add column if not exists deleted_at timestamptz;
+`,
+		Down: `
+alter table icecream drop column deleted_at;
+`,
+	},
+	{
+		Version: 5,
+		Name:    "audit",
+		Up: `
+create table if not exists audit_log
+(
+  id         bigserial    not null
+    constraint audit_log_pkey
+    primary key,
+  entity     varchar(50)  not null,
+  entity_id  varchar(50)  not null,
+  action     varchar(20)  not null,
+  username   varchar(100) not null,
+  request_id varchar(100),
+  before     jsonb,
+  after      jsonb,
+  created_at timestamptz  not null default now()
+);
+
+create index if not exists audit_log_entity_index
+  on audit_log (entity, entity_id, id);
+
+create index if not exists audit_log_username_index
+  on audit_log (username, created_at);
+`,
+		Down: `
+drop table audit_log;
+`,
+	},
+	{
+		Version: 6,
+		Name:    "revisions",
+		Up: `
+create table if not exists icecream_revisions
+(
+  icecream_product_id integer      not null,
+  revision            integer      not null,
+  icecream            jsonb,
+  valid_from          timestamptz  not null default now(),
+  username            varchar(100) not null,
+  constraint icecream_revisions_icecream_product_id_revision_pk
+  primary key (icecream_product_id, revision)
+);
+`,
+		Down: `
+drop table icecream_revisions;
+`,
+	},
+	{
+		Version: 7,
+		Name:    "users",
+		Up: `
+create table if not exists users
+(
+  id            serial       not null
+    constraint users_pkey
+    primary key,
+  username      varchar(100) not null,
+  password_hash varchar(100) not null,
+  disabled      boolean      not null default false,
+  failed_logins integer      not null default 0,
+  locked_until  timestamptz,
+  created_at    timestamptz  not null default now()
+);
+
+create unique index if not exists users_username_uindex
+  on users (username);
+`,
+		Down: `
+drop table users;
+`,
+	},
+	{
+		Version: 8,
+		Name:    "api_keys",
+		Up: `
+create table if not exists api_keys
+(
+  id         serial       not null
+    constraint api_keys_pkey
+    primary key,
+  name       varchar(100) not null,
+  prefix     varchar(20)  not null,
+  key_hash   varchar(64)  not null,
+  created_by varchar(100) not null,
+  created_at timestamptz  not null default now()
+);
+
+create unique index if not exists api_keys_name_uindex
+  on api_keys (name);
+
+create unique index if not exists api_keys_key_hash_uindex
+  on api_keys (key_hash);
+`,
+		Down: `
+drop table api_keys;
+`,
+	},
+	{
+		Version: 9,
+		Name:    "roles",
+		Up: `
+alter table users
+  add column if not exists role varchar(20) not null default 'viewer';
+
+alter table api_keys
+  add column if not exists role varchar(20) not null default 'viewer';
+`,
+		Down: `
+alter table api_keys drop column role;
+alter table users drop column role;
+`,
+	},
+}
@@ -0,0 +1,143 @@
+package migrations
+
+// sqliteBegin creates the schema_migrations table, sqlite locks the whole database
+// for a transaction anyway
+const sqliteBegin = `
+create table if not exists %[1]s.schema_migrations
+(
+  version    integer      not null primary key,
+  name       varchar(200) not null,
+  applied_at timestamp    not null
+);
+`
+
+// sqliteMigrations 1 to 3 are the schema sqlite databases got on connecting before there
+// were migrations, they skip everything which already exists, so "up" adopts such a
+// database. Sqlite has no search vector and keeps times and json as text, see
+// storage.SQLiteDialect.
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "catalogue",
+		Up: `
+
+create table if not exists icecream
+(
+  product_id             integer      not null primary key,
+  name                   varchar(200) not null,
+  description            varchar(200),
+  story                  text,
+  image_open             varchar(200),
+  image_closed           varchar(200),
+  allergy_info           varchar(200),
+  dietary_certifications varchar(50),
+  version                integer      not null default 1,
+  updated_at             timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  deleted_at             timestamp
+);
+
+create table if not exists ingredients
+(
+  id   integer     not null primary key autoincrement,
+  name varchar(50) not null unique
+);
+
+create table if not exists sourcing_values
+(
+  id          integer      not null primary key autoincrement,
+  description varchar(200) not null unique
+);
+
+create table if not exists icecream_has_ingredients
+(
+  icecream_product_id integer not null references icecream (product_id) on delete cascade,
+  ingredients_id      integer not null references ingredients (id) on delete cascade,
+  primary key (icecream_product_id, ingredients_id)
+);
+
+create table if not exists icecream_has_sourcing_values
+(
+  icecream_product_id integer not null references icecream (product_id) on delete cascade,
+  sourcing_values_id  integer not null references sourcing_values (id) on delete cascade,
+  primary key (icecream_product_id, sourcing_values_id)
+);
+`,
+		Down: `
+drop table icecream_has_sourcing_values;
+drop table icecream_has_ingredients;
+drop table sourcing_values;
+drop table ingredients;
+drop table icecream;
+`,
+	},
+	{
+		Version: 2,
+		Name:    "history",
+		Up: `
+create table if not exists audit_log
+(
+  id         integer      not null primary key autoincrement,
+  entity     varchar(50)  not null,
+  entity_id  varchar(50)  not null,
+  action     varchar(20)  not null,
+  username   varchar(100) not null,
+  request_id varchar(100),
+  before     text,
+  after      text,
+  created_at timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index if not exists audit_log_entity_index
+  on audit_log (entity, entity_id, id);
+
+create index if not exists audit_log_username_index
+  on audit_log (username, created_at);
+
+create table if not exists icecream_revisions
+(
+  icecream_product_id integer      not null,
+  revision            integer      not null,
+  icecream            text,
+  valid_from          timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  username            varchar(100) not null,
+  primary key (icecream_product_id, revision)
+);
+`,
+		Down: `
+drop table icecream_revisions;
+drop table audit_log;
+`,
+	},
+	{
+		Version: 3,
+		Name:    "access",
+		Up: `
+create table if not exists users
+(
+  id            integer      not null primary key autoincrement,
+  username      varchar(100) not null unique,
+  password_hash varchar(100) not null,
+  role          varchar(20)  not null default 'viewer',
+  disabled      boolean      not null default false,
+  failed_logins integer      not null default 0,
+  locked_until  timestamp,
+  created_at    timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create table if not exists api_keys
+(
+  id         integer      not null primary key autoincrement,
+  name       varchar(100) not null unique,
+  prefix     varchar(20)  not null,
+  role       varchar(20)  not null default 'viewer',
+  key_hash   varchar(64)  not null unique,
+  created_by varchar(100) not null,
+  created_at timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+`,
+		Down: `
+drop table api_keys;
+drop table users;
+`,
+	},
+}
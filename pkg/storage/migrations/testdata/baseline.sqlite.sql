@@ -0,0 +1,97 @@
+-- the schema sqlite databases got on connecting before there were migrations, with some data
+create table if not exists icecream
+(
+  product_id             integer      not null primary key,
+  name                   varchar(200) not null,
+  description            varchar(200),
+  story                  text,
+  image_open             varchar(200),
+  image_closed           varchar(200),
+  allergy_info           varchar(200),
+  dietary_certifications varchar(50),
+  version                integer      not null default 1,
+  updated_at             timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  deleted_at             timestamp
+);
+
+create table if not exists ingredients
+(
+  id   integer     not null primary key autoincrement,
+  name varchar(50) not null unique
+);
+
+create table if not exists sourcing_values
+(
+  id          integer      not null primary key autoincrement,
+  description varchar(200) not null unique
+);
+
+create table if not exists icecream_has_ingredients
+(
+  icecream_product_id integer not null references icecream (product_id) on delete cascade,
+  ingredients_id      integer not null references ingredients (id) on delete cascade,
+  primary key (icecream_product_id, ingredients_id)
+);
+
+create table if not exists icecream_has_sourcing_values
+(
+  icecream_product_id integer not null references icecream (product_id) on delete cascade,
+  sourcing_values_id  integer not null references sourcing_values (id) on delete cascade,
+  primary key (icecream_product_id, sourcing_values_id)
+);
+
+create table if not exists audit_log
+(
+  id         integer      not null primary key autoincrement,
+  entity     varchar(50)  not null,
+  entity_id  varchar(50)  not null,
+  action     varchar(20)  not null,
+  username   varchar(100) not null,
+  request_id varchar(100),
+  before     text,
+  after      text,
+  created_at timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index if not exists audit_log_entity_index
+  on audit_log (entity, entity_id, id);
+
+create index if not exists audit_log_username_index
+  on audit_log (username, created_at);
+
+create table if not exists icecream_revisions
+(
+  icecream_product_id integer      not null,
+  revision            integer      not null,
+  icecream            text,
+  valid_from          timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  username            varchar(100) not null,
+  primary key (icecream_product_id, revision)
+);
+
+create table if not exists users
+(
+  id            integer      not null primary key autoincrement,
+  username      varchar(100) not null unique,
+  password_hash varchar(100) not null,
+  role          varchar(20)  not null default 'viewer',
+  disabled      boolean      not null default false,
+  failed_logins integer      not null default 0,
+  locked_until  timestamp,
+  created_at    timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create table if not exists api_keys
+(
+  id         integer      not null primary key autoincrement,
+  name       varchar(100) not null unique,
+  prefix     varchar(20)  not null,
+  role       varchar(20)  not null default 'viewer',
+  key_hash   varchar(64)  not null unique,
+  created_by varchar(100) not null,
+  created_at timestamp    not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+insert into icecream (product_id, name, description) values (1, 'Vanilla Dream', 'Vanilla Ice Cream');
+insert into ingredients (name) values ('milk');
+insert into icecream_has_ingredients (icecream_product_id, ingredients_id) values (1, 1);
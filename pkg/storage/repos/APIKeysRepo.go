@@ -0,0 +1,123 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+)
+
+type APIKeysRepo struct {
+	db storage.Database
+}
+
+func NewAPIKeysRepo(db storage.Database) *APIKeysRepo {
+	return &APIKeysRepo{
+		db: db,
+	}
+}
+
+func (r *APIKeysRepo) Create(apiKey *domain.APIKey) (*domain.APIKey, error) {
+
+	var created dtos.APIKey
+	err := r.db.Executor().Get(&created, fmt.Sprintf(`
+		INSERT INTO %s.api_keys (name, prefix, role, key_hash, created_by) VALUES (TRIM($1), $2, $3, $4, $5)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, name, prefix, role, key_hash, created_by, created_at
+	`, r.db.Config().Schema), apiKey.Name, apiKey.Prefix, apiKey.Role, apiKey.Hash, apiKey.CreatedBy)
+
+	// nothing returned means the conflict clause kicked in
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create api key: %v", err)
+	}
+
+	return r.convert(&created), nil
+}
+
+func (r *APIKeysRepo) ReadAll() ([]*domain.APIKey, error) {
+
+	var apiKeys []*dtos.APIKey
+	err := r.db.Executor().Select(&apiKeys, fmt.Sprintf(`
+		SELECT id, name, prefix, role, key_hash, created_by, created_at
+		FROM %s.api_keys
+		ORDER BY id
+	`, r.db.Config().Schema))
+
+	if err != nil {
+		return nil, err
+	}
+
+	all := []*domain.APIKey{}
+	for _, apiKey := range apiKeys {
+		all = append(all, r.convert(apiKey))
+	}
+
+	return all, nil
+}
+
+func (r *APIKeysRepo) ReadById(id int64) (*domain.APIKey, error) {
+	return r.read(`id = $1`, id)
+}
+
+func (r *APIKeysRepo) ReadByHash(hash string) (*domain.APIKey, error) {
+	return r.read(`key_hash = $1`, hash)
+}
+
+func (r *APIKeysRepo) Delete(id int64) error {
+
+	result, err := r.db.Executor().Exec(fmt.Sprintf(`
+		DELETE FROM %s.api_keys
+		WHERE id = $1
+	`, r.db.Config().Schema), id)
+
+	if err != nil {
+		return fmt.Errorf("could not delete api key with id = %d: %v", id, err)
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not delete api key with id = %d: %v", id, err)
+	}
+
+	if affectedRows == 0 {
+		return fmt.Errorf("api key with id = %d does not exist", id)
+	}
+
+	return nil
+}
+
+func (r *APIKeysRepo) read(where string, arg interface{}) (*domain.APIKey, error) {
+
+	var apiKey dtos.APIKey
+	err := r.db.Executor().Get(&apiKey, fmt.Sprintf(`
+		SELECT id, name, prefix, role, key_hash, created_by, created_at
+		FROM %s.api_keys
+		WHERE %s
+	`, r.db.Config().Schema, where), arg)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convert(&apiKey), nil
+}
+
+func (r *APIKeysRepo) convert(apiKey *dtos.APIKey) *domain.APIKey {
+	return &domain.APIKey{
+		ID:        apiKey.Id,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Role:      domain.Role(apiKey.Role),
+		Hash:      apiKey.KeyHash,
+		CreatedBy: apiKey.CreatedBy,
+		CreatedAt: apiKey.CreatedAt,
+	}
+}
@@ -0,0 +1,168 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+)
+
+type AuditRepo struct {
+	db storage.Database
+}
+
+func NewAuditRepo(db storage.Database) *AuditRepo {
+	return &AuditRepo{
+		db: db,
+	}
+}
+
+func (r *AuditRepo) Record(entry *domain.AuditEntry) error {
+
+	before := sql.NullString{String: string(entry.Before), Valid: len(entry.Before) > 0}
+	after := sql.NullString{String: string(entry.After), Valid: len(entry.After) > 0}
+
+	var created dtos.AuditEntry
+	err := r.db.Executor().Get(&created, fmt.Sprintf(`
+		INSERT INTO %s.audit_log
+			(entity, entity_id, action, username, request_id, before, after)
+		VALUES
+			($1, $2, $3, $4, $5, %s, %s)
+		RETURNING id, created_at
+	`, r.db.Config().Schema, r.db.Dialect().JSON("$6"), r.db.Dialect().JSON("$7")),
+		entry.Entity, entry.EntityID, entry.Action, entry.User,
+		sql.NullString{String: entry.RequestID, Valid: entry.RequestID != ""}, before, after,
+	)
+
+	if err != nil {
+		return fmt.Errorf("could not record %s of %s %s: %v", entry.Action, entry.Entity, entry.EntityID, err)
+	}
+
+	entry.ID = created.Id
+	entry.CreatedAt = created.CreatedAt
+
+	return nil
+}
+
+// History returns all changes of the entity, oldest first
+func (r *AuditRepo) History(entity domain.AuditEntity, entityId string) ([]*domain.AuditEntry, error) {
+
+	var entries []*dtos.AuditEntry
+	err := r.db.Executor().Select(&entries, fmt.Sprintf(`
+		SELECT id, entity, entity_id, action, username, request_id, before, after, created_at
+		FROM %s.audit_log
+		WHERE entity = $1 AND entity_id = $2
+		ORDER BY id
+	`, r.db.Config().Schema), entity, entityId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convert(entries), nil
+}
+
+// Search returns the changes matching the filter, oldest first
+func (r *AuditRepo) Search(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+
+	var conditions []string
+	var args []interface{}
+
+	if filter.User != "" {
+		args = append(args, filter.User)
+		conditions = append(conditions, fmt.Sprintf("username = $%d", len(args)))
+	}
+
+	if !filter.Since.IsZero() {
+		args = append(args, r.db.Dialect().Time(filter.Since))
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	limit := ""
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		limit = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+
+	var entries []*dtos.AuditEntry
+	err := r.db.Executor().Select(&entries, fmt.Sprintf(`
+		SELECT id, entity, entity_id, action, username, request_id, before, after, created_at
+		FROM %s.audit_log
+		%s
+		ORDER BY id
+		%s
+	`, r.db.Config().Schema, whereClause(conditions), limit), args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convert(entries), nil
+}
+
+func (r *AuditRepo) convert(entries []*dtos.AuditEntry) []*domain.AuditEntry {
+	audit := []*domain.AuditEntry{}
+	for _, e := range entries {
+		audit = append(audit, &domain.AuditEntry{
+			ID:        e.Id,
+			Entity:    domain.AuditEntity(e.Entity),
+			EntityID:  e.EntityId,
+			Action:    domain.AuditAction(e.Action),
+			User:      e.Username,
+			RequestID: e.RequestId.String,
+			Before:    e.Before,
+			After:     e.After,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return audit
+}
+
+// record writes the audit entry of a change made on behalf of the actor. It runs
+// with the executor of db, so it is part of the transaction making the change.
+func record(db storage.Database, actor *domain.Actor, entity domain.AuditEntity, entityId string, action domain.AuditAction, before, after interface{}) error {
+
+	entry := &domain.AuditEntry{
+		Entity:   entity,
+		EntityID: entityId,
+		Action:   action,
+		User:     domain.SystemUser,
+	}
+
+	if actor != nil {
+		entry.User = actor.User
+		entry.RequestID = actor.RequestID
+	}
+
+	var err error
+	if entry.Before, err = marshalState(before); err != nil {
+		return err
+	}
+	if entry.After, err = marshalState(after); err != nil {
+		return err
+	}
+
+	return NewAuditRepo(db).Record(entry)
+}
+
+// marshalState marshals the state of an entity, nothing at all if there is none
+func marshalState(state interface{}) (json.RawMessage, error) {
+
+	if state == nil {
+		return nil, nil
+	}
+	if v := reflect.ValueOf(state); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal state for audit log: %v", err)
+	}
+
+	return b, nil
+}
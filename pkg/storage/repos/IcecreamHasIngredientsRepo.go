@@ -3,6 +3,7 @@ package repos
 import (
 	"fmt"
 
+	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
 )
 
@@ -17,7 +18,7 @@ func NewIcecreamHasIngredientsRepo(db storage.Database) *IcecreamHasIngredientsR
 }
 
 func (r *IcecreamHasIngredientsRepo) Create(productId int64, ingredientIds []int64) error {
-	stmt, err := r.db.DB().Preparex(fmt.Sprintf(`
+	stmt, err := r.db.Executor().Preparex(fmt.Sprintf(`
 		INSERT INTO %s.icecream_has_ingredients 
 			(icecream_product_id, ingredients_id) 
 		VALUES ($1, $2)
@@ -36,3 +37,40 @@ func (r *IcecreamHasIngredientsRepo) Create(productId int64, ingredientIds []int
 
 	return nil
 }
+
+// Deletes removes the relationship between the given icecreams and the ingredient
+// and returns the number of removed relationships. The ingredient itself is kept.
+func (r *IcecreamHasIngredientsRepo) Deletes(productIds []int64, ingredient domain.Ingredient) (int64, error) {
+
+	var deleted int64
+	err := r.db.Transaction(func(tx storage.Database) error {
+
+		stmt, err := tx.Executor().Preparex(fmt.Sprintf(`
+			DELETE FROM %[1]s.icecream_has_ingredients
+			WHERE icecream_product_id = $1
+			AND ingredients_id IN (SELECT id FROM %[1]s.ingredients WHERE name = TRIM($2))
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for _, id := range productIds {
+			result, err := stmt.Exec(id, ingredient)
+			if err != nil {
+				return fmt.Errorf("could not delete ingredient relationship of icecream with productID = %d: %v", id, err)
+			}
+
+			affectedRows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("could not delete ingredient relationship of icecream with productID = %d: %v", id, err)
+			}
+
+			deleted += affectedRows
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
@@ -3,6 +3,7 @@ package repos
 import (
 	"fmt"
 
+	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
 )
 
@@ -17,7 +18,7 @@ func NewIcecreamHasSourcingValuesRepo(db storage.Database) *IcecreamHasSourcingV
 }
 
 func (r *IcecreamHasSourcingValuesRepo) Create(productId int64, sourcingValueIds []int64) error {
-	stmt, err := r.db.DB().Preparex(fmt.Sprintf(`
+	stmt, err := r.db.Executor().Preparex(fmt.Sprintf(`
 		INSERT INTO %s.icecream_has_sourcing_values 
 			(icecream_product_id, sourcing_values_id) 
 		VALUES ($1, $2) 
@@ -36,3 +37,40 @@ func (r *IcecreamHasSourcingValuesRepo) Create(productId int64, sourcingValueIds
 
 	return nil
 }
+
+// Deletes removes the relationship between the given icecreams and the sourcing value
+// and returns the number of removed relationships. The sourcing value itself is kept.
+func (r *IcecreamHasSourcingValuesRepo) Deletes(productIds []int64, sourcingValue domain.SourcingValue) (int64, error) {
+
+	var deleted int64
+	err := r.db.Transaction(func(tx storage.Database) error {
+
+		stmt, err := tx.Executor().Preparex(fmt.Sprintf(`
+			DELETE FROM %[1]s.icecream_has_sourcing_values
+			WHERE icecream_product_id = $1
+			AND sourcing_values_id IN (SELECT id FROM %[1]s.sourcing_values WHERE description = TRIM($2))
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for _, id := range productIds {
+			result, err := stmt.Exec(id, sourcingValue)
+			if err != nil {
+				return fmt.Errorf("could not delete sourcing value relationship of icecream with productID = %d: %v", id, err)
+			}
+
+			affectedRows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("could not delete sourcing value relationship of icecream with productID = %d: %v", id, err)
+			}
+
+			deleted += affectedRows
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
@@ -1,30 +1,52 @@
 package repos
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
 	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+	"github.com/fraenky8/zlr-ca/pkg/storage/search"
 	"github.com/jmoiron/sqlx"
 )
 
 type IcecreamRepo struct {
-	db   storage.Database
-	repo Repository
+	db    storage.Database
+	repo  Repository
+	actor *domain.Actor
 }
 
 func NewIcecreamRepo(db storage.Database) *IcecreamRepo {
+	return newIcecreamRepo(db, nil)
+}
+
+// newIcecreamRepo passes the actor to the relation repos as well, so the ingredients and
+// sourcing values created along with an icecream are recorded as created by the actor
+func newIcecreamRepo(db storage.Database, actor *domain.Actor) *IcecreamRepo {
+
+	repo := &IcecreamRepo{actor: actor}
+
+	ingredients := NewIngredientsRepo(db)
+	ingredients.actor = actor
 
-	repo := &IcecreamRepo{}
+	sourcingValues := NewSourcingValuesRepo(db)
+	sourcingValues.actor = actor
 
 	service := Repository{
 		IcecreamService:                  repo,
-		IngredientService:                NewIngredientsRepo(db),
-		SourcingValueService:             NewSourcingValuesRepo(db),
+		IngredientService:                ingredients,
+		SourcingValueService:             sourcingValues,
 		IcecreamHasIngredientsService:    NewIcecreamHasIngredientsRepo(db),
 		IcecreamHasSourcingValuesService: NewIcecreamHasSourcingValuesRepo(db),
+		AuditService:                     NewAuditRepo(db),
+		IcecreamRevisionService:          NewIcecreamRevisionsRepo(db),
 	}
 
 	repo.db = db
@@ -33,63 +55,190 @@ func NewIcecreamRepo(db storage.Database) *IcecreamRepo {
 	return repo
 }
 
-func (r *IcecreamRepo) Creates(icecreams []*domain.Icecream) ([]int64, error) {
+// Creates inserts the icecreams together with their ingredients and sourcing values.
+// Everything runs in one transaction, so either all icecreams get created or none.
+// ErrAlreadyExists is returned if one of the icecreams exists, even if in the trash.
+func (r *IcecreamRepo) Creates(icecreams []*domain.Icecream) (ids []int64, err error) {
 
-	stmt, err := r.db.DB().Preparex(fmt.Sprintf(`
-		INSERT INTO %s.icecream
-  			(product_id, name, description, story, image_open, image_closed, allergy_info, dietary_certifications)
-		VALUES
-  			($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING product_id
-	`, r.db.Config().Schema))
+	err = r.transaction(func(tx *IcecreamRepo) error {
 
-	if err != nil {
-		return nil, fmt.Errorf("could not prepare statement: %v", err)
-	}
+		stmt, err := tx.db.Executor().Preparex(fmt.Sprintf(`
+			INSERT INTO %[1]s.icecream
+				(product_id, name, description, story, image_open, image_closed, allergy_info, dietary_certifications, version)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, %[2]s)
+			ON CONFLICT (product_id) DO NOTHING
+			RETURNING product_id
+		`, tx.db.Config().Schema, firstVersion(tx.db.Config().Schema)))
 
-	var ids []int64
-	for _, icecream := range icecreams {
-
-		var productId int64
-		err = stmt.Get(&productId,
-			icecream.ProductID, icecream.Name, icecream.Description, icecream.Story,
-			icecream.ImageOpen, icecream.ImageClosed, icecream.AllergyInfo, icecream.DietaryCertifications,
-		)
 		if err != nil {
-			return nil, fmt.Errorf("could not create icecream: %v", err)
+			return fmt.Errorf("could not prepare statement: %v", err)
 		}
 
-		ids, err := r.repo.IngredientService.Creates(icecream.Ingredients)
-		if err != nil {
-			return nil, err
-		}
+		for _, icecream := range icecreams {
 
-		err = r.repo.IcecreamHasIngredientsService.Create(productId, ids)
-		if err != nil {
-			return nil, err
-		}
+			var productId int64
+			err = stmt.Get(&productId,
+				icecream.ProductID, icecream.Name, icecream.Description, icecream.Story,
+				icecream.ImageOpen, icecream.ImageClosed, icecream.AllergyInfo, icecream.DietaryCertifications,
+			)
+			if err == sql.ErrNoRows {
+				return domain.ErrAlreadyExists
+			}
+			if err != nil {
+				return fmt.Errorf("could not create icecream: %v", err)
+			}
 
-		ids, err = r.repo.SourcingValueService.Creates(icecream.SourcingValues)
-		if err != nil {
-			return nil, err
-		}
+			ingredientIds, err := tx.repo.IngredientService.Creates(icecream.Ingredients)
+			if err != nil {
+				return err
+			}
 
-		err = r.repo.IcecreamHasSourcingValuesService.Create(productId, ids)
-		if err != nil {
-			return nil, err
-		}
+			if err = tx.repo.IcecreamHasIngredientsService.Create(productId, ingredientIds); err != nil {
+				return err
+			}
 
-		if err != nil {
-			return nil, err
+			sourcingValueIds, err := tx.repo.SourcingValueService.Creates(icecream.SourcingValues)
+			if err != nil {
+				return err
+			}
+
+			if err = tx.repo.IcecreamHasSourcingValuesService.Create(productId, sourcingValueIds); err != nil {
+				return err
+			}
+
+			created, err := tx.read(productId)
+			if err != nil {
+				return err
+			}
+
+			if err = tx.record(productId, domain.AuditActionCreate, nil, created); err != nil {
+				return err
+			}
+
+			ids = append(ids, productId)
 		}
 
-		ids = append(ids, productId)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
 	return ids, nil
 }
 
-func (r *IcecreamRepo) Reads(ids []int64) ([]*domain.Icecream, error) {
+// Replaces creates the icecreams or, if they already exist, replaces them entirely
+// including their ingredients and sourcing values. Icecreams in the trash are restored.
+// It returns the product ids of the icecreams which did not exist before.
+// Everything runs in one transaction.
+func (r *IcecreamRepo) Replaces(icecreams []*domain.Icecream) (created []int64, err error) {
+
+	err = r.transaction(func(tx *IcecreamRepo) error {
+		for _, icecream := range icecreams {
+			inserted, err := tx.replace(icecream)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				productId, _ := strconv.ParseInt(icecream.ProductID, 10, 64)
+				created = append(created, productId)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// replace upserts a single icecream and reports whether it has been inserted
+func (r *IcecreamRepo) replace(icecream *domain.Icecream) (inserted bool, err error) {
+
+	productId, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("faulty productID = %s: %v", icecream.ProductID, err)
+	}
+
+	before, err := r.read(productId)
+	if err != nil {
+		return false, err
+	}
+
+	// the icecream might be in the trash, so it is not read as before
+	err = r.db.Executor().Get(&inserted, fmt.Sprintf(`
+		SELECT COUNT(*) = 0 FROM %s.icecream WHERE product_id = $1
+	`, r.db.Config().Schema), productId)
+	if err != nil {
+		return false, fmt.Errorf("could not read icecream with productID = %s: %v", icecream.ProductID, err)
+	}
+
+	_, err = r.db.Executor().Exec(fmt.Sprintf(`
+		INSERT INTO %[1]s.icecream AS ic
+			(product_id, name, description, story, image_open, image_closed, allergy_info, dietary_certifications, version)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, %[3]s)
+		ON CONFLICT (product_id) DO UPDATE SET
+			name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			story = EXCLUDED.story,
+			image_open = EXCLUDED.image_open,
+			image_closed = EXCLUDED.image_closed,
+			allergy_info = EXCLUDED.allergy_info,
+			dietary_certifications = EXCLUDED.dietary_certifications,
+			version = ic.version + 1,
+			updated_at = %[2]s,
+			deleted_at = NULL
+	`, r.db.Config().Schema, r.db.Dialect().Now(), firstVersion(r.db.Config().Schema)),
+		productId, icecream.Name, icecream.Description, icecream.Story,
+		icecream.ImageOpen, icecream.ImageClosed, icecream.AllergyInfo, icecream.DietaryCertifications,
+	)
+	if err != nil {
+		return false, fmt.Errorf("could not replace icecream with productID = %s: %v", icecream.ProductID, err)
+	}
+
+	var ingredients []string
+	for _, ingredient := range icecream.Ingredients {
+		ingredients = append(ingredients, string(ingredient))
+	}
+
+	var sourcingValues []string
+	for _, sourcingValue := range icecream.SourcingValues {
+		sourcingValues = append(sourcingValues, string(sourcingValue))
+	}
+
+	if err = r.updateIngredients(productId, &domain.RelationPatch{Set: true, Replace: true, Values: ingredients}); err != nil {
+		return false, fmt.Errorf("could not replace ingredients of icecream with productID = %s: %v", icecream.ProductID, err)
+	}
+
+	if err = r.updateSourcingValues(productId, &domain.RelationPatch{Set: true, Replace: true, Values: sourcingValues}); err != nil {
+		return false, fmt.Errorf("could not replace sourcing values of icecream with productID = %s: %v", icecream.ProductID, err)
+	}
+
+	after, err := r.read(productId)
+	if err != nil {
+		return false, err
+	}
+
+	action := domain.AuditActionUpdate
+	if inserted {
+		action = domain.AuditActionCreate
+	}
+
+	if err = r.record(productId, action, before, after); err != nil {
+		return false, err
+	}
+
+	return inserted, nil
+}
+
+// Reads returns the icecreams with the given ids. The requested relations
+// are loaded with one additional query per relation for all icecreams at once.
+func (r *IcecreamRepo) Reads(ids []int64, include ...domain.Relation) ([]*domain.Icecream, error) {
 
 	query, args, err := sqlx.In(fmt.Sprintf(`
 		SELECT 
@@ -100,9 +249,11 @@ func (r *IcecreamRepo) Reads(ids []int64) ([]*domain.Icecream, error) {
 			image_open, 
 			image_closed, 
 			allergy_info, 
-			dietary_certifications
+			dietary_certifications,
+			version
 		FROM %s.icecream 
 		WHERE product_id IN (?)
+		AND deleted_at IS NULL
 	`, r.db.Config().Schema), ids)
 
 	if err != nil {
@@ -112,10 +263,10 @@ func (r *IcecreamRepo) Reads(ids []int64) ([]*domain.Icecream, error) {
 	// http://jmoiron.github.io/sqlx/#inQueries
 	// sqlx.In returns queries with the `?` bindvar, we can rebind it for our backend
 	// here: ? to $#
-	query = r.db.DB().Rebind(query)
+	query = r.db.Executor().Rebind(query)
 
 	var icecreamsDtos []dtos.Icecream
-	if err = r.db.DB().Select(&icecreamsDtos, query, args...); err != nil {
+	if err = r.db.Executor().Select(&icecreamsDtos, query, args...); err != nil {
 		return nil, err
 	}
 
@@ -128,92 +279,834 @@ func (r *IcecreamRepo) Reads(ids []int64) ([]*domain.Icecream, error) {
 		return nil, err
 	}
 
+	if err = r.loadRelations(icecreams, include); err != nil {
+		return nil, err
+	}
+
 	return icecreams, nil
 }
 
-func (r *IcecreamRepo) Updates(icecreams []*domain.Icecream) (err error) {
+func (r *IcecreamRepo) loadRelations(icecreams []*domain.Icecream, include []domain.Relation) error {
+
+	var ids []int64
+	for _, icecream := range icecreams {
+		id, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	for _, relation := range include {
+		switch relation {
+		case domain.RelationIngredients:
+			ingredients, err := r.repo.IngredientService.Reads(ids)
+			if err != nil {
+				return fmt.Errorf("could not load ingredients: %v", err)
+			}
+			for i, icecream := range icecreams {
+				icecream.Ingredients = ingredients[ids[i]]
+			}
+		case domain.RelationSourcingValues:
+			sourcingValues, err := r.repo.SourcingValueService.Reads(ids)
+			if err != nil {
+				return fmt.Errorf("could not load sourcing values: %v", err)
+			}
+			for i, icecream := range icecreams {
+				icecream.SourcingValues = sourcingValues[ids[i]]
+			}
+		default:
+			return relation.Verify()
+		}
+	}
 
-	tx := r.db.DB().MustBegin()
+	return nil
+}
 
-	stmt, err := tx.Preparex(fmt.Sprintf(`
-		UPDATE %s.icecream SET 
-		  name = $1,
-		  description = $2,
-		  story = $3,
-		  image_open = $4,
-		  image_closed = $5,
-		  allergy_info = $6,
-		  dietary_certifications = $7
-		WHERE product_id = $8
-	`, r.db.Config().Schema))
+// List returns a page of icecreams using keyset pagination. The product id is
+// always used as last sort key so the order of the icecreams is stable.
+func (r *IcecreamRepo) List(options *domain.IcecreamListOptions) (*domain.IcecreamPage, error) {
+
+	schema := r.db.Config().Schema
+
+	conditions, args := filterConditions(schema, r.db.Dialect(), &options.Filter)
+	conditions = append(conditions, "deleted_at IS NULL")
+
+	var total int64
+	err := r.db.Executor().Get(&total, fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s.icecream
+		%s
+	`, schema, whereClause(conditions)), args...)
 
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("could not prepare statement: %v", err)
+		return nil, fmt.Errorf("could not count icecreams: %v", err)
 	}
 
-	for _, icecream := range icecreams {
-		result, err := stmt.Exec(
-			icecream.Name, icecream.Description,
-			icecream.Story, icecream.ImageOpen,
-			icecream.ImageClosed, icecream.AllergyInfo,
-			icecream.DietaryCertifications, icecream.ProductID,
+	sort, err := keysetSort(options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor *icecreamCursor
+	if options.Cursor != "" {
+		if cursor, err = decodeIcecreamCursor(options.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// walking backwards means reading in reverse order and flipping the result afterwards
+	before := cursor != nil && cursor.Before
+	if before {
+		sort = reverseSort(sort)
+	}
+
+	if cursor != nil {
+		condition, keysetArgs := keysetCondition(sort, cursor, len(args))
+		conditions = append(conditions, condition)
+		args = append(args, keysetArgs...)
+	}
+
+	var order []string
+	for _, field := range sort {
+		if field.Descending {
+			order = append(order, field.Name+" DESC")
+			continue
+		}
+		order = append(order, field.Name+" ASC")
+	}
+
+	args = append(args, options.Limit+1)
+
+	var icecreamsDtos []dtos.Icecream
+	err = r.db.Executor().Select(&icecreamsDtos, fmt.Sprintf(`
+		SELECT 
+			product_id, 
+			name, 
+			description, 
+			story, 
+			image_open, 
+			image_closed, 
+			allergy_info, 
+			dietary_certifications,
+			version
+		FROM %s.icecream 
+		%s
+		ORDER BY %s
+		LIMIT $%d
+	`, schema, whereClause(conditions), strings.Join(order, ", "), len(args)), args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	more := len(icecreamsDtos) > options.Limit
+	if more {
+		icecreamsDtos = icecreamsDtos[:options.Limit]
+	}
+
+	if before {
+		for i, j := 0, len(icecreamsDtos)-1; i < j; i, j = i+1, j-1 {
+			icecreamsDtos[i], icecreamsDtos[j] = icecreamsDtos[j], icecreamsDtos[i]
+		}
+	}
+
+	icecreams, err := r.convert(icecreamsDtos)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.loadRelations(icecreams, options.Include); err != nil {
+		return nil, err
+	}
+
+	page := &domain.IcecreamPage{
+		Icecreams: icecreams,
+		Total:     total,
+	}
+
+	if len(icecreamsDtos) == 0 {
+		return page, nil
+	}
+
+	hasNext, hasPrev := more, cursor != nil
+	if before {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		last := icecreamsDtos[len(icecreamsDtos)-1]
+		page.Next = icecreamCursor{ProductId: last.ProductId, Name: last.Name}.encode()
+	}
+
+	if hasPrev {
+		first := icecreamsDtos[0]
+		page.Prev = icecreamCursor{ProductId: first.ProductId, Name: first.Name, Before: true}.encode()
+	}
+
+	return page, nil
+}
+
+// Search ranks the icecreams by relevance of their name, description, story and
+// ingredient names. The ingredients are not part of the indexed search vector
+// of the icecream table, so they get aggregated and weighted lowest at query time.
+func (r *IcecreamRepo) Search(query string, limit int) ([]*domain.IcecreamSearchResult, error) {
+
+	if !r.db.Dialect().FullTextSearch() {
+		return r.searchTexts(query, limit)
+	}
+
+	schema := r.db.Config().Schema
+
+	var resultDtos []*dtos.IcecreamSearchResult
+	err := r.db.Executor().Select(&resultDtos, fmt.Sprintf(`
+		WITH search AS (
+			SELECT websearch_to_tsquery('english', $1) AS query
+		), ingredients AS (
+			SELECT
+				ihi.icecream_product_id,
+				setweight(to_tsvector('english', string_agg(i.name, ' ')), 'D') AS document
+			FROM %s.icecream_has_ingredients AS ihi
+			JOIN %s.ingredients AS i ON i.id = ihi.ingredients_id
+			GROUP BY ihi.icecream_product_id
 		)
+		SELECT
+			ic.product_id,
+			ic.name,
+			ic.description,
+			ic.story,
+			ic.image_open,
+			ic.image_closed,
+			ic.allergy_info,
+			ic.dietary_certifications,
+			ts_rank(ic.search_vector || COALESCE(ing.document, ''::tsvector), search.query) AS score,
+			ts_headline('english', ic.name, search.query, 'HighlightAll=true') AS name_highlight,
+			ts_headline('english', COALESCE(ic.description, ''), search.query) AS description_highlight,
+			ts_headline('english', COALESCE(ic.story, ''), search.query) AS story_highlight
+		FROM search, %s.icecream AS ic
+		LEFT JOIN ingredients AS ing ON ing.icecream_product_id = ic.product_id
+		WHERE (ic.search_vector || COALESCE(ing.document, ''::tsvector)) @@ search.query
+		AND ic.deleted_at IS NULL
+		ORDER BY score DESC, ic.product_id
+		LIMIT $2
+	`, schema, schema, schema), query, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not search icecreams: %v", err)
+	}
 
+	results := []*domain.IcecreamSearchResult{}
+	for _, result := range resultDtos {
+		icecreams, err := r.convert([]dtos.Icecream{result.Icecream})
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("could not update icecream with productID = %s: %v", icecream.ProductID, err)
+			return nil, err
 		}
 
-		affectedRows, err := result.RowsAffected()
+		highlights := make(map[string]string)
+		for field, highlight := range map[string]string{
+			"name":        result.NameHighlight,
+			"description": result.DescriptionHighlight,
+			"story":       result.StoryHighlight,
+		} {
+			// ts_headline marks matches with <b>, fields without any match are left out
+			if strings.Contains(highlight, "<b>") {
+				highlights[field] = highlight
+			}
+		}
+
+		results = append(results, &domain.IcecreamSearchResult{
+			Icecream:   icecreams[0],
+			Score:      result.Score,
+			Highlights: highlights,
+		})
+	}
+
+	return results, nil
+}
+
+// searchTexts approximates the full-text search for databases without one,
+// see package search. It looks at every icecream, which is fine for a catalogue.
+func (r *IcecreamRepo) searchTexts(query string, limit int) ([]*domain.IcecreamSearchResult, error) {
+
+	var icecreamsDtos []dtos.Icecream
+	err := r.db.Executor().Select(&icecreamsDtos, fmt.Sprintf(`
+		SELECT 
+			product_id, 
+			name, 
+			description, 
+			story, 
+			image_open, 
+			image_closed, 
+			allergy_info, 
+			dietary_certifications,
+			version
+		FROM %s.icecream 
+		WHERE deleted_at IS NULL
+	`, r.db.Config().Schema))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not search icecreams: %v", err)
+	}
+
+	icecreams, err := r.convert(icecreamsDtos)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, icecream := range icecreamsDtos {
+		ids = append(ids, icecream.ProductId)
+	}
+
+	ingredients, err := r.repo.IngredientService.Reads(ids)
+	if err != nil {
+		return nil, fmt.Errorf("could not search icecreams: %v", err)
+	}
+
+	terms, excluded := search.Terms(query)
+
+	results := []*domain.IcecreamSearchResult{}
+	for i, icecream := range icecreams {
+
+		var names []string
+		for _, ingredient := range ingredients[ids[i]] {
+			names = append(names, string(ingredient))
+		}
+
+		if result := search.Match(icecream, names, terms, excluded); result != nil {
+			results = append(results, result)
+		}
+	}
+
+	return search.Rank(results, limit), nil
+}
+
+// Updates applies the patches including the changes of the ingredients and
+// sourcing values. All patches are applied within one transaction.
+func (r *IcecreamRepo) Updates(patches []*domain.IcecreamPatch) error {
+	return r.transaction(func(tx *IcecreamRepo) error {
+		for _, patch := range patches {
+			if err := tx.update(patch); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *IcecreamRepo) update(patch *domain.IcecreamPatch) error {
+
+	productId, err := strconv.ParseInt(patch.ProductID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("faulty productID = %s: %v", patch.ProductID, err)
+	}
+
+	before, err := r.read(productId)
+	if err != nil {
+		return err
+	}
+
+	fields := []struct {
+		column string
+		value  domain.OptionalString
+	}{
+		{"name", patch.Name},
+		{"description", patch.Description},
+		{"story", patch.Story},
+		{"image_open", patch.ImageOpen},
+		{"image_closed", patch.ImageClosed},
+		{"allergy_info", patch.AllergyInfo},
+		{"dietary_certifications", patch.DietaryCertifications},
+	}
+
+	var sets []string
+	var args []interface{}
+	for _, field := range fields {
+		if !field.value.Set {
+			continue
+		}
+		args = append(args, sql.NullString{String: field.value.Value, Valid: field.value.Valid})
+		sets = append(sets, fmt.Sprintf("%s = $%d", field.column, len(args)))
+	}
+
+	// every update, even one of the relations only, creates a new version
+	sets = append(sets, "version = version + 1", "updated_at = "+r.db.Dialect().Now())
+
+	args = append(args, productId)
+	where := fmt.Sprintf("product_id = $%d AND deleted_at IS NULL", len(args))
+
+	if patch.Version != 0 {
+		args = append(args, patch.Version)
+		where += fmt.Sprintf(" AND version = $%d", len(args))
+	}
+
+	result, err := r.db.Executor().Exec(fmt.Sprintf(`
+		UPDATE %s.icecream SET %s
+		WHERE %s
+	`, r.db.Config().Schema, strings.Join(sets, ", "), where), args...)
+
+	if err != nil {
+		return fmt.Errorf("could not update icecream with productID = %s: %v", patch.ProductID, err)
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update icecream with productID = %s: %v", patch.ProductID, err)
+	}
+
+	if affectedRows == 0 {
+		return r.notUpdated(productId, patch.Version)
+	}
+
+	if err = r.updateIngredients(productId, &patch.Ingredients); err != nil {
+		return fmt.Errorf("could not update ingredients of icecream with productID = %s: %v", patch.ProductID, err)
+	}
+
+	if err = r.updateSourcingValues(productId, &patch.SourcingValues); err != nil {
+		return fmt.Errorf("could not update sourcing values of icecream with productID = %s: %v", patch.ProductID, err)
+	}
+
+	after, err := r.read(productId)
+	if err != nil {
+		return err
+	}
+
+	return r.record(productId, domain.AuditActionUpdate, before, after)
+}
+
+// notUpdated tells why a conditional update or delete did not affect the icecream:
+// either it does not exist, ErrNotFound, or it is not at the expected version anymore,
+// ErrVersionMismatch
+func (r *IcecreamRepo) notUpdated(productId int64, version int64) error {
+
+	if version == 0 {
+		return domain.ErrNotFound
+	}
+
+	var exists bool
+	if err := r.db.Executor().Get(&exists, fmt.Sprintf(`
+		SELECT EXISTS (SELECT 1 FROM %s.icecream WHERE product_id = $1 AND deleted_at IS NULL)
+	`, r.db.Config().Schema), productId); err != nil {
+		return fmt.Errorf("could not check icecream with productID = %d: %v", productId, err)
+	}
+
+	if !exists {
+		return domain.ErrNotFound
+	}
+
+	return domain.ErrVersionMismatch
+}
+
+func (r *IcecreamRepo) updateIngredients(productId int64, patch *domain.RelationPatch) error {
+
+	if !patch.Set {
+		return nil
+	}
+
+	add := patch.Add
+	if patch.Replace {
+		_, err := r.db.Executor().Exec(fmt.Sprintf(`
+			DELETE FROM %s.icecream_has_ingredients
+			WHERE icecream_product_id = $1
+		`, r.db.Config().Schema), productId)
+
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("could not update icecream with productID = %s: %v", icecream.ProductID, err)
+			return err
 		}
 
-		if affectedRows == 0 {
-			tx.Rollback()
-			return fmt.Errorf("icecream with productID = %s does not exist", icecream.ProductID)
+		add = patch.Values
+	}
+
+	for _, name := range patch.Remove {
+		if _, err := r.repo.IcecreamHasIngredientsService.Deletes([]int64{productId}, domain.Ingredient(name)); err != nil {
+			return err
 		}
 	}
 
-	return tx.Commit()
+	var ingredients domain.Ingredients
+	for _, name := range add {
+		ingredients = append(ingredients, domain.Ingredient(name))
+	}
+
+	ids, err := r.repo.IngredientService.Creates(ingredients)
+	if err != nil {
+		return err
+	}
+
+	return r.repo.IcecreamHasIngredientsService.Create(productId, ids)
 }
 
-func (r *IcecreamRepo) Deletes(ids []int64) (err error) {
+func (r *IcecreamRepo) updateSourcingValues(productId int64, patch *domain.RelationPatch) error {
 
-	tx := r.db.DB().MustBegin()
+	if !patch.Set {
+		return nil
+	}
 
-	stmt, err := tx.Preparex(fmt.Sprintf(`
-		DELETE FROM %s.icecream
-		WHERE product_id = $1
-	`, r.db.Config().Schema))
+	add := patch.Add
+	if patch.Replace {
+		if err := r.repo.SourcingValueService.Deletes([]int64{productId}); err != nil {
+			return err
+		}
+		add = patch.Values
+	}
 
+	for _, description := range patch.Remove {
+		if _, err := r.repo.IcecreamHasSourcingValuesService.Deletes([]int64{productId}, domain.SourcingValue(description)); err != nil {
+			return err
+		}
+	}
+
+	var sourcingValues domain.SourcingValues
+	for _, description := range add {
+		sourcingValues = append(sourcingValues, domain.SourcingValue(description))
+	}
+
+	ids, err := r.repo.SourcingValueService.Creates(sourcingValues)
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("could not prepare statement: %v", err)
+		return err
 	}
 
-	for _, id := range ids {
-		result, err := stmt.Exec(id)
+	return r.repo.IcecreamHasSourcingValuesService.Create(productId, ids)
+}
+
+// Delete moves the icecream into the trash, but only if it is still at the given
+// version, otherwise ErrVersionMismatch is returned
+func (r *IcecreamRepo) Delete(id int64, version int64) error {
+	return r.transaction(func(tx *IcecreamRepo) error {
+
+		before, err := tx.read(id)
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("could not update icecream with productID = %d: %v", id, err)
+			return err
+		}
+
+		result, err := tx.db.Executor().Exec(fmt.Sprintf(`
+			UPDATE %[1]s.icecream
+			SET deleted_at = %[2]s, updated_at = %[2]s, version = version + 1
+			WHERE product_id = $1 AND version = $2 AND deleted_at IS NULL
+		`, tx.db.Config().Schema, tx.db.Dialect().Now()), id, version)
+
+		if err != nil {
+			return fmt.Errorf("could not delete icecream with productID = %d: %v", id, err)
 		}
 
 		affectedRows, err := result.RowsAffected()
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("could not update icecream with productID = %d: %v", id, err)
+			return fmt.Errorf("could not delete icecream with productID = %d: %v", id, err)
 		}
 
 		if affectedRows == 0 {
-			tx.Rollback()
-			return fmt.Errorf("icecream with productID = %d does not exist", id)
+			return tx.notUpdated(id, version)
 		}
+
+		return tx.record(id, domain.AuditActionDelete, before, nil)
+	})
+}
+
+// Deletes moves the icecreams into the trash. Their ingredients and sourcing values
+// are kept, so they come back on restore. If versions are given, every icecream must
+// still be at the version of the same index, otherwise ErrVersionMismatch is returned.
+func (r *IcecreamRepo) Deletes(ids []int64, versions []int64) error {
+	if versions != nil && len(versions) != len(ids) {
+		return fmt.Errorf("%d versions given for %d icecreams", len(versions), len(ids))
 	}
 
-	return tx.Commit()
+	return r.transaction(func(tx *IcecreamRepo) error {
+
+		stmt, err := tx.db.Executor().Preparex(fmt.Sprintf(`
+			UPDATE %[1]s.icecream
+			SET deleted_at = %[2]s, updated_at = %[2]s, version = version + 1
+			WHERE product_id = $1 AND deleted_at IS NULL AND (version = $2 OR $2 = 0)
+		`, tx.db.Config().Schema, tx.db.Dialect().Now()))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for k, id := range ids {
+			before, err := tx.read(id)
+			if err != nil {
+				return err
+			}
+
+			var version int64
+			if versions != nil {
+				version = versions[k]
+			}
+
+			result, err := stmt.Exec(id, version)
+			if err != nil {
+				return fmt.Errorf("could not delete icecream with productID = %d: %v", id, err)
+			}
+
+			affectedRows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("could not delete icecream with productID = %d: %v", id, err)
+			}
+
+			if affectedRows == 0 {
+				return tx.notUpdated(id, version)
+			}
+
+			if err = tx.record(id, domain.AuditActionDelete, before, nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Trash returns the deleted icecreams including all their relations, latest deleted first
+func (r *IcecreamRepo) Trash() ([]*domain.Icecream, error) {
+
+	var icecreamsDtos []dtos.Icecream
+	err := r.db.Executor().Select(&icecreamsDtos, fmt.Sprintf(`
+		SELECT 
+			product_id, 
+			name, 
+			description, 
+			story, 
+			image_open, 
+			image_closed, 
+			allergy_info, 
+			dietary_certifications,
+			version,
+			deleted_at
+		FROM %s.icecream 
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, product_id
+	`, r.db.Config().Schema))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(icecreamsDtos) == 0 {
+		return nil, nil
+	}
+
+	icecreams, err := r.convert(icecreamsDtos)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.loadRelations(icecreams, domain.IcecreamRelations); err != nil {
+		return nil, err
+	}
+
+	return icecreams, nil
+}
+
+// Restores takes the icecreams out of the trash. If one of them is not in
+// the trash, none gets restored and ErrNotDeleted is returned.
+func (r *IcecreamRepo) Restores(ids []int64) error {
+	return r.transaction(func(tx *IcecreamRepo) error {
+
+		stmt, err := tx.db.Executor().Preparex(fmt.Sprintf(`
+			UPDATE %s.icecream
+			SET deleted_at = NULL, updated_at = %s, version = version + 1
+			WHERE product_id = $1 AND deleted_at IS NOT NULL
+		`, tx.db.Config().Schema, tx.db.Dialect().Now()))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for _, id := range ids {
+			result, err := stmt.Exec(id)
+			if err != nil {
+				return fmt.Errorf("could not restore icecream with productID = %d: %v", id, err)
+			}
+
+			affectedRows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("could not restore icecream with productID = %d: %v", id, err)
+			}
+
+			if affectedRows == 0 {
+				return domain.ErrNotDeleted
+			}
+
+			after, err := tx.read(id)
+			if err != nil {
+				return err
+			}
+
+			if err = tx.record(id, domain.AuditActionRestore, nil, after); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Purge finally deletes the icecreams which were moved into the trash before the given
+// time. The cascade removes their relations. It returns the number of purged icecreams.
+func (r *IcecreamRepo) Purge(before time.Time) (purged int64, err error) {
+
+	err = r.transaction(func(tx *IcecreamRepo) error {
+
+		var ids []int64
+		err := tx.db.Executor().Select(&ids, fmt.Sprintf(`
+			DELETE FROM %s.icecream
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			RETURNING product_id
+		`, tx.db.Config().Schema), tx.db.Dialect().Time(before))
+
+		if err != nil {
+			return fmt.Errorf("could not purge icecreams: %v", err)
+		}
+
+		for _, id := range ids {
+			if err = tx.record(id, domain.AuditActionPurge, nil, nil); err != nil {
+				return err
+			}
+		}
+
+		purged = int64(len(ids))
+		return nil
+	})
+
+	return purged, err
+}
+
+// Revert replaces the icecream by the state of the given revision, which creates
+// a new revision. An icecream in the trash gets restored by that.
+func (r *IcecreamRepo) Revert(id int64, revision int64) error {
+	return r.transaction(func(tx *IcecreamRepo) error {
+
+		rev, err := NewIcecreamRevisionsRepo(tx.db).Revision(id, revision)
+		if err != nil {
+			return fmt.Errorf("could not read revision %d of icecream with productID = %d: %v", revision, id, err)
+		}
+
+		if rev == nil || rev.Icecream == nil {
+			return fmt.Errorf("revision %d of icecream with productID = %d does not hold an icecream", revision, id)
+		}
+
+		_, err = tx.replace(rev.Icecream)
+		return err
+	})
+}
+
+// firstVersion is the version of an inserted icecream with the product id $1. It continues after
+// the revisions of a purged icecream with the same product id, so an ETag of it never matches the
+// new icecream. A version never exceeds the number of revisions, as every change records one.
+func firstVersion(schema string) string {
+	return fmt.Sprintf(`(
+		SELECT COALESCE(MAX(revision), 0) + 1 FROM %s.icecream_revisions WHERE icecream_product_id = $1
+	)`, schema)
+}
+
+// read returns the icecream with all its relations or nil if it does not exist
+func (r *IcecreamRepo) read(productId int64) (*domain.Icecream, error) {
+
+	icecreams, err := r.Reads([]int64{productId}, domain.IcecreamRelations...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read icecream with productID = %d: %v", productId, err)
+	}
+
+	if len(icecreams) == 0 {
+		return nil, nil
+	}
+
+	return icecreams[0], nil
+}
+
+// record writes the change of the icecream into the audit log and keeps
+// the state after the change as a new revision of the icecream
+func (r *IcecreamRepo) record(productId int64, action domain.AuditAction, before, after *domain.Icecream) error {
+
+	err := record(r.db, r.actor, domain.AuditEntityIcecream, strconv.FormatInt(productId, 10), action, before, after)
+	if err != nil {
+		return err
+	}
+
+	user := domain.SystemUser
+	if r.actor != nil {
+		user = r.actor.User
+	}
+
+	return NewIcecreamRevisionsRepo(r.db).create(productId, after, user)
+}
+
+// linked returns the icecreams with all their relations which the has-table links to the
+// ingredient or sourcing value with the given id
+func (r *IcecreamRepo) linked(table, column string, id int64) ([]*domain.Icecream, error) {
+
+	var productIds []int64
+	err := r.db.Executor().Select(&productIds, fmt.Sprintf(`
+		SELECT icecream_product_id
+		FROM %s.%s
+		WHERE %s = $1
+		ORDER BY icecream_product_id
+	`, r.db.Config().Schema, table, column), id)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read icecreams of %s = %d: %v", column, id, err)
+	}
+
+	if len(productIds) == 0 {
+		return nil, nil
+	}
+
+	return r.Reads(productIds, domain.IcecreamRelations...)
+}
+
+// changed gives every icecream whose relations were changed by other means than an
+// update, e.g. by renaming one of its ingredients, a new version and records the change
+// like an update. before holds the icecreams as they were before the change.
+func (r *IcecreamRepo) changed(before []*domain.Icecream) error {
+
+	for _, icecream := range before {
+
+		productId, err := strconv.ParseInt(icecream.ProductID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("faulty productID = %s: %v", icecream.ProductID, err)
+		}
+
+		after, err := r.read(productId)
+		if err != nil {
+			return err
+		}
+
+		if after == nil || sameRelations(icecream, after) {
+			continue
+		}
+
+		_, err = r.db.Executor().Exec(fmt.Sprintf(`
+			UPDATE %s.icecream SET version = version + 1, updated_at = %s
+			WHERE product_id = $1
+		`, r.db.Config().Schema, r.db.Dialect().Now()), productId)
+
+		if err != nil {
+			return fmt.Errorf("could not update icecream with productID = %d: %v", productId, err)
+		}
+
+		if after, err = r.read(productId); err != nil {
+			return err
+		}
+
+		if err = r.record(productId, domain.AuditActionUpdate, icecream, after); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameRelations reports whether both icecreams have the same ingredients and sourcing values
+func sameRelations(a, b *domain.Icecream) bool {
+	return reflect.DeepEqual(a.Ingredients, b.Ingredients) && reflect.DeepEqual(a.SourcingValues, b.SourcingValues)
+}
+
+// transaction runs fn with an IcecreamRepo whose statements, including the ones
+// of all its relation repos, run within one transaction
+func (r *IcecreamRepo) transaction(fn func(tx *IcecreamRepo) error) error {
+	return r.db.Transaction(func(db storage.Database) error {
+		return fn(newIcecreamRepo(db, r.actor))
+	})
 }
 
 func (r *IcecreamRepo) convert(dtos []dtos.Icecream) (icecreams []*domain.Icecream, err error) {
@@ -227,7 +1120,150 @@ func (r *IcecreamRepo) convert(dtos []dtos.Icecream) (icecreams []*domain.Icecre
 			ImageOpen:             icecream.ImageOpen.String,
 			AllergyInfo:           icecream.AllergyInfo.String,
 			DietaryCertifications: icecream.DietaryCertifications.String,
+			Version:               icecream.Version,
+			DeletedAt:             icecream.DeletedAt,
 		})
 	}
 	return icecreams, nil
 }
+
+// icecreamCursor marks the position of an icecream within a sorted listing.
+// It holds the values of all sortable columns of that icecream.
+type icecreamCursor struct {
+	ProductId int64  `json:"id"`
+	Name      string `json:"name"`
+	Before    bool   `json:"before,omitempty"`
+}
+
+func (c icecreamCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (c icecreamCursor) value(column string) interface{} {
+	if column == "name" {
+		return c.Name
+	}
+	return c.ProductId
+}
+
+func decodeIcecreamCursor(s string) (*icecreamCursor, error) {
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	var cursor icecreamCursor
+	if err = json.Unmarshal(b, &cursor); err != nil {
+		return nil, domain.ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// keysetSort verifies the requested sort fields and makes sure the listing ends
+// with the unique product id. Fields after the product id have no effect and are dropped.
+func keysetSort(fields []domain.SortField) ([]domain.SortField, error) {
+
+	var sort []domain.SortField
+	for _, field := range fields {
+		if err := field.Verify(); err != nil {
+			return nil, err
+		}
+		sort = append(sort, field)
+		if field.Name == "product_id" {
+			return sort, nil
+		}
+	}
+
+	return append(sort, domain.SortField{Name: "product_id"}), nil
+}
+
+func reverseSort(fields []domain.SortField) []domain.SortField {
+	var reversed []domain.SortField
+	for _, field := range fields {
+		reversed = append(reversed, domain.SortField{Name: field.Name, Descending: !field.Descending})
+	}
+	return reversed
+}
+
+// keysetCondition builds the condition selecting all rows after the cursor, e.g. for
+// "name, product_id": (name > $1) OR (name = $1 AND product_id > $2). The numbering
+// of the placeholders starts after offset.
+func keysetCondition(sort []domain.SortField, cursor *icecreamCursor, offset int) (string, []interface{}) {
+
+	var args []interface{}
+	var alternatives []string
+
+	for i, field := range sort {
+		var conditions []string
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", sort[j].Name, offset+j+1))
+		}
+
+		op := ">"
+		if field.Descending {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s $%d", field.Name, op, offset+i+1))
+
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+		args = append(args, cursor.value(field.Name))
+	}
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// filterConditions translates the filter into conditions on the icecream table.
+// Relations are checked with (NOT) EXISTS joins over the has-tables.
+func filterConditions(schema string, dialect storage.Dialect, filter *domain.IcecreamFilter) (conditions []string, args []interface{}) {
+
+	// the patterns escape with a backslash, which is not the default of every database
+	ilike := dialect.ILike() + ` $%d ESCAPE '\'`
+
+	hasIngredient := fmt.Sprintf(`EXISTS (
+			SELECT 1
+			FROM %s.icecream_has_ingredients AS ihi
+			JOIN %s.ingredients AS i ON i.id = ihi.ingredients_id
+			WHERE ihi.icecream_product_id = icecream.product_id
+			AND i.name %s
+		)`, schema, schema, ilike)
+
+	hasSourcingValue := fmt.Sprintf(`EXISTS (
+			SELECT 1
+			FROM %s.icecream_has_sourcing_values AS ihsv
+			JOIN %s.sourcing_values AS sv ON sv.id = ihsv.sourcing_values_id
+			WHERE ihsv.icecream_product_id = icecream.product_id
+			AND LOWER(sv.description) = LOWER(TRIM($%%d))
+		)`, schema, schema)
+
+	add := func(condition string, values []string, value func(string) string) {
+		for _, v := range values {
+			args = append(args, value(v))
+			conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+		}
+	}
+
+	add(hasIngredient, filter.Ingredients, containing)
+	add("NOT "+hasIngredient, filter.WithoutIngredients, containing)
+	add(hasSourcingValue, filter.SourcingValues, func(v string) string { return v })
+	add("allergy_info "+ilike, filter.Allergens, containing)
+	add("COALESCE(allergy_info, '') NOT "+ilike, filter.WithoutAllergens, containing)
+	add("dietary_certifications "+ilike, filter.Certifications, containing)
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// containing turns the value into an ILIKE pattern matching it anywhere
+func containing(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(value))
+	return "%" + value + "%"
+}
@@ -0,0 +1,136 @@
+package repos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+)
+
+type IcecreamRevisionsRepo struct {
+	db storage.Database
+}
+
+func NewIcecreamRevisionsRepo(db storage.Database) *IcecreamRevisionsRepo {
+	return &IcecreamRevisionsRepo{
+		db: db,
+	}
+}
+
+// Revisions returns all revisions of the icecream, oldest first
+func (r *IcecreamRevisionsRepo) Revisions(productId int64) ([]*domain.IcecreamRevision, error) {
+
+	var revisions []*dtos.IcecreamRevision
+	err := r.db.Executor().Select(&revisions, fmt.Sprintf(`
+		SELECT icecream_product_id, revision, icecream, valid_from, username
+		FROM %s.icecream_revisions
+		WHERE icecream_product_id = $1
+		ORDER BY revision
+	`, r.db.Config().Schema), productId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convert(revisions)
+}
+
+func (r *IcecreamRevisionsRepo) Revision(productId int64, revision int64) (*domain.IcecreamRevision, error) {
+
+	var dto dtos.IcecreamRevision
+	err := r.db.Executor().Get(&dto, fmt.Sprintf(`
+		SELECT icecream_product_id, revision, icecream, valid_from, username
+		FROM %s.icecream_revisions
+		WHERE icecream_product_id = $1 AND revision = $2
+	`, r.db.Config().Schema), productId, revision)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convertRevision(&dto)
+}
+
+// AsOf returns the revision of the icecream which was valid at the given time
+func (r *IcecreamRevisionsRepo) AsOf(productId int64, at time.Time) (*domain.IcecreamRevision, error) {
+
+	var dto dtos.IcecreamRevision
+	err := r.db.Executor().Get(&dto, fmt.Sprintf(`
+		SELECT icecream_product_id, revision, icecream, valid_from, username
+		FROM %s.icecream_revisions
+		WHERE icecream_product_id = $1 AND valid_from <= $2
+		ORDER BY revision DESC
+		LIMIT 1
+	`, r.db.Config().Schema), productId, r.db.Dialect().Time(at))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convertRevision(&dto)
+}
+
+// create adds the next revision of the icecream, nil marks it as deleted
+func (r *IcecreamRevisionsRepo) create(productId int64, icecream *domain.Icecream, user string) error {
+
+	state, err := marshalState(icecream)
+	if err != nil {
+		return err
+	}
+
+	// the primary key makes a concurrent revision with the same number fail
+	_, err = r.db.Executor().Exec(fmt.Sprintf(`
+		INSERT INTO %[1]s.icecream_revisions
+			(icecream_product_id, revision, icecream, username)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, %[2]s, $3
+		FROM %[1]s.icecream_revisions
+		WHERE icecream_product_id = $1
+	`, r.db.Config().Schema, r.db.Dialect().JSON("$2")), productId, sql.NullString{String: string(state), Valid: state != nil}, user)
+
+	if err != nil {
+		return fmt.Errorf("could not create revision of icecream with productID = %d: %v", productId, err)
+	}
+
+	return nil
+}
+
+func (r *IcecreamRevisionsRepo) convert(dtos []*dtos.IcecreamRevision) ([]*domain.IcecreamRevision, error) {
+	revisions := []*domain.IcecreamRevision{}
+	for _, dto := range dtos {
+		revision, err := r.convertRevision(dto)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+func (r *IcecreamRevisionsRepo) convertRevision(dto *dtos.IcecreamRevision) (*domain.IcecreamRevision, error) {
+
+	revision := &domain.IcecreamRevision{
+		ProductID: strconv.FormatInt(dto.IcecreamProductId, 10),
+		Revision:  dto.Revision,
+		ValidFrom: dto.ValidFrom,
+		User:      dto.Username,
+	}
+
+	if dto.Icecream != nil {
+		if err := json.Unmarshal(dto.Icecream, &revision.Icecream); err != nil {
+			return nil, fmt.Errorf("faulty revision %d of icecream with productID = %d: %v", dto.Revision, dto.IcecreamProductId, err)
+		}
+	}
+
+	return revision, nil
+}
@@ -1,15 +1,19 @@
 package repos
 
 import (
+	"database/sql"
 	"fmt"
+	"strconv"
 
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
 	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+	"github.com/jmoiron/sqlx"
 )
 
 type IngredientsRepo struct {
-	db storage.Database
+	db    storage.Database
+	actor *domain.Actor
 }
 
 func NewIngredientsRepo(db storage.Database) *IngredientsRepo {
@@ -18,25 +22,60 @@ func NewIngredientsRepo(db storage.Database) *IngredientsRepo {
 	}
 }
 
-func (r *IngredientsRepo) Creates(ingredients domain.Ingredients) ([]int64, error) {
+// Creates returns the ids of the ingredients, the missing ones get created
+func (r *IngredientsRepo) Creates(ingredients domain.Ingredients) (ids []int64, err error) {
 
-	stmt, err := r.db.DB().Preparex(fmt.Sprintf(`
-		INSERT INTO %s.ingredients (name) VALUES (TRIM($1)) 
-		ON CONFLICT (name) DO UPDATE SET name = TRIM($1) RETURNING id
-	`, r.db.Config().Schema))
+	err = r.db.Transaction(func(tx storage.Database) error {
 
-	if err != nil {
-		return nil, fmt.Errorf("could not prepare statement: %v", err)
-	}
+		insert, err := tx.Executor().Preparex(fmt.Sprintf(`
+			INSERT INTO %s.ingredients (name) VALUES (TRIM($1))
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id, name
+		`, tx.Config().Schema))
 
-	var ids []int64
-	for _, ingredient := range ingredients {
-		var id int64
-		err := stmt.Get(&id, ingredient)
 		if err != nil {
-			return nil, fmt.Errorf("could not create ingredient: %v", err)
+			return fmt.Errorf("could not prepare statement: %v", err)
 		}
-		ids = append(ids, id)
+
+		existing, err := tx.Executor().Preparex(fmt.Sprintf(`
+			SELECT id FROM %s.ingredients WHERE name = TRIM($1)
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for _, ingredient := range ingredients {
+
+			var dto dtos.Ingredients
+			err := insert.Get(&dto, ingredient)
+
+			// nothing returned means the ingredient exists already
+			if err == sql.ErrNoRows {
+				var id int64
+				if err = existing.Get(&id, ingredient); err != nil {
+					return fmt.Errorf("could not read ingredient %s: %v", ingredient, err)
+				}
+				ids = append(ids, id)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("could not create ingredient: %v", err)
+			}
+
+			created := r.convertEntry(&dto)
+			if err = r.record(tx, created.ID, domain.AuditActionCreate, nil, created); err != nil {
+				return err
+			}
+
+			ids = append(ids, created.ID)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
 	return ids, nil
@@ -45,7 +84,7 @@ func (r *IngredientsRepo) Creates(ingredients domain.Ingredients) ([]int64, erro
 func (r *IngredientsRepo) Read(icecreamProductId int64) (domain.Ingredients, error) {
 
 	var ingredients []*dtos.Ingredients
-	err := r.db.DB().Select(&ingredients, fmt.Sprintf(`
+	err := r.db.Executor().Select(&ingredients, fmt.Sprintf(`
 		SELECT
   			id, name
 		FROM
@@ -62,30 +101,275 @@ func (r *IngredientsRepo) Read(icecreamProductId int64) (domain.Ingredients, err
 	return r.convert(ingredients)
 }
 
-func (r *IngredientsRepo) Reads(icecreamProductIds []int64) (ingredients []domain.Ingredients, err error) {
+// Reads returns the ingredients of all given icecreams keyed by their product id.
+// Icecreams without any ingredient are contained with an empty list.
+func (r *IngredientsRepo) Reads(icecreamProductIds []int64) (map[int64]domain.Ingredients, error) {
+
+	ingredients := make(map[int64]domain.Ingredients)
+	if len(icecreamProductIds) == 0 {
+		return ingredients, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`
+		SELECT
+			ihi.icecream_product_id, i.id, i.name
+		FROM
+			%s.ingredients AS i,
+			%s.icecream_has_ingredients AS ihi
+		WHERE ihi.ingredients_id = i.id
+		AND ihi.icecream_product_id IN (?)
+		ORDER BY i.id
+	`, r.db.Config().Schema, r.db.Config().Schema), icecreamProductIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*dtos.IcecreamIngredient
+	if err = r.db.Executor().Select(&rows, r.db.Executor().Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
 	for _, id := range icecreamProductIds {
-		ingredient, err := r.Read(id)
-		if err != nil {
-			return nil, err
-		}
-		ingredients = append(ingredients, ingredient)
+		ingredients[id] = domain.Ingredients{}
+	}
+
+	for _, row := range rows {
+		ingredients[row.IcecreamProductId] = append(ingredients[row.IcecreamProductId], domain.Ingredient(row.Name))
 	}
+
 	return ingredients, nil
 }
 
-func (r *IngredientsRepo) ReadAll() (domain.Ingredients, error) {
+func (r *IngredientsRepo) ReadAll() ([]*domain.IngredientEntry, error) {
 
 	var ingredients []*dtos.Ingredients
-	err := r.db.DB().Select(&ingredients, fmt.Sprintf(`
+	err := r.db.Executor().Select(&ingredients, fmt.Sprintf(`
 		SELECT id, name
 		FROM %s.ingredients
+		ORDER BY id
 	`, r.db.Config().Schema))
 
 	if err != nil {
 		return nil, err
 	}
 
-	return r.convert(ingredients)
+	return r.convertEntries(ingredients), nil
+}
+
+func (r *IngredientsRepo) ReadById(id int64) (*domain.IngredientEntry, error) {
+
+	var ingredient dtos.Ingredients
+	err := r.db.Executor().Get(&ingredient, fmt.Sprintf(`
+		SELECT id, name
+		FROM %s.ingredients
+		WHERE id = $1
+	`, r.db.Config().Schema), id)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convertEntry(&ingredient), nil
+}
+
+func (r *IngredientsRepo) Create(ingredient domain.Ingredient) (created *domain.IngredientEntry, err error) {
+
+	err = r.db.Transaction(func(tx storage.Database) error {
+
+		var dto dtos.Ingredients
+		err := tx.Executor().Get(&dto, fmt.Sprintf(`
+			INSERT INTO %s.ingredients (name) VALUES (TRIM($1))
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id, name
+		`, tx.Config().Schema), ingredient)
+
+		// nothing returned means the conflict clause kicked in
+		if err == sql.ErrNoRows {
+			return domain.ErrAlreadyExists
+		}
+		if err != nil {
+			return fmt.Errorf("could not create ingredient: %v", err)
+		}
+
+		created = r.convertEntry(&dto)
+		return r.record(tx, created.ID, domain.AuditActionCreate, nil, created)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// Rename renames the ingredient with the given id. If another ingredient already
+// carries the new name, both are merged: all icecreams of the renamed ingredient
+// are linked to the existing one and the renamed ingredient gets removed.
+// Every icecream whose ingredients change this way gets a new version.
+func (r *IngredientsRepo) Rename(id int64, name domain.Ingredient) (ingredient *domain.IngredientEntry, err error) {
+
+	err = r.db.Transaction(func(tx storage.Database) error {
+
+		schema := tx.Config().Schema
+
+		before, err := NewIngredientsRepo(tx).ReadById(id)
+		if err != nil {
+			return fmt.Errorf("could not rename ingredient with id = %d: %v", id, err)
+		}
+		if before == nil {
+			return nil
+		}
+
+		icecreams := newIcecreamRepo(tx, r.actor)
+
+		linked, err := icecreams.linked("icecream_has_ingredients", "ingredients_id", id)
+		if err != nil {
+			return fmt.Errorf("could not rename ingredient with id = %d: %v", id, err)
+		}
+
+		var existing dtos.Ingredients
+		err = tx.Executor().Get(&existing, fmt.Sprintf(`
+			SELECT id, name
+			FROM %s.ingredients
+			WHERE name = TRIM($1) AND id <> $2
+		`, schema), name, id)
+
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("could not rename ingredient with id = %d: %v", id, err)
+		}
+
+		if err == sql.ErrNoRows {
+			var renamed dtos.Ingredients
+			err = tx.Executor().Get(&renamed, fmt.Sprintf(`
+				UPDATE %s.ingredients SET name = TRIM($1)
+				WHERE id = $2
+				RETURNING id, name
+			`, schema), name, id)
+
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("could not rename ingredient with id = %d: %v", id, err)
+			}
+
+			ingredient = r.convertEntry(&renamed)
+			if err = r.record(tx, id, domain.AuditActionUpdate, before, ingredient); err != nil {
+				return err
+			}
+
+			return icecreams.changed(linked)
+		}
+
+		_, err = tx.Executor().Exec(fmt.Sprintf(`
+			INSERT INTO %s.icecream_has_ingredients
+				(icecream_product_id, ingredients_id)
+			SELECT icecream_product_id, $1
+			FROM %s.icecream_has_ingredients
+			WHERE ingredients_id = $2
+			ON CONFLICT (icecream_product_id, ingredients_id) DO NOTHING
+		`, schema, schema), existing.Id, id)
+
+		if err != nil {
+			return fmt.Errorf("could not merge ingredient with id = %d into id = %d: %v", id, existing.Id, err)
+		}
+
+		// the old relationships get removed by the cascade
+		result, err := tx.Executor().Exec(fmt.Sprintf(`
+			DELETE FROM %s.ingredients
+			WHERE id = $1
+		`, schema), id)
+
+		if err != nil {
+			return fmt.Errorf("could not merge ingredient with id = %d into id = %d: %v", id, existing.Id, err)
+		}
+
+		affectedRows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not merge ingredient with id = %d into id = %d: %v", id, existing.Id, err)
+		}
+
+		if affectedRows == 0 {
+			return nil
+		}
+
+		ingredient = r.convertEntry(&existing)
+		if err = r.record(tx, id, domain.AuditActionUpdate, before, ingredient); err != nil {
+			return err
+		}
+
+		return icecreams.changed(linked)
+	})
+
+	return ingredient, err
+}
+
+// Delete removes the ingredient with the given id. As long as an icecream
+// references the ingredient it is only removed if force is set.
+// Every icecream losing the ingredient this way gets a new version.
+func (r *IngredientsRepo) Delete(id int64, force bool) error {
+
+	return r.db.Transaction(func(tx storage.Database) error {
+
+		schema := tx.Config().Schema
+
+		before, err := NewIngredientsRepo(tx).ReadById(id)
+		if err != nil {
+			return fmt.Errorf("could not delete ingredient with id = %d: %v", id, err)
+		}
+
+		if !force {
+			var references int64
+			err := tx.Executor().Get(&references, fmt.Sprintf(`
+				SELECT COUNT(*)
+				FROM %s.icecream_has_ingredients
+				WHERE ingredients_id = $1
+			`, schema), id)
+
+			if err != nil {
+				return fmt.Errorf("could not delete ingredient with id = %d: %v", id, err)
+			}
+
+			if references > 0 {
+				return domain.ErrStillReferenced
+			}
+		}
+
+		icecreams := newIcecreamRepo(tx, r.actor)
+
+		linked, err := icecreams.linked("icecream_has_ingredients", "ingredients_id", id)
+		if err != nil {
+			return fmt.Errorf("could not delete ingredient with id = %d: %v", id, err)
+		}
+
+		result, err := tx.Executor().Exec(fmt.Sprintf(`
+			DELETE FROM %s.ingredients
+			WHERE id = $1
+		`, schema), id)
+
+		if err != nil {
+			return fmt.Errorf("could not delete ingredient with id = %d: %v", id, err)
+		}
+
+		affectedRows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not delete ingredient with id = %d: %v", id, err)
+		}
+
+		if affectedRows == 0 {
+			return domain.ErrNotFound
+		}
+
+		if err = r.record(tx, id, domain.AuditActionDelete, before, nil); err != nil {
+			return err
+		}
+
+		return icecreams.changed(linked)
+	})
 }
 
 func (r *IngredientsRepo) convert(ingredients []*dtos.Ingredients) (domain.Ingredients, error) {
@@ -95,3 +379,23 @@ func (r *IngredientsRepo) convert(ingredients []*dtos.Ingredients) (domain.Ingre
 	}
 	return di, nil
 }
+
+func (r *IngredientsRepo) convertEntries(ingredients []*dtos.Ingredients) []*domain.IngredientEntry {
+	entries := []*domain.IngredientEntry{}
+	for _, i := range ingredients {
+		entries = append(entries, r.convertEntry(i))
+	}
+	return entries
+}
+
+func (r *IngredientsRepo) convertEntry(ingredient *dtos.Ingredients) *domain.IngredientEntry {
+	return &domain.IngredientEntry{
+		ID:   ingredient.Id,
+		Name: domain.Ingredient(ingredient.Name),
+	}
+}
+
+// record writes the change of the ingredient into the audit log
+func (r *IngredientsRepo) record(tx storage.Database, id int64, action domain.AuditAction, before, after *domain.IngredientEntry) error {
+	return record(tx, r.actor, domain.AuditEntityIngredient, strconv.FormatInt(id, 10), action, before, after)
+}
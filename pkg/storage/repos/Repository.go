@@ -13,16 +13,26 @@ type Repository struct {
 	SourcingValueService             domain.SourcingValueService
 	IcecreamHasIngredientsService    domain.IcecreamHasIngredientsService
 	IcecreamHasSourcingValuesService domain.IcecreamHasSourcingValuesService
+	AuditService                     domain.AuditService
+	IcecreamRevisionService          domain.IcecreamRevisionService
+	UserService                      domain.UserService
+	APIKeyService                    domain.APIKeyService
+
+	// as creates the services acting on behalf of an actor
+	as func(actor *domain.Actor) *Repository
 }
 
 func NewRepository(db storage.Database) (*Repository, error) {
-	s := &Repository{
-		IcecreamService:                  NewIcecreamRepo(db),
-		IngredientService:                NewIngredientsRepo(db),
-		SourcingValueService:             NewSourcingValuesRepo(db),
-		IcecreamHasIngredientsService:    NewIcecreamHasIngredientsRepo(db),
-		IcecreamHasSourcingValuesService: NewIcecreamHasSourcingValuesRepo(db),
-	}
+	return NewRepositoryFunc(func(actor *domain.Actor) *Repository {
+		return newRepository(db, actor)
+	})
+}
+
+// NewRepositoryFunc creates a Repository of the services which newServices returns,
+// e.g. of another storage. newServices is called for every actor in As, nil for none.
+func NewRepositoryFunc(newServices func(actor *domain.Actor) *Repository) (*Repository, error) {
+	s := newServices(nil)
+	s.as = newServices
 
 	if err := s.Verify(); err != nil {
 		return nil, err
@@ -31,6 +41,41 @@ func NewRepository(db storage.Database) (*Repository, error) {
 	return s, nil
 }
 
+func newRepository(db storage.Database, actor *domain.Actor) *Repository {
+
+	icecreams := newIcecreamRepo(db, actor)
+
+	ingredients := NewIngredientsRepo(db)
+	ingredients.actor = actor
+
+	sourcingValues := NewSourcingValuesRepo(db)
+	sourcingValues.actor = actor
+
+	return &Repository{
+		IcecreamService:                  icecreams,
+		IngredientService:                ingredients,
+		SourcingValueService:             sourcingValues,
+		IcecreamHasIngredientsService:    NewIcecreamHasIngredientsRepo(db),
+		IcecreamHasSourcingValuesService: NewIcecreamHasSourcingValuesRepo(db),
+		AuditService:                     NewAuditRepo(db),
+		IcecreamRevisionService:          NewIcecreamRevisionsRepo(db),
+		UserService:                      NewUsersRepo(db),
+		APIKeyService:                    NewAPIKeysRepo(db),
+	}
+}
+
+// As returns a Repository whose changes are recorded in the audit log on behalf
+// of the actor. A Repository not created by NewRepository or NewRepositoryFunc,
+// e.g. one made of mocks, is returned as it is.
+func (s *Repository) As(actor *domain.Actor) *Repository {
+	if s.as == nil {
+		return s
+	}
+	r := s.as(actor)
+	r.as = s.as
+	return r
+}
+
 func (s *Repository) Verify() error {
 	if s.IcecreamService == nil {
 		return fmt.Errorf("no IcecreamService given")
@@ -47,5 +92,17 @@ func (s *Repository) Verify() error {
 	if s.IcecreamHasSourcingValuesService == nil {
 		return fmt.Errorf("no IcecreamHasSourcingValuesService given")
 	}
+	if s.AuditService == nil {
+		return fmt.Errorf("no AuditService given")
+	}
+	if s.IcecreamRevisionService == nil {
+		return fmt.Errorf("no IcecreamRevisionService given")
+	}
+	if s.UserService == nil {
+		return fmt.Errorf("no UserService given")
+	}
+	if s.APIKeyService == nil {
+		return fmt.Errorf("no APIKeyService given")
+	}
 	return nil
 }
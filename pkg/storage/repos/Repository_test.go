@@ -0,0 +1,78 @@
+package repos_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/migrations"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos/repotest"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresDSN names the environment variable with the dsn of a postgres database to
+// run the tests against. The tests drop and recreate the schema zlr_ca in it!
+const postgresDSN = "ZLR_TEST_POSTGRES_DSN"
+
+func TestRepository_withPostgres(t *testing.T) {
+
+	dsn := os.Getenv(postgresDSN)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresDSN)
+	}
+
+	db, err := storage.NewPostgres(&storage.Config{DSN: dsn, Schema: "zlr_ca"})
+	require.NoError(t, err)
+	defer db.Close()
+
+	repotest.Run(t, func(t *testing.T) *repos.Repository {
+
+		// every test starts with a fresh schema
+		_, err := db.DB().Exec("DROP SCHEMA IF EXISTS zlr_ca CASCADE")
+		require.NoError(t, err)
+		migrate(t, db)
+
+		repo, err := repos.NewRepository(db)
+		require.NoError(t, err)
+
+		return repo
+	})
+}
+
+func TestRepository_withSQLite(t *testing.T) {
+
+	probe, err := storage.NewSQLite(&storage.Config{Driver: "sqlite", DSN: ":memory:"})
+	if err == storage.ErrNoSQLite {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	probe.Close()
+
+	var databases []storage.Database
+	defer func() {
+		for _, db := range databases {
+			db.Close()
+		}
+	}()
+
+	repotest.Run(t, func(t *testing.T) *repos.Repository {
+
+		db, err := storage.NewSQLite(&storage.Config{Driver: "sqlite", DSN: ":memory:"})
+		require.NoError(t, err)
+		databases = append(databases, db)
+		migrate(t, db)
+
+		repo, err := repos.NewRepository(db)
+		require.NoError(t, err)
+
+		return repo
+	})
+}
+
+func migrate(t *testing.T, db storage.Database) {
+	migrator, err := migrations.NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up()
+	require.NoError(t, err)
+}
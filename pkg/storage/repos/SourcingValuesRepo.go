@@ -1,15 +1,19 @@
 package repos
 
 import (
+	"database/sql"
 	"fmt"
+	"strconv"
 
 	"github.com/fraenky8/zlr-ca/pkg/domain"
 	"github.com/fraenky8/zlr-ca/pkg/storage"
 	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+	"github.com/jmoiron/sqlx"
 )
 
 type SourcingValuesRepo struct {
-	db storage.Database
+	db    storage.Database
+	actor *domain.Actor
 }
 
 func NewSourcingValuesRepo(db storage.Database) *SourcingValuesRepo {
@@ -18,25 +22,60 @@ func NewSourcingValuesRepo(db storage.Database) *SourcingValuesRepo {
 	}
 }
 
-func (r *SourcingValuesRepo) Creates(sourcingValues domain.SourcingValues) ([]int64, error) {
+// Creates returns the ids of the sourcing values, the missing ones get created
+func (r *SourcingValuesRepo) Creates(sourcingValues domain.SourcingValues) (ids []int64, err error) {
 
-	stmt, err := r.db.DB().Preparex(fmt.Sprintf(`
-		INSERT INTO %s.sourcing_values (description) VALUES (TRIM($1)) 
-		ON CONFLICT (description) DO UPDATE SET description = TRIM($1) RETURNING id
-	`, r.db.Config().Schema))
+	err = r.db.Transaction(func(tx storage.Database) error {
 
-	if err != nil {
-		return nil, fmt.Errorf("could not prepare statement: %v", err)
-	}
+		insert, err := tx.Executor().Preparex(fmt.Sprintf(`
+			INSERT INTO %s.sourcing_values (description) VALUES (TRIM($1))
+			ON CONFLICT (description) DO NOTHING
+			RETURNING id, description
+		`, tx.Config().Schema))
 
-	var ids []int64
-	for _, sourcingValue := range sourcingValues {
-		var id int64
-		err := stmt.Get(&id, sourcingValue)
 		if err != nil {
-			return nil, fmt.Errorf("could not create sourcing value: %v", err)
+			return fmt.Errorf("could not prepare statement: %v", err)
 		}
-		ids = append(ids, id)
+
+		existing, err := tx.Executor().Preparex(fmt.Sprintf(`
+			SELECT id FROM %s.sourcing_values WHERE description = TRIM($1)
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for _, sourcingValue := range sourcingValues {
+
+			var dto dtos.SourcingValues
+			err := insert.Get(&dto, sourcingValue)
+
+			// nothing returned means the sourcing value exists already
+			if err == sql.ErrNoRows {
+				var id int64
+				if err = existing.Get(&id, sourcingValue); err != nil {
+					return fmt.Errorf("could not read sourcing value %s: %v", sourcingValue, err)
+				}
+				ids = append(ids, id)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("could not create sourcing value: %v", err)
+			}
+
+			created := r.convertEntry(&dto)
+			if err = r.record(tx, created.ID, domain.AuditActionCreate, nil, created); err != nil {
+				return err
+			}
+
+			ids = append(ids, created.ID)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
 	return ids, nil
@@ -45,7 +84,7 @@ func (r *SourcingValuesRepo) Creates(sourcingValues domain.SourcingValues) ([]in
 func (r *SourcingValuesRepo) Read(icecreamProductId int64) (domain.SourcingValues, error) {
 
 	var sourcingValues []*dtos.SourcingValues
-	err := r.db.DB().Select(&sourcingValues, fmt.Sprintf(`
+	err := r.db.Executor().Select(&sourcingValues, fmt.Sprintf(`
 		SELECT
   			id, description
 		FROM
@@ -62,59 +101,298 @@ func (r *SourcingValuesRepo) Read(icecreamProductId int64) (domain.SourcingValue
 	return r.convert(sourcingValues)
 }
 
-func (r *SourcingValuesRepo) Reads(icecreamProductIds []int64) (sourcingValues []domain.SourcingValues, err error) {
+// Reads returns the sourcing values of all given icecreams keyed by their product id.
+// Icecreams without any sourcing value are contained with an empty list.
+func (r *SourcingValuesRepo) Reads(icecreamProductIds []int64) (map[int64]domain.SourcingValues, error) {
+
+	sourcingValues := make(map[int64]domain.SourcingValues)
+	if len(icecreamProductIds) == 0 {
+		return sourcingValues, nil
+	}
+
+	query, args, err := sqlx.In(fmt.Sprintf(`
+		SELECT
+			ihsv.icecream_product_id, sv.id, sv.description
+		FROM
+			%s.sourcing_values AS sv,
+			%s.icecream_has_sourcing_values AS ihsv
+		WHERE ihsv.sourcing_values_id = sv.id
+		AND ihsv.icecream_product_id IN (?)
+		ORDER BY sv.id
+	`, r.db.Config().Schema, r.db.Config().Schema), icecreamProductIds)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*dtos.IcecreamSourcingValue
+	if err = r.db.Executor().Select(&rows, r.db.Executor().Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
 	for _, id := range icecreamProductIds {
-		sourcingValue, err := r.Read(id)
-		if err != nil {
-			return nil, err
-		}
-		sourcingValues = append(sourcingValues, sourcingValue)
+		sourcingValues[id] = domain.SourcingValues{}
+	}
+
+	for _, row := range rows {
+		sourcingValues[row.IcecreamProductId] = append(sourcingValues[row.IcecreamProductId], domain.SourcingValue(row.Description))
 	}
+
 	return sourcingValues, nil
 }
 
-func (r *SourcingValuesRepo) ReadAll() (domain.SourcingValues, error) {
+func (r *SourcingValuesRepo) ReadAll() ([]*domain.SourcingValueEntry, error) {
 
 	var sourcingValues []*dtos.SourcingValues
-	err := r.db.DB().Select(&sourcingValues, fmt.Sprintf(`
+	err := r.db.Executor().Select(&sourcingValues, fmt.Sprintf(`
 		SELECT id, description
 		FROM %s.sourcing_values
+		ORDER BY id
 	`, r.db.Config().Schema))
 
 	if err != nil {
 		return nil, err
 	}
 
-	return r.convert(sourcingValues)
+	return r.convertEntries(sourcingValues), nil
 }
 
-func (r *SourcingValuesRepo) Deletes(icecreamProductIds []int64) (err error) {
+func (r *SourcingValuesRepo) ReadById(id int64) (*domain.SourcingValueEntry, error) {
 
-	tx := r.db.DB().MustBegin()
-	defer func() {
+	var sourcingValue dtos.SourcingValues
+	err := r.db.Executor().Get(&sourcingValue, fmt.Sprintf(`
+		SELECT id, description
+		FROM %s.sourcing_values
+		WHERE id = $1
+	`, r.db.Config().Schema), id)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convertEntry(&sourcingValue), nil
+}
+
+func (r *SourcingValuesRepo) Create(sourcingValue domain.SourcingValue) (created *domain.SourcingValueEntry, err error) {
+
+	err = r.db.Transaction(func(tx storage.Database) error {
+
+		var dto dtos.SourcingValues
+		err := tx.Executor().Get(&dto, fmt.Sprintf(`
+			INSERT INTO %s.sourcing_values (description) VALUES (TRIM($1))
+			ON CONFLICT (description) DO NOTHING
+			RETURNING id, description
+		`, tx.Config().Schema), sourcingValue)
+
+		// nothing returned means the conflict clause kicked in
+		if err == sql.ErrNoRows {
+			return domain.ErrAlreadyExists
+		}
 		if err != nil {
-			tx.Rollback()
-			return
+			return fmt.Errorf("could not create sourcing value: %v", err)
 		}
-		tx.Commit()
-	}()
 
-	stmt, err := r.db.DB().Preparex(fmt.Sprintf(`
-		DELETE FROM %s.icecream_has_sourcing_values
-		WHERE icecream_product_id = $1
-	`, r.db.Config().Schema))
+		created = r.convertEntry(&dto)
+		return r.record(tx, created.ID, domain.AuditActionCreate, nil, created)
+	})
 
 	if err != nil {
-		return fmt.Errorf("could not prepare statement: %v", err)
+		return nil, err
 	}
 
-	for _, id := range icecreamProductIds {
-		if _, err := stmt.Exec(id); err != nil {
-			return fmt.Errorf("could not delete sourcing values of icecream with productID = %d: %v", id, err)
+	return created, nil
+}
+
+// Rename changes the description of the sourcing value with the given id. If another
+// sourcing value already carries the new description, both are merged: all icecreams
+// of the renamed sourcing value are linked to the existing one and it gets removed.
+// Every icecream whose sourcing values change this way gets a new version.
+func (r *SourcingValuesRepo) Rename(id int64, description domain.SourcingValue) (sourcingValue *domain.SourcingValueEntry, err error) {
+
+	err = r.db.Transaction(func(tx storage.Database) error {
+
+		schema := tx.Config().Schema
+
+		before, err := NewSourcingValuesRepo(tx).ReadById(id)
+		if err != nil {
+			return fmt.Errorf("could not rename sourcing value with id = %d: %v", id, err)
+		}
+		if before == nil {
+			return nil
+		}
+
+		icecreams := newIcecreamRepo(tx, r.actor)
+
+		linked, err := icecreams.linked("icecream_has_sourcing_values", "sourcing_values_id", id)
+		if err != nil {
+			return fmt.Errorf("could not rename sourcing value with id = %d: %v", id, err)
+		}
+
+		var existing dtos.SourcingValues
+		err = tx.Executor().Get(&existing, fmt.Sprintf(`
+			SELECT id, description
+			FROM %s.sourcing_values
+			WHERE description = TRIM($1) AND id <> $2
+		`, schema), description, id)
+
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("could not rename sourcing value with id = %d: %v", id, err)
+		}
+
+		if err == sql.ErrNoRows {
+			var renamed dtos.SourcingValues
+			err = tx.Executor().Get(&renamed, fmt.Sprintf(`
+				UPDATE %s.sourcing_values SET description = TRIM($1)
+				WHERE id = $2
+				RETURNING id, description
+			`, schema), description, id)
+
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("could not rename sourcing value with id = %d: %v", id, err)
+			}
+
+			sourcingValue = r.convertEntry(&renamed)
+			if err = r.record(tx, id, domain.AuditActionUpdate, before, sourcingValue); err != nil {
+				return err
+			}
+
+			return icecreams.changed(linked)
+		}
+
+		_, err = tx.Executor().Exec(fmt.Sprintf(`
+			INSERT INTO %s.icecream_has_sourcing_values
+				(icecream_product_id, sourcing_values_id)
+			SELECT icecream_product_id, $1
+			FROM %s.icecream_has_sourcing_values
+			WHERE sourcing_values_id = $2
+			ON CONFLICT (icecream_product_id, sourcing_values_id) DO NOTHING
+		`, schema, schema), existing.Id, id)
+
+		if err != nil {
+			return fmt.Errorf("could not merge sourcing value with id = %d into id = %d: %v", id, existing.Id, err)
+		}
+
+		// the old relationships get removed by the cascade
+		result, err := tx.Executor().Exec(fmt.Sprintf(`
+			DELETE FROM %s.sourcing_values
+			WHERE id = $1
+		`, schema), id)
+
+		if err != nil {
+			return fmt.Errorf("could not merge sourcing value with id = %d into id = %d: %v", id, existing.Id, err)
+		}
+
+		affectedRows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not merge sourcing value with id = %d into id = %d: %v", id, existing.Id, err)
+		}
+
+		if affectedRows == 0 {
+			return nil
+		}
+
+		sourcingValue = r.convertEntry(&existing)
+		if err = r.record(tx, id, domain.AuditActionUpdate, before, sourcingValue); err != nil {
+			return err
+		}
+
+		return icecreams.changed(linked)
+	})
+
+	return sourcingValue, err
+}
+
+// Delete removes the sourcing value with the given id. As long as an icecream
+// references the sourcing value it is only removed if force is set.
+// Every icecream losing the sourcing value this way gets a new version.
+func (r *SourcingValuesRepo) Delete(id int64, force bool) error {
+
+	return r.db.Transaction(func(tx storage.Database) error {
+
+		schema := tx.Config().Schema
+
+		before, err := NewSourcingValuesRepo(tx).ReadById(id)
+		if err != nil {
+			return fmt.Errorf("could not delete sourcing value with id = %d: %v", id, err)
+		}
+
+		if !force {
+			var references int64
+			err := tx.Executor().Get(&references, fmt.Sprintf(`
+				SELECT COUNT(*)
+				FROM %s.icecream_has_sourcing_values
+				WHERE sourcing_values_id = $1
+			`, schema), id)
+
+			if err != nil {
+				return fmt.Errorf("could not delete sourcing value with id = %d: %v", id, err)
+			}
+
+			if references > 0 {
+				return domain.ErrStillReferenced
+			}
 		}
-	}
 
-	return nil
+		icecreams := newIcecreamRepo(tx, r.actor)
+
+		linked, err := icecreams.linked("icecream_has_sourcing_values", "sourcing_values_id", id)
+		if err != nil {
+			return fmt.Errorf("could not delete sourcing value with id = %d: %v", id, err)
+		}
+
+		result, err := tx.Executor().Exec(fmt.Sprintf(`
+			DELETE FROM %s.sourcing_values
+			WHERE id = $1
+		`, schema), id)
+
+		if err != nil {
+			return fmt.Errorf("could not delete sourcing value with id = %d: %v", id, err)
+		}
+
+		affectedRows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not delete sourcing value with id = %d: %v", id, err)
+		}
+
+		if affectedRows == 0 {
+			return domain.ErrNotFound
+		}
+
+		if err = r.record(tx, id, domain.AuditActionDelete, before, nil); err != nil {
+			return err
+		}
+
+		return icecreams.changed(linked)
+	})
+}
+
+func (r *SourcingValuesRepo) Deletes(icecreamProductIds []int64) error {
+
+	return r.db.Transaction(func(tx storage.Database) error {
+
+		stmt, err := tx.Executor().Preparex(fmt.Sprintf(`
+			DELETE FROM %s.icecream_has_sourcing_values
+			WHERE icecream_product_id = $1
+		`, tx.Config().Schema))
+
+		if err != nil {
+			return fmt.Errorf("could not prepare statement: %v", err)
+		}
+
+		for _, id := range icecreamProductIds {
+			if _, err := stmt.Exec(id); err != nil {
+				return fmt.Errorf("could not delete sourcing values of icecream with productID = %d: %v", id, err)
+			}
+		}
+
+		return nil
+	})
 }
 
 func (r *SourcingValuesRepo) convert(sourcingValues []*dtos.SourcingValues) (domain.SourcingValues, error) {
@@ -124,3 +402,23 @@ func (r *SourcingValuesRepo) convert(sourcingValues []*dtos.SourcingValues) (dom
 	}
 	return sv, nil
 }
+
+func (r *SourcingValuesRepo) convertEntries(sourcingValues []*dtos.SourcingValues) []*domain.SourcingValueEntry {
+	entries := []*domain.SourcingValueEntry{}
+	for _, i := range sourcingValues {
+		entries = append(entries, r.convertEntry(i))
+	}
+	return entries
+}
+
+func (r *SourcingValuesRepo) convertEntry(sourcingValue *dtos.SourcingValues) *domain.SourcingValueEntry {
+	return &domain.SourcingValueEntry{
+		ID:          sourcingValue.Id,
+		Description: domain.SourcingValue(sourcingValue.Description),
+	}
+}
+
+// record writes the change of the sourcing value into the audit log
+func (r *SourcingValuesRepo) record(tx storage.Database, id int64, action domain.AuditAction, before, after *domain.SourcingValueEntry) error {
+	return record(tx, r.actor, domain.AuditEntitySourcingValue, strconv.FormatInt(id, 10), action, before, after)
+}
@@ -0,0 +1,142 @@
+package repos
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage"
+	"github.com/fraenky8/zlr-ca/pkg/storage/dtos"
+)
+
+type UsersRepo struct {
+	db storage.Database
+}
+
+func NewUsersRepo(db storage.Database) *UsersRepo {
+	return &UsersRepo{
+		db: db,
+	}
+}
+
+func (r *UsersRepo) Create(username string, passwordHash []byte, role domain.Role) (*domain.User, error) {
+
+	var created dtos.User
+	err := r.db.Executor().Get(&created, fmt.Sprintf(`
+		INSERT INTO %s.users (username, password_hash, role) VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO NOTHING
+		RETURNING id, username, password_hash, role, disabled, failed_logins, locked_until
+	`, r.db.Config().Schema), username, string(passwordHash), role)
+
+	// nothing returned means the conflict clause kicked in
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create user: %v", err)
+	}
+
+	return r.convert(&created), nil
+}
+
+func (r *UsersRepo) Read(username string) (*domain.User, error) {
+
+	var user dtos.User
+	err := r.db.Executor().Get(&user, fmt.Sprintf(`
+		SELECT id, username, password_hash, role, disabled, failed_logins, locked_until
+		FROM %s.users
+		WHERE username = $1
+	`, r.db.Config().Schema), username)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r.convert(&user), nil
+}
+
+func (r *UsersRepo) ReadAll() ([]*domain.User, error) {
+
+	var users []*dtos.User
+	err := r.db.Executor().Select(&users, fmt.Sprintf(`
+		SELECT id, username, password_hash, role, disabled, failed_logins, locked_until
+		FROM %s.users
+		ORDER BY username
+	`, r.db.Config().Schema))
+
+	if err != nil {
+		return nil, err
+	}
+
+	all := []*domain.User{}
+	for _, user := range users {
+		all = append(all, r.convert(user))
+	}
+
+	return all, nil
+}
+
+// SetPassword changes the password of the user and lifts a lock
+func (r *UsersRepo) SetPassword(username string, passwordHash []byte) error {
+	return r.update(username, `password_hash = $2, failed_logins = 0, locked_until = NULL`, string(passwordHash))
+}
+
+func (r *UsersRepo) SetDisabled(username string, disabled bool) error {
+	return r.update(username, `disabled = $2`, disabled)
+}
+
+func (r *UsersRepo) SetRole(username string, role domain.Role) error {
+	return r.update(username, `role = $2`, role)
+}
+
+// LoginFailed counts a failed login of the user. With the maxFailures-th failure
+// in a row the user gets locked for the lockout duration and the count starts over.
+func (r *UsersRepo) LoginFailed(username string, maxFailures int, lockout time.Duration) error {
+	return r.update(username, `
+		locked_until = CASE WHEN failed_logins + 1 >= $2 THEN $3 ELSE locked_until END,
+		failed_logins = CASE WHEN failed_logins + 1 >= $2 THEN 0 ELSE failed_logins + 1 END
+	`, maxFailures, r.db.Dialect().Time(time.Now().Add(lockout)))
+}
+
+func (r *UsersRepo) LoginSucceeded(username string) error {
+	return r.update(username, `failed_logins = 0, locked_until = NULL`)
+}
+
+func (r *UsersRepo) update(username string, sets string, args ...interface{}) error {
+
+	result, err := r.db.Executor().Exec(fmt.Sprintf(`
+		UPDATE %s.users SET %s
+		WHERE username = $1
+	`, r.db.Config().Schema, sets), append([]interface{}{username}, args...)...)
+
+	if err != nil {
+		return fmt.Errorf("could not update user %s: %v", username, err)
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not update user %s: %v", username, err)
+	}
+
+	if affectedRows == 0 {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	return nil
+}
+
+func (r *UsersRepo) convert(user *dtos.User) *domain.User {
+	return &domain.User{
+		ID:           user.Id,
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         domain.Role(user.Role),
+		Disabled:     user.Disabled,
+		FailedLogins: user.FailedLogins,
+		LockedUntil:  user.LockedUntil,
+	}
+}
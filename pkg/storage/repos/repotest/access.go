@@ -0,0 +1,306 @@
+package repotest
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var accessTests = []test{
+	{"UserService/Create_withNewUsername_returnsUser", testUserCreateWithNewUsername},
+	{"UserService/Create_withExistingUsername_returnsErrAlreadyExists", testUserCreateWithExistingUsername},
+	{"UserService/Read_withUnknownUsername_returnsNothing", testUserReadWithUnknownUsername},
+	{"UserService/ReadAll_withUsers_returnsThemOrderedByUsername", testUsersReadAll},
+	{"UserService/SetRoleAndSetDisabled_withUser_changesUser", testUserSetRoleAndSetDisabled},
+	{"UserService/LoginFailed_withMaxFailures_locksUser", testUserLoginFailedWithMaxFailures},
+	{"UserService/LoginSucceeded_withFailedLogins_resetsThem", testUserLoginSucceededWithFailedLogins},
+	{"UserService/SetPassword_withLockedUser_liftsLock", testUserSetPasswordWithLockedUser},
+	{"UserService/Set_withUnknownUsername_returnsError", testUserSetWithUnknownUsername},
+	{"APIKeyService/Create_withNewName_returnsAPIKey", testAPIKeyCreateWithNewName},
+	{"APIKeyService/Create_withExistingName_returnsErrAlreadyExists", testAPIKeyCreateWithExistingName},
+	{"APIKeyService/ReadAll_withAPIKeys_returnsThemOrderedById", testAPIKeysReadAll},
+	{"APIKeyService/ReadById_withUnknownId_returnsNothing", testAPIKeyReadByIdWithUnknownId},
+	{"APIKeyService/Delete_withAPIKey_removesIt", testAPIKeyDelete},
+	{"APIKeyService/Delete_withUnknownId_returnsError", testAPIKeyDeleteWithUnknownId},
+}
+
+func testUserCreateWithNewUsername(t *testing.T, repo *repos.Repository) {
+
+	// when
+	user, err := repo.UserService.Create("zoe", []byte("hash"), domain.RoleEditor)
+
+	// then
+	assert.NoError(t, err)
+	if assert.NotNil(t, user) {
+		assert.NotZero(t, user.ID)
+		assert.Equal(t, "zoe", user.Username)
+		assert.Equal(t, []byte("hash"), user.PasswordHash)
+		assert.Equal(t, domain.RoleEditor, user.Role)
+		assert.False(t, user.Disabled)
+		assert.Zero(t, user.FailedLogins)
+		assert.Nil(t, user.LockedUntil)
+	}
+
+	read, err := repo.UserService.Read("zoe")
+	assert.NoError(t, err)
+	assert.Equal(t, user, read)
+}
+
+func testUserCreateWithExistingUsername(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createUser(t, repo, "zoe")
+
+	// when
+	user, err := repo.UserService.Create("zoe", []byte("other hash"), domain.RoleAdmin)
+
+	// then
+	assert.Equal(t, domain.ErrAlreadyExists, err)
+	assert.Nil(t, user)
+	assert.Equal(t, domain.RoleViewer, readUser(t, repo, "zoe").Role)
+}
+
+func testUserReadWithUnknownUsername(t *testing.T, repo *repos.Repository) {
+
+	// when
+	user, err := repo.UserService.Read("nobody")
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func testUsersReadAll(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createUser(t, repo, "zoe")
+	createUser(t, repo, "adam")
+
+	// when
+	users, err := repo.UserService.ReadAll()
+
+	// then
+	assert.NoError(t, err)
+
+	var usernames []string
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	assert.Contains(t, usernames, "zoe")
+	assert.Contains(t, usernames, "adam")
+	assert.True(t, sort.StringsAreSorted(usernames), "%v", usernames)
+}
+
+func testUserSetRoleAndSetDisabled(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createUser(t, repo, "zoe")
+
+	// when
+	roleErr := repo.UserService.SetRole("zoe", domain.RoleAdmin)
+	disabledErr := repo.UserService.SetDisabled("zoe", true)
+
+	// then
+	assert.NoError(t, roleErr)
+	assert.NoError(t, disabledErr)
+
+	user := readUser(t, repo, "zoe")
+	assert.Equal(t, domain.RoleAdmin, user.Role)
+	assert.True(t, user.Disabled)
+}
+
+func testUserLoginFailedWithMaxFailures(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createUser(t, repo, "zoe")
+	require.NoError(t, repo.UserService.LoginFailed("zoe", 3, time.Hour))
+	require.NoError(t, repo.UserService.LoginFailed("zoe", 3, time.Hour))
+
+	notYetLocked := readUser(t, repo, "zoe")
+
+	// when
+	err := repo.UserService.LoginFailed("zoe", 3, time.Hour)
+
+	// then
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, notYetLocked.FailedLogins)
+	assert.False(t, notYetLocked.Locked(time.Now()))
+
+	locked := readUser(t, repo, "zoe")
+	assert.Zero(t, locked.FailedLogins)
+	assert.True(t, locked.Locked(time.Now()))
+	assert.False(t, locked.Locked(time.Now().Add(2*time.Hour)))
+}
+
+func testUserLoginSucceededWithFailedLogins(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createUser(t, repo, "zoe")
+	require.NoError(t, repo.UserService.LoginFailed("zoe", 3, time.Hour))
+
+	// when
+	err := repo.UserService.LoginSucceeded("zoe")
+
+	// then
+	assert.NoError(t, err)
+	assert.Zero(t, readUser(t, repo, "zoe").FailedLogins)
+}
+
+func testUserSetPasswordWithLockedUser(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createUser(t, repo, "zoe")
+	require.NoError(t, repo.UserService.LoginFailed("zoe", 1, time.Hour))
+	require.True(t, readUser(t, repo, "zoe").Locked(time.Now()))
+
+	// when
+	err := repo.UserService.SetPassword("zoe", []byte("new hash"))
+
+	// then
+	assert.NoError(t, err)
+
+	user := readUser(t, repo, "zoe")
+	assert.Equal(t, []byte("new hash"), user.PasswordHash)
+	assert.False(t, user.Locked(time.Now()))
+}
+
+func testUserSetWithUnknownUsername(t *testing.T, repo *repos.Repository) {
+
+	// when
+	errs := []error{
+		repo.UserService.SetPassword("nobody", []byte("hash")),
+		repo.UserService.SetDisabled("nobody", true),
+		repo.UserService.SetRole("nobody", domain.RoleAdmin),
+		repo.UserService.LoginFailed("nobody", 3, time.Hour),
+		repo.UserService.LoginSucceeded("nobody"),
+	}
+
+	// then
+	for _, err := range errs {
+		assert.Error(t, err)
+	}
+}
+
+func testAPIKeyCreateWithNewName(t *testing.T, repo *repos.Repository) {
+
+	// when
+	apiKey, err := repo.APIKeyService.Create(newAPIKey(" kiosk ", "hash-1"))
+
+	// then
+	assert.NoError(t, err)
+	if assert.NotNil(t, apiKey) {
+		assert.NotZero(t, apiKey.ID)
+		assert.Equal(t, "kiosk", apiKey.Name)
+		assert.Equal(t, "zlr_abc", apiKey.Prefix)
+		assert.Equal(t, domain.RoleViewer, apiKey.Role)
+		assert.Equal(t, "hash-1", apiKey.Hash)
+		assert.Equal(t, "frank", apiKey.CreatedBy)
+		assert.False(t, apiKey.CreatedAt.IsZero())
+	}
+
+	byHash, err := repo.APIKeyService.ReadByHash("hash-1")
+	assert.NoError(t, err)
+	assert.Equal(t, apiKey, byHash)
+
+	byId, err := repo.APIKeyService.ReadById(apiKey.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apiKey, byId)
+}
+
+func testAPIKeyCreateWithExistingName(t *testing.T, repo *repos.Repository) {
+
+	// given
+	_, err := repo.APIKeyService.Create(newAPIKey("kiosk", "hash-1"))
+	require.NoError(t, err)
+
+	// when
+	apiKey, err := repo.APIKeyService.Create(newAPIKey("kiosk ", "hash-2"))
+
+	// then
+	assert.Equal(t, domain.ErrAlreadyExists, err)
+	assert.Nil(t, apiKey)
+
+	unknown, err := repo.APIKeyService.ReadByHash("hash-2")
+	assert.NoError(t, err)
+	assert.Nil(t, unknown)
+}
+
+func testAPIKeysReadAll(t *testing.T, repo *repos.Repository) {
+
+	// given
+	kiosk, err := repo.APIKeyService.Create(newAPIKey("kiosk", "hash-1"))
+	require.NoError(t, err)
+	importer, err := repo.APIKeyService.Create(newAPIKey("importer", "hash-2"))
+	require.NoError(t, err)
+
+	// when
+	apiKeys, err := repo.APIKeyService.ReadAll()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*domain.APIKey{kiosk, importer}, apiKeys)
+}
+
+func testAPIKeyReadByIdWithUnknownId(t *testing.T, repo *repos.Repository) {
+
+	// when
+	apiKey, err := repo.APIKeyService.ReadById(42)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, apiKey)
+}
+
+func testAPIKeyDelete(t *testing.T, repo *repos.Repository) {
+
+	// given
+	apiKey, err := repo.APIKeyService.Create(newAPIKey("kiosk", "hash-1"))
+	require.NoError(t, err)
+
+	// when
+	err = repo.APIKeyService.Delete(apiKey.ID)
+
+	// then
+	assert.NoError(t, err)
+
+	deleted, err := repo.APIKeyService.ReadByHash("hash-1")
+	assert.NoError(t, err)
+	assert.Nil(t, deleted)
+}
+
+func testAPIKeyDeleteWithUnknownId(t *testing.T, repo *repos.Repository) {
+
+	// when
+	err := repo.APIKeyService.Delete(42)
+
+	// then
+	assert.Error(t, err)
+}
+
+func createUser(t *testing.T, repo *repos.Repository, username string) {
+	_, err := repo.UserService.Create(username, []byte("hash"), domain.RoleViewer)
+	require.NoError(t, err)
+}
+
+func readUser(t *testing.T, repo *repos.Repository, username string) *domain.User {
+	user, err := repo.UserService.Read(username)
+	require.NoError(t, err)
+	require.NotNil(t, user, "user %s does not exist", username)
+	return user
+}
+
+func newAPIKey(name, hash string) *domain.APIKey {
+	return &domain.APIKey{
+		Name:      name,
+		Prefix:    "zlr_abc",
+		Role:      domain.RoleViewer,
+		Hash:      hash,
+		CreatedBy: "frank",
+	}
+}
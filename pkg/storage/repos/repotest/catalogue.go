@@ -0,0 +1,373 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var catalogueTests = []test{
+	{"IngredientService/Creates_withExistingIngredients_returnsTheirIds", testIngredientsCreatesWithExistingIngredients},
+	{"IngredientService/Create_withUntrimmedName_storesTrimmedName", testIngredientCreateWithUntrimmedName},
+	{"IngredientService/Create_withExistingName_returnsErrAlreadyExists", testIngredientCreateWithExistingName},
+	{"IngredientService/ReadAll_withIngredients_returnsThemOrderedById", testIngredientsReadAll},
+	{"IngredientService/ReadById_withUnknownId_returnsNothing", testIngredientReadByIdWithUnknownId},
+	{"IngredientService/Reads_withIcecreams_returnsIngredientsOfEachIcecream", testIngredientsReads},
+	{"IngredientService/Rename_withNewName_renamesIngredient", testIngredientRenameWithNewName},
+	{"IngredientService/Rename_withExistingName_mergesIngredients", testIngredientRenameWithExistingName},
+	{"IngredientService/Rename_withUnknownId_returnsNothing", testIngredientRenameWithUnknownId},
+	{"IngredientService/Delete_withReferencedIngredient_returnsErrStillReferenced", testIngredientDeleteWithReferencedIngredient},
+	{"IngredientService/Delete_withForce_removesIngredientFromIcecreams", testIngredientDeleteWithForce},
+	{"IngredientService/Delete_withUnknownId_returnsErrNotFound", testIngredientDeleteWithUnknownId},
+	{"SourcingValueService/Create_withExistingDescription_returnsErrAlreadyExists", testSourcingValueCreateWithExistingDescription},
+	{"SourcingValueService/Rename_withExistingDescription_mergesSourcingValues", testSourcingValueRenameWithExistingDescription},
+	{"SourcingValueService/Delete_withReferencedSourcingValue_returnsErrStillReferenced", testSourcingValueDeleteWithReferencedSourcingValue},
+	{"SourcingValueService/Deletes_withIcecreams_removesAllTheirSourcingValues", testSourcingValuesDeletes},
+	{"IcecreamHasIngredientsService/Create_withUnknownIngredient_returnsError", testIcecreamHasIngredientsCreateWithUnknownIngredient},
+	{"IcecreamHasIngredientsService/Deletes_withIngredient_returnsNumberOfRemovedRelations", testIcecreamHasIngredientsDeletes},
+	{"IcecreamHasSourcingValuesService/Deletes_withSourcingValue_returnsNumberOfRemovedRelations", testIcecreamHasSourcingValuesDeletes},
+}
+
+func testIngredientsCreatesWithExistingIngredients(t *testing.T, repo *repos.Repository) {
+
+	// given
+	milk := createIngredient(t, repo, "milk")
+
+	// when
+	ids, err := repo.IngredientService.Creates(domain.Ingredients{"cream", " milk"})
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, ids, 2) {
+		assert.NotEqual(t, milk.ID, ids[0])
+		assert.Equal(t, milk.ID, ids[1])
+	}
+}
+
+func testIngredientCreateWithUntrimmedName(t *testing.T, repo *repos.Repository) {
+
+	// when
+	ingredient, err := repo.IngredientService.Create(" milk  ")
+
+	// then
+	assert.NoError(t, err)
+	if assert.NotNil(t, ingredient) {
+		assert.NotZero(t, ingredient.ID)
+		assert.Equal(t, domain.Ingredient("milk"), ingredient.Name)
+	}
+
+	read, err := repo.IngredientService.ReadById(ingredient.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ingredient, read)
+}
+
+func testIngredientCreateWithExistingName(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIngredient(t, repo, "milk")
+
+	// when
+	ingredient, err := repo.IngredientService.Create("milk ")
+
+	// then
+	assert.Equal(t, domain.ErrAlreadyExists, err)
+	assert.Nil(t, ingredient)
+}
+
+func testIngredientsReadAll(t *testing.T, repo *repos.Repository) {
+
+	// given
+	milk := createIngredient(t, repo, "milk")
+	cream := createIngredient(t, repo, "cream")
+	sugar := createIngredient(t, repo, "sugar")
+
+	// when
+	ingredients, err := repo.IngredientService.ReadAll()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*domain.IngredientEntry{milk, cream, sugar}, ingredients)
+}
+
+func testIngredientReadByIdWithUnknownId(t *testing.T, repo *repos.Repository) {
+
+	// when
+	ingredient, err := repo.IngredientService.ReadById(42)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, ingredient)
+}
+
+func testIngredientsReads(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk", "vanilla"), newIcecream(2, "Lemon Sorbet"))
+
+	// when
+	ingredients, err := repo.IngredientService.Reads([]int64{1, 2})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"milk", "vanilla"}, sorted(ingredients[1]))
+	assert.Contains(t, ingredients, int64(2))
+	assert.Empty(t, ingredients[2])
+
+	read, err := repo.IngredientService.Read(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"milk", "vanilla"}, sorted(read))
+}
+
+func testIngredientRenameWithNewName(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk"))
+	milk := readIngredient(t, repo, "milk")
+
+	// when
+	renamed, err := repo.IngredientService.Rename(milk.ID, " whole milk ")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, &domain.IngredientEntry{ID: milk.ID, Name: "whole milk"}, renamed)
+	assert.Equal(t, []string{"whole milk"}, sorted(readIcecream(t, repo, 1).Ingredients))
+}
+
+func testIngredientRenameWithExistingName(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo,
+		newIcecream(1, "Vanilla Dream", "cocoa"),
+		newIcecream(2, "Chocolate Fudge", "cacao"),
+		newIcecream(3, "Mocha", "cocoa", "cacao"),
+	)
+	cocoa := readIngredient(t, repo, "cocoa")
+	cacao := readIngredient(t, repo, "cacao")
+
+	// when
+	merged, err := repo.IngredientService.Rename(cocoa.ID, "cacao")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, cacao, merged)
+
+	removed, err := repo.IngredientService.ReadById(cocoa.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, removed)
+
+	for _, productId := range []int64{1, 2, 3} {
+		assert.Equal(t, []string{"cacao"}, sorted(readIcecream(t, repo, productId).Ingredients))
+	}
+}
+
+func testIngredientRenameWithUnknownId(t *testing.T, repo *repos.Repository) {
+
+	// when
+	renamed, err := repo.IngredientService.Rename(42, "milk")
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, renamed)
+}
+
+func testIngredientDeleteWithReferencedIngredient(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk"))
+	milk := readIngredient(t, repo, "milk")
+
+	// when
+	err := repo.IngredientService.Delete(milk.ID, false)
+
+	// then
+	assert.Equal(t, domain.ErrStillReferenced, err)
+	assert.Equal(t, []string{"milk"}, sorted(readIcecream(t, repo, 1).Ingredients))
+}
+
+func testIngredientDeleteWithForce(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk", "vanilla"))
+	milk := readIngredient(t, repo, "milk")
+	unused := createIngredient(t, repo, "cream")
+
+	// when
+	forced := repo.IngredientService.Delete(milk.ID, true)
+	notReferenced := repo.IngredientService.Delete(unused.ID, false)
+
+	// then
+	assert.NoError(t, forced)
+	assert.NoError(t, notReferenced)
+	assert.Equal(t, []string{"vanilla"}, sorted(readIcecream(t, repo, 1).Ingredients))
+
+	ingredients, err := repo.IngredientService.ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, ingredients, 1)
+}
+
+func testIngredientDeleteWithUnknownId(t *testing.T, repo *repos.Repository) {
+
+	// when
+	err := repo.IngredientService.Delete(42, false)
+
+	// then
+	assert.Equal(t, domain.ErrNotFound, err)
+}
+
+func testSourcingValueCreateWithExistingDescription(t *testing.T, repo *repos.Repository) {
+
+	// given
+	created, err := repo.SourcingValueService.Create(" Fairtrade")
+	require.NoError(t, err)
+
+	// when
+	sourcingValue, err := repo.SourcingValueService.Create("Fairtrade ")
+
+	// then
+	assert.Equal(t, domain.SourcingValue("Fairtrade"), created.Description)
+	assert.Equal(t, domain.ErrAlreadyExists, err)
+	assert.Nil(t, sourcingValue)
+}
+
+func testSourcingValueRenameWithExistingDescription(t *testing.T, repo *repos.Repository) {
+
+	// given
+	fairtrade := newIcecream(1, "Vanilla Dream")
+	fairtrade.SourcingValues = domain.SourcingValues{"Fair Trade"}
+	organic := newIcecream(2, "Mint Breeze")
+	organic.SourcingValues = domain.SourcingValues{"Fairtrade", "Organic"}
+	createIcecreams(t, repo, fairtrade, organic)
+
+	entries, err := repo.SourcingValueService.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// when
+	merged, err := repo.SourcingValueService.Rename(entries[0].ID, "Fairtrade")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, entries[1], merged)
+	assert.Equal(t, []string{"Fairtrade"}, sorted(readIcecream(t, repo, 1).SourcingValues))
+	assert.Equal(t, []string{"Fairtrade", "Organic"}, sorted(readIcecream(t, repo, 2).SourcingValues))
+
+	remaining, err := repo.SourcingValueService.ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, entries[1:], remaining)
+}
+
+func testSourcingValueDeleteWithReferencedSourcingValue(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	createIcecreams(t, repo, vanilla)
+
+	entries, err := repo.SourcingValueService.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// when
+	referenced := repo.SourcingValueService.Delete(entries[0].ID, false)
+	forced := repo.SourcingValueService.Delete(entries[0].ID, true)
+
+	// then
+	assert.Equal(t, domain.ErrStillReferenced, referenced)
+	assert.NoError(t, forced)
+	assert.Empty(t, readIcecream(t, repo, 1).SourcingValues)
+}
+
+func testSourcingValuesDeletes(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade", "Organic"}
+	mint := newIcecream(2, "Mint Breeze")
+	mint.SourcingValues = domain.SourcingValues{"Organic"}
+	createIcecreams(t, repo, vanilla, mint)
+
+	// when
+	err := repo.SourcingValueService.Deletes([]int64{1})
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, readIcecream(t, repo, 1).SourcingValues)
+	assert.Equal(t, []string{"Organic"}, sorted(readIcecream(t, repo, 2).SourcingValues))
+
+	entries, err := repo.SourcingValueService.ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func testIcecreamHasIngredientsCreateWithUnknownIngredient(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	milk := createIngredient(t, repo, "milk")
+
+	// when
+	unknownIngredient := repo.IcecreamHasIngredientsService.Create(1, []int64{milk.ID + 1})
+	unknownIcecream := repo.IcecreamHasIngredientsService.Create(2, []int64{milk.ID})
+
+	// then
+	assert.Error(t, unknownIngredient)
+	assert.Error(t, unknownIcecream)
+}
+
+func testIcecreamHasIngredientsDeletes(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo,
+		newIcecream(1, "Vanilla Dream", "milk", "vanilla"),
+		newIcecream(2, "Mint Breeze", "milk"),
+		newIcecream(3, "Lemon Sorbet", "lemon"),
+	)
+
+	// when
+	removed, err := repo.IcecreamHasIngredientsService.Deletes([]int64{1, 2, 3}, " milk")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+	assert.Equal(t, []string{"vanilla"}, sorted(readIcecream(t, repo, 1).Ingredients))
+	assert.Empty(t, readIcecream(t, repo, 2).Ingredients)
+	assert.NotNil(t, readIngredient(t, repo, "milk"))
+
+	unknown, err := repo.IcecreamHasIngredientsService.Deletes([]int64{1}, "sugar")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), unknown)
+}
+
+func testIcecreamHasSourcingValuesDeletes(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade", "Organic"}
+	mint := newIcecream(2, "Mint Breeze")
+	mint.SourcingValues = domain.SourcingValues{"Organic"}
+	createIcecreams(t, repo, vanilla, mint)
+
+	// when
+	removed, err := repo.IcecreamHasSourcingValuesService.Deletes([]int64{1}, "Organic")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.Equal(t, []string{"Fairtrade"}, sorted(readIcecream(t, repo, 1).SourcingValues))
+	assert.Equal(t, []string{"Organic"}, sorted(readIcecream(t, repo, 2).SourcingValues))
+}
+
+// readIngredient returns the ingredient of the catalogue with the given name, nil if there is none
+func readIngredient(t *testing.T, repo *repos.Repository, name string) *domain.IngredientEntry {
+	ingredients, err := repo.IngredientService.ReadAll()
+	require.NoError(t, err)
+	for _, ingredient := range ingredients {
+		if string(ingredient.Name) == name {
+			return ingredient
+		}
+	}
+	return nil
+}
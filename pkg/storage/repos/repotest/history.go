@@ -0,0 +1,391 @@
+package repotest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var historyTests = []test{
+	{"AuditService/Record_withEntry_setsIdAndCreationTime", testAuditRecord},
+	{"AuditService/History_withChangesOfActor_returnsThemOldestFirst", testAuditHistoryWithChangesOfActor},
+	{"AuditService/History_withChangesOfNoActor_returnsSystemUser", testAuditHistoryWithChangesOfNoActor},
+	{"AuditService/History_withFailedChange_returnsNothing", testAuditHistoryWithFailedChange},
+	{"AuditService/History_withCatalogueEntriesCreatedByIcecreams_returnsTheirCreationByActor", testAuditHistoryWithCatalogueEntriesCreatedByIcecreams},
+	{"AuditService/Search_withFilter_returnsMatchingEntries", testAuditSearchWithFilter},
+	{"IcecreamRevisionService/Revisions_withChanges_returnsThemOldestFirst", testRevisionsWithChanges},
+	{"IcecreamRevisionService/Revisions_withRenamedIngredient_returnsNewRevisionOfItsIcecreams", testRevisionsWithRenamedIngredient},
+	{"IcecreamRevisionService/Revisions_withForcedDeleteOfSourcingValue_returnsNewRevisionOfItsIcecreams", testRevisionsWithForcedDeleteOfSourcingValue},
+	{"IcecreamRevisionService/Revisions_withUnknownIcecream_returnsNothing", testRevisionsWithUnknownIcecream},
+	{"IcecreamRevisionService/Revision_withUnknownRevision_returnsNothing", testRevisionWithUnknownRevision},
+	{"IcecreamRevisionService/AsOf_withTime_returnsRevisionValidAtThatTime", testRevisionAsOf},
+}
+
+func testAuditRecord(t *testing.T, repo *repos.Repository) {
+
+	// given
+	entry := &domain.AuditEntry{
+		Entity:    domain.AuditEntityIcecream,
+		EntityID:  "1",
+		Action:    domain.AuditActionUpdate,
+		User:      "frank",
+		RequestID: "request-1",
+		Before:    json.RawMessage(`{"name":"Vanilla Dream"}`),
+	}
+
+	// when
+	err := repo.AuditService.Record(entry)
+
+	// then
+	assert.NoError(t, err)
+	assert.NotZero(t, entry.ID)
+	assert.False(t, entry.CreatedAt.IsZero())
+
+	history, err := repo.AuditService.History(domain.AuditEntityIcecream, "1")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, entry.ID, history[0].ID)
+		assert.Equal(t, "frank", history[0].User)
+		assert.Equal(t, "request-1", history[0].RequestID)
+		assert.JSONEq(t, `{"name":"Vanilla Dream"}`, string(history[0].Before))
+		assert.Empty(t, history[0].After)
+	}
+}
+
+func testAuditHistoryWithChangesOfActor(t *testing.T, repo *repos.Repository) {
+
+	// given
+	frank := repo.As(&domain.Actor{User: "frank", RequestID: "request-1"})
+	seb := repo.As(&domain.Actor{User: "seb", RequestID: "request-2"})
+
+	createIcecreams(t, frank, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, seb.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Name:      domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"},
+	}}))
+	require.NoError(t, frank.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	history, err := repo.AuditService.History(domain.AuditEntityIcecream, "1")
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, domain.AuditActionCreate, history[0].Action)
+		assert.Equal(t, "frank", history[0].User)
+		assert.Equal(t, "request-1", history[0].RequestID)
+		assert.Empty(t, history[0].Before)
+		assert.Equal(t, "Vanilla Dream", auditedIcecream(t, history[0].After).Name)
+
+		assert.Equal(t, domain.AuditActionUpdate, history[1].Action)
+		assert.Equal(t, "seb", history[1].User)
+		assert.Equal(t, "Vanilla Dream", auditedIcecream(t, history[1].Before).Name)
+		assert.Equal(t, "Vanilla Deluxe", auditedIcecream(t, history[1].After).Name)
+
+		assert.Equal(t, domain.AuditActionDelete, history[2].Action)
+		assert.Equal(t, "Vanilla Deluxe", auditedIcecream(t, history[2].Before).Name)
+		assert.Empty(t, history[2].After)
+
+		assert.True(t, history[0].ID < history[1].ID && history[1].ID < history[2].ID)
+	}
+}
+
+func testAuditHistoryWithChangesOfNoActor(t *testing.T, repo *repos.Repository) {
+
+	// given
+	milk := createIngredient(t, repo, "milk")
+	_, err := repo.IngredientService.Rename(milk.ID, "whole milk")
+	require.NoError(t, err)
+
+	// when
+	history, err := repo.AuditService.History(domain.AuditEntityIngredient, formatId(milk.ID))
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, domain.AuditActionCreate, history[0].Action)
+		assert.Equal(t, domain.AuditActionUpdate, history[1].Action)
+		for _, entry := range history {
+			assert.Equal(t, domain.SystemUser, entry.User)
+			assert.Empty(t, entry.RequestID)
+		}
+	}
+}
+
+func testAuditHistoryWithFailedChange(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	_, err := repo.IcecreamService.Creates([]*domain.Icecream{newIcecream(2, "Mint Breeze"), newIcecream(1, "Vanilla Dream")})
+	require.Equal(t, domain.ErrAlreadyExists, err)
+
+	// when
+	history, err := repo.AuditService.History(domain.AuditEntityIcecream, "2")
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testAuditHistoryWithCatalogueEntriesCreatedByIcecreams(t *testing.T, repo *repos.Repository) {
+
+	// given
+	frank := repo.As(&domain.Actor{User: "frank", RequestID: "request-1"})
+	seb := repo.As(&domain.Actor{User: "seb", RequestID: "request-2"})
+
+	cream := createIngredient(t, repo, "cream")
+
+	vanilla := newIcecream(1, "Vanilla Dream", "cream", "milk")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	createIcecreams(t, frank, vanilla)
+
+	require.NoError(t, seb.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID:   "1",
+		Ingredients: domain.RelationPatch{Set: true, Add: []string{"milk", "sugar"}},
+	}}))
+
+	sourcingValues, err := repo.SourcingValueService.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, sourcingValues, 1)
+
+	// when
+	creamHistory, err := repo.AuditService.History(domain.AuditEntityIngredient, formatId(cream.ID))
+	require.NoError(t, err)
+	milkHistory, err := repo.AuditService.History(domain.AuditEntityIngredient, formatId(readIngredient(t, repo, "milk").ID))
+	require.NoError(t, err)
+	sugarHistory, err := repo.AuditService.History(domain.AuditEntityIngredient, formatId(readIngredient(t, repo, "sugar").ID))
+	require.NoError(t, err)
+	fairtradeHistory, err := repo.AuditService.History(domain.AuditEntitySourcingValue, formatId(sourcingValues[0].ID))
+	require.NoError(t, err)
+
+	// then
+	// only the entries which did not exist before are created
+	if assert.Len(t, creamHistory, 1) {
+		assert.Equal(t, domain.SystemUser, creamHistory[0].User)
+	}
+
+	if assert.Len(t, milkHistory, 1) {
+		assert.Equal(t, domain.AuditActionCreate, milkHistory[0].Action)
+		assert.Equal(t, "frank", milkHistory[0].User)
+		assert.Equal(t, "request-1", milkHistory[0].RequestID)
+		assert.Empty(t, milkHistory[0].Before)
+		assert.NotEmpty(t, milkHistory[0].After)
+	}
+
+	if assert.Len(t, sugarHistory, 1) {
+		assert.Equal(t, domain.AuditActionCreate, sugarHistory[0].Action)
+		assert.Equal(t, "seb", sugarHistory[0].User)
+	}
+
+	if assert.Len(t, fairtradeHistory, 1) {
+		assert.Equal(t, domain.AuditActionCreate, fairtradeHistory[0].Action)
+		assert.Equal(t, "frank", fairtradeHistory[0].User)
+	}
+}
+
+func testAuditSearchWithFilter(t *testing.T, repo *repos.Repository) {
+
+	// given
+	frank := repo.As(&domain.Actor{User: "frank"})
+	seb := repo.As(&domain.Actor{User: "seb"})
+
+	createIcecreams(t, frank, newIcecream(1, "Vanilla Dream"))
+	createIcecreams(t, seb, newIcecream(2, "Mint Breeze"))
+	createIcecreams(t, frank, newIcecream(3, "Lemon Zest"))
+
+	// when
+	byUser, err := repo.AuditService.Search(&domain.AuditFilter{User: "frank"})
+	require.NoError(t, err)
+	limited, err := repo.AuditService.Search(&domain.AuditFilter{User: "frank", Limit: 1})
+	require.NoError(t, err)
+	// the clock of the database may differ a little
+	recent, err := repo.AuditService.Search(&domain.AuditFilter{Since: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	future, err := repo.AuditService.Search(&domain.AuditFilter{Since: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, []string{"1", "3"}, auditedEntityIds(byUser))
+	assert.Equal(t, []string{"1"}, auditedEntityIds(limited))
+	assert.Equal(t, []string{"1", "2", "3"}, auditedEntityIds(recent))
+	assert.Empty(t, future)
+}
+
+func testRevisionsWithChanges(t *testing.T, repo *repos.Repository) {
+
+	// given
+	frank := repo.As(&domain.Actor{User: "frank"})
+	createIcecreams(t, frank, newIcecream(1, "Vanilla Dream", "milk"))
+	require.NoError(t, repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID:   "1",
+		Ingredients: domain.RelationPatch{Set: true, Add: []string{"vanilla"}},
+	}}))
+	require.NoError(t, frank.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	revisions, err := repo.IcecreamRevisionService.Revisions(1)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 3) {
+		for i, revision := range revisions {
+			assert.Equal(t, "1", revision.ProductID)
+			assert.Equal(t, int64(i+1), revision.Revision)
+			assert.False(t, revision.ValidFrom.IsZero())
+		}
+
+		assert.Equal(t, "frank", revisions[0].User)
+		if assert.NotNil(t, revisions[0].Icecream) {
+			assert.Equal(t, "Vanilla Dream", revisions[0].Icecream.Name)
+			assert.Equal(t, []string{"milk"}, sorted(revisions[0].Icecream.Ingredients))
+		}
+
+		assert.Equal(t, domain.SystemUser, revisions[1].User)
+		if assert.NotNil(t, revisions[1].Icecream) {
+			assert.Equal(t, []string{"milk", "vanilla"}, sorted(revisions[1].Icecream.Ingredients))
+		}
+
+		assert.Equal(t, "frank", revisions[2].User)
+		assert.Nil(t, revisions[2].Icecream)
+	}
+
+	revision, err := repo.IcecreamRevisionService.Revision(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, revisions[1], revision)
+}
+
+func testRevisionsWithRenamedIngredient(t *testing.T, repo *repos.Repository) {
+
+	// given
+	frank := repo.As(&domain.Actor{User: "frank"})
+	seb := repo.As(&domain.Actor{User: "seb", RequestID: "request-1"})
+	createIcecreams(t, frank, newIcecream(1, "Vanilla Dream", "milk"), newIcecream(2, "Mint Breeze", "mint"))
+	milk := readIngredient(t, repo, "milk")
+
+	_, err := seb.IngredientService.Rename(milk.ID, "whole milk")
+	require.NoError(t, err)
+
+	// when
+	revisions, err := repo.IcecreamRevisionService.Revisions(1)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, "seb", revisions[1].User)
+		if assert.NotNil(t, revisions[1].Icecream) {
+			assert.Equal(t, []string{"whole milk"}, sorted(revisions[1].Icecream.Ingredients))
+		}
+	}
+	assert.Equal(t, int64(2), readIcecream(t, repo, 1).Version)
+
+	history, err := repo.AuditService.History(domain.AuditEntityIcecream, "1")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, domain.AuditActionUpdate, history[1].Action)
+		assert.Equal(t, "seb", history[1].User)
+		assert.Equal(t, "request-1", history[1].RequestID)
+	}
+
+	unchanged, err := repo.IcecreamRevisionService.Revisions(2)
+	assert.NoError(t, err)
+	assert.Len(t, unchanged, 1)
+	assert.Equal(t, int64(1), readIcecream(t, repo, 2).Version)
+}
+
+func testRevisionsWithForcedDeleteOfSourcingValue(t *testing.T, repo *repos.Repository) {
+
+	// given
+	icecream := newIcecream(1, "Vanilla Dream")
+	icecream.SourcingValues = domain.SourcingValues{"Fairtrade", "Cage-Free Eggs"}
+	createIcecreams(t, repo, icecream)
+
+	sourcingValues, err := repo.SourcingValueService.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, sourcingValues, 2)
+
+	var fairtrade *domain.SourcingValueEntry
+	for _, sourcingValue := range sourcingValues {
+		if sourcingValue.Description == "Fairtrade" {
+			fairtrade = sourcingValue
+		}
+	}
+	require.NotNil(t, fairtrade)
+
+	require.NoError(t, repo.SourcingValueService.Delete(fairtrade.ID, true))
+
+	// when
+	revisions, err := repo.IcecreamRevisionService.Revisions(1)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2) && assert.NotNil(t, revisions[1].Icecream) {
+		assert.Equal(t, []string{"Cage-Free Eggs"}, sorted(revisions[1].Icecream.SourcingValues))
+	}
+	assert.Equal(t, int64(2), readIcecream(t, repo, 1).Version)
+}
+
+func testRevisionsWithUnknownIcecream(t *testing.T, repo *repos.Repository) {
+
+	// when
+	revisions, err := repo.IcecreamRevisionService.Revisions(1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+}
+
+func testRevisionWithUnknownRevision(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	revision, err := repo.IcecreamRevisionService.Revision(1, 2)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, revision)
+}
+
+func testRevisionAsOf(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Name:      domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"},
+	}}))
+
+	// when
+	// an hour apart, the clock of the database may differ a little
+	before, err := repo.IcecreamRevisionService.AsOf(1, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	latest, err := repo.IcecreamRevisionService.AsOf(1, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// then
+	assert.Nil(t, before)
+	if assert.NotNil(t, latest) && assert.NotNil(t, latest.Icecream) {
+		assert.Equal(t, int64(2), latest.Revision)
+		assert.Equal(t, "Vanilla Deluxe", latest.Icecream.Name)
+	}
+}
+
+func auditedIcecream(t *testing.T, state json.RawMessage) *domain.Icecream {
+	var icecream domain.Icecream
+	require.NoError(t, json.Unmarshal(state, &icecream))
+	return &icecream
+}
+
+func auditedEntityIds(entries []*domain.AuditEntry) []string {
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.EntityID)
+	}
+	return ids
+}
@@ -0,0 +1,790 @@
+package repotest
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var icecreamTests = []test{
+	{"IcecreamService/Creates_withNewIcecreams_returnsIdsAndStoresRelations", testCreatesWithNewIcecreams},
+	{"IcecreamService/Creates_withExistingIcecream_returnsErrAlreadyExistsAndCreatesNone", testCreatesWithExistingIcecream},
+	{"IcecreamService/Creates_withIcecreamInTrash_returnsErrAlreadyExists", testCreatesWithIcecreamInTrash},
+	{"IcecreamService/Creates_withUntrimmedRelations_storesTrimmedValuesOnce", testCreatesWithUntrimmedRelations},
+	{"IcecreamService/Reads_withUnknownIds_returnsNothing", testReadsWithUnknownIds},
+	{"IcecreamService/Reads_withoutRelations_returnsIcecreamsOnly", testReadsWithoutRelations},
+	{"IcecreamService/Replaces_withNewAndExistingIcecreams_returnsCreatedIds", testReplacesWithNewAndExistingIcecreams},
+	{"IcecreamService/Replaces_withIcecreamInTrash_restoresIcecream", testReplacesWithIcecreamInTrash},
+	{"IcecreamService/Updates_withFields_setsAndClearsFieldsAndIncrementsVersion", testUpdatesWithFields},
+	{"IcecreamService/Updates_withRelationChanges_addsAndRemovesValues", testUpdatesWithRelationChanges},
+	{"IcecreamService/Updates_withReplacedRelations_replacesAllValues", testUpdatesWithReplacedRelations},
+	{"IcecreamService/Updates_withStaleVersion_returnsErrVersionMismatch", testUpdatesWithStaleVersion},
+	{"IcecreamService/Updates_withUnknownIcecream_returnsErrNotFound", testUpdatesWithUnknownIcecream},
+	{"IcecreamService/Updates_withFailingPatch_appliesNoPatch", testUpdatesWithFailingPatch},
+	{"IcecreamService/Delete_withCurrentVersion_movesIcecreamIntoTrash", testDeleteWithCurrentVersion},
+	{"IcecreamService/Delete_withStaleVersion_returnsErrVersionMismatch", testDeleteWithStaleVersion},
+	{"IcecreamService/Deletes_withUnknownIcecream_returnsErrNotFoundAndDeletesNone", testDeletesWithUnknownIcecream},
+	{"IcecreamService/Deletes_withStaleVersion_returnsErrVersionMismatchAndDeletesNone", testDeletesWithStaleVersion},
+	{"IcecreamService/Trash_withDeletedIcecreams_returnsThemWithRelations", testTrashWithDeletedIcecreams},
+	{"IcecreamService/Restores_withDeletedIcecream_restoresIcecreamWithRelations", testRestoresWithDeletedIcecream},
+	{"IcecreamService/Restores_withIcecreamNotInTrash_returnsErrNotDeleted", testRestoresWithIcecreamNotInTrash},
+	{"IcecreamService/Purge_withDeletedIcecreams_removesThemAndTheirRelations", testPurgeWithDeletedIcecreams},
+	{"IcecreamService/Purge_beforeDeletion_keepsIcecreams", testPurgeBeforeDeletion},
+	{"IcecreamService/Purge_withRecreatedIcecream_neverRepeatsItsVersions", testPurgeWithRecreatedIcecream},
+	{"IcecreamService/List_withLimit_returnsPagesInOrder", testListWithLimit},
+	{"IcecreamService/List_withDescendingSort_returnsIcecreamsInReverseOrder", testListWithDescendingSort},
+	{"IcecreamService/List_withFilter_returnsMatchingIcecreams", testListWithFilter},
+	{"IcecreamService/List_withInclude_returnsIcecreamsWithRelations", testListWithInclude},
+	{"IcecreamService/List_withInvalidCursor_returnsErrInvalidCursor", testListWithInvalidCursor},
+	{"IcecreamService/Search_withTerm_returnsIcecreamsByRelevance", testSearchWithTerm},
+	{"IcecreamService/Search_withExcludedTerm_leavesOutIcecreams", testSearchWithExcludedTerm},
+	{"IcecreamService/Search_withLimit_returnsAtMostLimitResults", testSearchWithLimit},
+	{"IcecreamService/Search_withDeletedIcecream_leavesItOut", testSearchWithDeletedIcecream},
+	{"IcecreamService/Revert_withRevision_restoresStateOfRevision", testRevertWithRevision},
+	{"IcecreamService/Revert_withRevisionOfDeletion_returnsError", testRevertWithRevisionOfDeletion},
+}
+
+func testCreatesWithNewIcecreams(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk", "vanilla")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	vanilla.AllergyInfo = "may contain nuts"
+	mint := newIcecream(2, "Mint Breeze", "milk", "mint")
+
+	// when
+	ids, err := repo.IcecreamService.Creates([]*domain.Icecream{vanilla, mint})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	icecream := readIcecream(t, repo, 1)
+	if assert.NotNil(t, icecream) {
+		assert.Equal(t, "1", icecream.ProductID)
+		assert.Equal(t, "Vanilla Dream", icecream.Name)
+		assert.Equal(t, "description of Vanilla Dream", icecream.Description)
+		assert.Equal(t, "story of Vanilla Dream", icecream.Story)
+		assert.Equal(t, "may contain nuts", icecream.AllergyInfo)
+		assert.Equal(t, "", icecream.ImageOpen)
+		assert.Equal(t, []string{"milk", "vanilla"}, sorted(icecream.Ingredients))
+		assert.Equal(t, []string{"Fairtrade"}, sorted(icecream.SourcingValues))
+		assert.Equal(t, int64(1), icecream.Version)
+		assert.Nil(t, icecream.DeletedAt)
+	}
+
+	ingredients, err := repo.IngredientService.ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, ingredients, 3)
+}
+
+func testCreatesWithExistingIcecream(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	_, err := repo.IcecreamService.Creates([]*domain.Icecream{
+		newIcecream(2, "Mint Breeze", "mint"),
+		newIcecream(1, "Vanilla Nightmare"),
+	})
+
+	// then
+	assert.Equal(t, domain.ErrAlreadyExists, err)
+	assert.Nil(t, readIcecream(t, repo, 2))
+	assert.Equal(t, "Vanilla Dream", readIcecream(t, repo, 1).Name)
+
+	ingredients, err := repo.IngredientService.ReadAll()
+	assert.NoError(t, err)
+	assert.Empty(t, ingredients)
+}
+
+func testCreatesWithIcecreamInTrash(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	_, err := repo.IcecreamService.Creates([]*domain.Icecream{newIcecream(1, "Vanilla Nightmare")})
+
+	// then
+	assert.Equal(t, domain.ErrAlreadyExists, err)
+}
+
+func testCreatesWithUntrimmedRelations(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", " milk ", "milk")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade ", " Fairtrade"}
+
+	// when
+	_, err := repo.IcecreamService.Creates([]*domain.Icecream{vanilla})
+
+	// then
+	assert.NoError(t, err)
+
+	icecream := readIcecream(t, repo, 1)
+	assert.Equal(t, []string{"milk"}, sorted(icecream.Ingredients))
+	assert.Equal(t, []string{"Fairtrade"}, sorted(icecream.SourcingValues))
+}
+
+func testReadsWithUnknownIds(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	icecreams, err := repo.IcecreamService.Reads([]int64{2, 3}, domain.IcecreamRelations...)
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, icecreams)
+}
+
+func testReadsWithoutRelations(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk"), newIcecream(2, "Mint Breeze", "mint"))
+
+	// when
+	icecreams, err := repo.IcecreamService.Reads([]int64{1, 2})
+
+	// then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, productIds(icecreams))
+	for _, icecream := range icecreams {
+		assert.Empty(t, icecream.Ingredients)
+		assert.Empty(t, icecream.SourcingValues)
+	}
+}
+
+func testReplacesWithNewAndExistingIcecreams(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk", "vanilla")
+	vanilla.AllergyInfo = "may contain nuts"
+	createIcecreams(t, repo, vanilla)
+
+	// when
+	created, err := repo.IcecreamService.Replaces([]*domain.Icecream{
+		newIcecream(1, "Vanilla Deluxe", "cream"),
+		newIcecream(2, "Mint Breeze", "mint"),
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2}, created)
+
+	icecream := readIcecream(t, repo, 1)
+	assert.Equal(t, "Vanilla Deluxe", icecream.Name)
+	assert.Equal(t, "", icecream.AllergyInfo)
+	assert.Equal(t, []string{"cream"}, sorted(icecream.Ingredients))
+	assert.Equal(t, int64(2), icecream.Version)
+
+	assert.Equal(t, []string{"mint"}, sorted(readIcecream(t, repo, 2).Ingredients))
+}
+
+func testReplacesWithIcecreamInTrash(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	created, err := repo.IcecreamService.Replaces([]*domain.Icecream{newIcecream(1, "Vanilla Deluxe")})
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, created)
+
+	icecream := readIcecream(t, repo, 1)
+	if assert.NotNil(t, icecream) {
+		assert.Equal(t, "Vanilla Deluxe", icecream.Name)
+		assert.Nil(t, icecream.DeletedAt)
+	}
+
+	trash, err := repo.IcecreamService.Trash()
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
+func testUpdatesWithFields(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk"))
+
+	// when
+	err := repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID:   "1",
+		Name:        domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"},
+		Description: domain.OptionalString{Set: true, Valid: false},
+		Version:     1,
+	}})
+
+	// then
+	assert.NoError(t, err)
+
+	icecream := readIcecream(t, repo, 1)
+	assert.Equal(t, "Vanilla Deluxe", icecream.Name)
+	assert.Equal(t, "", icecream.Description)
+	assert.Equal(t, "story of Vanilla Dream", icecream.Story)
+	assert.Equal(t, []string{"milk"}, sorted(icecream.Ingredients))
+	assert.Equal(t, int64(2), icecream.Version)
+}
+
+func testUpdatesWithRelationChanges(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk", "wheat")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	createIcecreams(t, repo, vanilla)
+
+	// when
+	err := repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID:      "1",
+		Ingredients:    domain.RelationPatch{Set: true, Add: []string{" peanuts "}, Remove: []string{"wheat"}},
+		SourcingValues: domain.RelationPatch{Set: true, Replace: true},
+	}})
+
+	// then
+	assert.NoError(t, err)
+
+	icecream := readIcecream(t, repo, 1)
+	assert.Equal(t, []string{"milk", "peanuts"}, sorted(icecream.Ingredients))
+	assert.Empty(t, icecream.SourcingValues)
+	assert.Equal(t, int64(2), icecream.Version)
+
+	// removing relations keeps the values in the catalogue
+	ingredients, err := repo.IngredientService.ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, ingredients, 3)
+}
+
+func testUpdatesWithReplacedRelations(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk", "wheat"))
+
+	// when
+	err := repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID:   "1",
+		Ingredients: domain.RelationPatch{Set: true, Replace: true, Values: []string{"cream", "milk"}},
+	}})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cream", "milk"}, sorted(readIcecream(t, repo, 1).Ingredients))
+}
+
+func testUpdatesWithStaleVersion(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Story:     domain.OptionalString{Set: true, Valid: true, Value: "a new story"},
+	}}))
+
+	// when
+	err := repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Name:      domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"},
+		Version:   1,
+	}})
+
+	// then
+	assert.Equal(t, domain.ErrVersionMismatch, err)
+
+	icecream := readIcecream(t, repo, 1)
+	assert.Equal(t, "Vanilla Dream", icecream.Name)
+	assert.Equal(t, int64(2), icecream.Version)
+}
+
+func testUpdatesWithUnknownIcecream(t *testing.T, repo *repos.Repository) {
+
+	// when
+	withoutVersion := repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Name:      domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"},
+	}})
+	withVersion := repo.IcecreamService.Updates([]*domain.IcecreamPatch{{
+		ProductID: "1",
+		Name:      domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"},
+		Version:   1,
+	}})
+
+	// then
+	assert.Equal(t, domain.ErrNotFound, withoutVersion)
+	assert.Equal(t, domain.ErrNotFound, withVersion)
+}
+
+func testUpdatesWithFailingPatch(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	err := repo.IcecreamService.Updates([]*domain.IcecreamPatch{
+		{ProductID: "1", Name: domain.OptionalString{Set: true, Valid: true, Value: "Vanilla Deluxe"}},
+		{ProductID: "2", Name: domain.OptionalString{Set: true, Valid: true, Value: "Mint Breeze"}},
+	})
+
+	// then
+	assert.Error(t, err)
+
+	icecream := readIcecream(t, repo, 1)
+	assert.Equal(t, "Vanilla Dream", icecream.Name)
+	assert.Equal(t, int64(1), icecream.Version)
+}
+
+func testDeleteWithCurrentVersion(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	err := repo.IcecreamService.Delete(1, 1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, readIcecream(t, repo, 1))
+
+	trash, err := repo.IcecreamService.Trash()
+	assert.NoError(t, err)
+	if assert.Len(t, trash, 1) {
+		assert.Equal(t, "1", trash[0].ProductID)
+		assert.NotNil(t, trash[0].DeletedAt)
+		assert.Equal(t, int64(2), trash[0].Version)
+	}
+}
+
+func testDeleteWithStaleVersion(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	err := repo.IcecreamService.Delete(1, 7)
+
+	// then
+	assert.Equal(t, domain.ErrVersionMismatch, err)
+	assert.NotNil(t, readIcecream(t, repo, 1))
+}
+
+func testDeletesWithUnknownIcecream(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	err := repo.IcecreamService.Deletes([]int64{1, 2}, nil)
+
+	// then
+	assert.Equal(t, domain.ErrNotFound, err)
+	assert.NotNil(t, readIcecream(t, repo, 1))
+}
+
+func testDeletesWithStaleVersion(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"), newIcecream(2, "Mint Breeze"))
+
+	// when
+	err := repo.IcecreamService.Deletes([]int64{1, 2}, []int64{1, 7})
+
+	// then
+	assert.Equal(t, domain.ErrVersionMismatch, err)
+	assert.NotNil(t, readIcecream(t, repo, 1))
+	assert.NotNil(t, readIcecream(t, repo, 2))
+}
+
+func testTrashWithDeletedIcecreams(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	createIcecreams(t, repo, vanilla, newIcecream(2, "Mint Breeze"), newIcecream(3, "Lemon Zest"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{3}, nil))
+
+	// when
+	trash, err := repo.IcecreamService.Trash()
+
+	// then
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "3"}, productIds(trash))
+	for _, icecream := range trash {
+		assert.NotNil(t, icecream.DeletedAt)
+		if icecream.ProductID == "1" {
+			assert.Equal(t, []string{"milk"}, sorted(icecream.Ingredients))
+			assert.Equal(t, []string{"Fairtrade"}, sorted(icecream.SourcingValues))
+		}
+	}
+}
+
+func testRestoresWithDeletedIcecream(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	err := repo.IcecreamService.Restores([]int64{1})
+
+	// then
+	assert.NoError(t, err)
+
+	icecream := readIcecream(t, repo, 1)
+	if assert.NotNil(t, icecream) {
+		assert.Nil(t, icecream.DeletedAt)
+		assert.Equal(t, []string{"milk"}, sorted(icecream.Ingredients))
+		assert.Equal(t, int64(3), icecream.Version)
+	}
+}
+
+func testRestoresWithIcecreamNotInTrash(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"), newIcecream(2, "Mint Breeze"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	notInTrash := repo.IcecreamService.Restores([]int64{1, 2})
+	unknown := repo.IcecreamService.Restores([]int64{3})
+
+	// then
+	assert.Equal(t, domain.ErrNotDeleted, notInTrash)
+	assert.Equal(t, domain.ErrNotDeleted, unknown)
+	assert.Nil(t, readIcecream(t, repo, 1))
+}
+
+func testPurgeWithDeletedIcecreams(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	createIcecreams(t, repo, vanilla, newIcecream(2, "Mint Breeze", "milk"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	// an hour ahead, the clock of the database may differ a little
+	purged, err := repo.IcecreamService.Purge(time.Now().Add(time.Hour))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	trash, err := repo.IcecreamService.Trash()
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+
+	ingredients, err := repo.IngredientService.Reads([]int64{1, 2})
+	assert.NoError(t, err)
+	assert.Empty(t, ingredients[1])
+	assert.Equal(t, []string{"milk"}, sorted(ingredients[2]))
+
+	// the catalogue keeps the values
+	sourcingValues, err := repo.SourcingValueService.ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, sourcingValues, 1)
+
+	// a purged icecream can be created again
+	_, err = repo.IcecreamService.Creates([]*domain.Icecream{newIcecream(1, "Vanilla Dream")})
+	assert.NoError(t, err)
+}
+
+func testPurgeBeforeDeletion(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	purged, err := repo.IcecreamService.Purge(time.Now().Add(-time.Hour))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	trash, err := repo.IcecreamService.Trash()
+	assert.NoError(t, err)
+	assert.Len(t, trash, 1)
+}
+
+func testPurgeWithRecreatedIcecream(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"), newIcecream(2, "Mint Breeze"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1, 2}, nil))
+
+	trash, err := repo.IcecreamService.Trash()
+	require.NoError(t, err)
+	require.Len(t, trash, 2)
+
+	// when
+	purged, err := repo.IcecreamService.Purge(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), purged)
+
+	_, err = repo.IcecreamService.Creates([]*domain.Icecream{newIcecream(1, "Vanilla Deluxe")})
+	require.NoError(t, err)
+
+	created, err := repo.IcecreamService.Replaces([]*domain.Icecream{newIcecream(2, "Mint Deluxe")})
+	require.NoError(t, err)
+
+	// then
+	// an ETag of the purged icecreams must not match the new ones
+	assert.Equal(t, []int64{2}, created)
+	for _, deleted := range trash {
+		id, _ := strconv.ParseInt(deleted.ProductID, 10, 64)
+		assert.True(t, readIcecream(t, repo, id).Version > deleted.Version)
+	}
+}
+
+func testListWithLimit(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo,
+		newIcecream(3, "Lemon Zest"),
+		newIcecream(1, "Vanilla Dream"),
+		newIcecream(2, "Mint Breeze"),
+		newIcecream(4, "Banana Split"),
+		newIcecream(5, "Cherry Garcia"),
+	)
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{5}, nil))
+
+	// when
+	first, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 2})
+	require.NoError(t, err)
+	second, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 2, Cursor: first.Next})
+	require.NoError(t, err)
+	back, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 2, Cursor: second.Prev})
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, []string{"1", "2"}, productIds(first.Icecreams))
+	assert.Equal(t, int64(4), first.Total)
+	assert.Empty(t, first.Prev)
+	assert.NotEmpty(t, first.Next)
+
+	assert.Equal(t, []string{"3", "4"}, productIds(second.Icecreams))
+	assert.Equal(t, int64(4), second.Total)
+	assert.NotEmpty(t, second.Prev)
+	assert.Empty(t, second.Next)
+
+	assert.Equal(t, []string{"1", "2"}, productIds(back.Icecreams))
+	assert.Empty(t, back.Prev)
+	assert.NotEmpty(t, back.Next)
+}
+
+func testListWithDescendingSort(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo,
+		newIcecream(1, "Vanilla Dream"),
+		newIcecream(2, "Mint Breeze"),
+		newIcecream(3, "Lemon Zest"),
+		newIcecream(4, "Mint Breeze"),
+	)
+	sort := []domain.SortField{{Name: "name", Descending: true}}
+
+	// when
+	first, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 2, Sort: sort})
+	require.NoError(t, err)
+	second, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 2, Sort: sort, Cursor: first.Next})
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, []string{"1", "2"}, productIds(first.Icecreams))
+	assert.Equal(t, []string{"4", "3"}, productIds(second.Icecreams))
+}
+
+func testListWithFilter(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk", "chocolate chips")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	vanilla.AllergyInfo = "contains milk"
+	chocolate := newIcecream(2, "Chocolate Fudge", "cream", "chocolate", "wheat flour")
+	chocolate.SourcingValues = domain.SourcingValues{"Fairtrade", "Cage-Free Eggs"}
+	chocolate.AllergyInfo = "contains milk and wheat"
+	sorbet := newIcecream(3, "Lemon Sorbet", "lemon")
+	sorbet.DietaryCertifications = "vegan"
+	createIcecreams(t, repo, vanilla, chocolate, sorbet)
+
+	tests := []struct {
+		filter   domain.IcecreamFilter
+		expected []string
+	}{
+		{domain.IcecreamFilter{Ingredients: []string{"CHOC"}}, []string{"1", "2"}},
+		{domain.IcecreamFilter{Ingredients: []string{"choc", "wheat"}}, []string{"2"}},
+		{domain.IcecreamFilter{WithoutIngredients: []string{"wheat"}}, []string{"1", "3"}},
+		{domain.IcecreamFilter{SourcingValues: []string{"fairtrade"}}, []string{"1", "2"}},
+		{domain.IcecreamFilter{SourcingValues: []string{"Fair"}}, []string{}},
+		{domain.IcecreamFilter{Allergens: []string{"wheat"}}, []string{"2"}},
+		{domain.IcecreamFilter{WithoutAllergens: []string{"milk"}}, []string{"3"}},
+		{domain.IcecreamFilter{Certifications: []string{"vegan"}}, []string{"3"}},
+		{domain.IcecreamFilter{Ingredients: []string{"100%_"}}, []string{}},
+	}
+
+	for _, tt := range tests {
+
+		// when
+		page, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 10, Filter: tt.filter})
+
+		// then
+		if assert.NoError(t, err, "%+v", tt.filter) {
+			assert.Equal(t, tt.expected, productIds(page.Icecreams), "%+v", tt.filter)
+			assert.Equal(t, int64(len(tt.expected)), page.Total, "%+v", tt.filter)
+		}
+	}
+}
+
+func testListWithInclude(t *testing.T, repo *repos.Repository) {
+
+	// given
+	vanilla := newIcecream(1, "Vanilla Dream", "milk", "vanilla")
+	vanilla.SourcingValues = domain.SourcingValues{"Fairtrade"}
+	createIcecreams(t, repo, vanilla, newIcecream(2, "Lemon Sorbet"))
+
+	// when
+	page, err := repo.IcecreamService.List(&domain.IcecreamListOptions{
+		Limit:   10,
+		Include: []domain.Relation{domain.RelationIngredients},
+	})
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, page.Icecreams, 2) {
+		assert.Equal(t, []string{"milk", "vanilla"}, sorted(page.Icecreams[0].Ingredients))
+		assert.Nil(t, page.Icecreams[0].SourcingValues)
+		assert.Empty(t, page.Icecreams[1].Ingredients)
+	}
+}
+
+func testListWithInvalidCursor(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+
+	// when
+	_, err := repo.IcecreamService.List(&domain.IcecreamListOptions{Limit: 2, Cursor: "not a cursor"})
+
+	// then
+	assert.Equal(t, domain.ErrInvalidCursor, err)
+}
+
+func testSearchWithTerm(t *testing.T, repo *repos.Repository) {
+
+	// given
+	mint := newIcecream(1, "Mint Breeze", "mint")
+	mint.Story = "reminds of vanilla"
+	createIcecreams(t, repo, mint, newIcecream(2, "Vanilla Dream", "milk"), newIcecream(3, "Lemon Zest"))
+
+	// when
+	results, err := repo.IcecreamService.Search("vanilla", 10)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "2", results[0].ProductID)
+		assert.Equal(t, "1", results[1].ProductID)
+		assert.True(t, results[0].Score > results[1].Score)
+		assert.Equal(t, "<b>Vanilla</b> Dream", results[0].Highlights["name"])
+		assert.Contains(t, results[1].Highlights["story"], "<b>vanilla</b>")
+		assert.NotContains(t, results[1].Highlights, "name")
+	}
+}
+
+func testSearchWithExcludedTerm(t *testing.T, repo *repos.Repository) {
+
+	// given
+	mint := newIcecream(1, "Mint Breeze", "mint")
+	mint.Story = "reminds of vanilla"
+	createIcecreams(t, repo, mint, newIcecream(2, "Vanilla Dream", "milk"))
+
+	// when
+	results, err := repo.IcecreamService.Search("vanilla -mint", 10)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "2", results[0].ProductID)
+	}
+}
+
+func testSearchWithLimit(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"), newIcecream(2, "Vanilla Deluxe"), newIcecream(3, "Vanilla Cookie"))
+
+	// when
+	results, err := repo.IcecreamService.Search("vanilla", 2)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+}
+
+func testSearchWithDeletedIcecream(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"), newIcecream(2, "Vanilla Deluxe"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	results, err := repo.IcecreamService.Search("vanilla", 10)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "2", results[0].ProductID)
+	}
+}
+
+func testRevertWithRevision(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream", "milk"))
+	_, err := repo.IcecreamService.Replaces([]*domain.Icecream{newIcecream(1, "Vanilla Deluxe", "cream")})
+	require.NoError(t, err)
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	err = repo.IcecreamService.Revert(1, 1)
+
+	// then
+	assert.NoError(t, err)
+
+	icecream := readIcecream(t, repo, 1)
+	if assert.NotNil(t, icecream) {
+		assert.Equal(t, "Vanilla Dream", icecream.Name)
+		assert.Equal(t, []string{"milk"}, sorted(icecream.Ingredients))
+	}
+
+	revisions, err := repo.IcecreamRevisionService.Revisions(1)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 4)
+}
+
+func testRevertWithRevisionOfDeletion(t *testing.T, repo *repos.Repository) {
+
+	// given
+	createIcecreams(t, repo, newIcecream(1, "Vanilla Dream"))
+	require.NoError(t, repo.IcecreamService.Deletes([]int64{1}, nil))
+
+	// when
+	deletion := repo.IcecreamService.Revert(1, 2)
+	unknown := repo.IcecreamService.Revert(1, 7)
+
+	// then
+	assert.Error(t, deletion)
+	assert.Error(t, unknown)
+	assert.Nil(t, readIcecream(t, repo, 1))
+}
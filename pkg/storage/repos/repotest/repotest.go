@@ -0,0 +1,107 @@
+// Package repotest checks that a repos.Repository keeps the contract of the domain
+// services, whatever stores the data. Every storage runs the same suite, e.g.:
+//
+//	func TestRepository(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) *repos.Repository {
+//			... return a repository of an empty storage
+//		})
+//	}
+package repotest
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+	"github.com/fraenky8/zlr-ca/pkg/storage/repos"
+	"github.com/stretchr/testify/require"
+)
+
+type test struct {
+	name string
+	test func(t *testing.T, repo *repos.Repository)
+}
+
+// Run runs every test of the suite with a new repository. The storage behind it
+// must not contain any icecreams, ingredients, sourcing values or api keys, but
+// it may contain users.
+func Run(t *testing.T, newRepository func(t *testing.T) *repos.Repository) {
+
+	var tests []test
+	tests = append(tests, icecreamTests...)
+	tests = append(tests, catalogueTests...)
+	tests = append(tests, historyTests...)
+	tests = append(tests, accessTests...)
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func newIcecream(productId int64, name string, ingredients ...string) *domain.Icecream {
+	icecream := &domain.Icecream{
+		ProductID:   strconv.FormatInt(productId, 10),
+		Name:        name,
+		Description: "description of " + name,
+		Story:       "story of " + name,
+		Ingredients: domain.Ingredients{},
+	}
+	for _, ingredient := range ingredients {
+		icecream.Ingredients = append(icecream.Ingredients, domain.Ingredient(ingredient))
+	}
+	return icecream
+}
+
+func createIcecreams(t *testing.T, repo *repos.Repository, icecreams ...*domain.Icecream) {
+	_, err := repo.IcecreamService.Creates(icecreams)
+	require.NoError(t, err)
+}
+
+// readIcecream returns the icecream with all its relations, nil if it does not exist
+func readIcecream(t *testing.T, repo *repos.Repository, productId int64) *domain.Icecream {
+	icecreams, err := repo.IcecreamService.Reads([]int64{productId}, domain.IcecreamRelations...)
+	require.NoError(t, err)
+	if len(icecreams) == 0 {
+		return nil
+	}
+	return icecreams[0]
+}
+
+func createIngredient(t *testing.T, repo *repos.Repository, name string) *domain.IngredientEntry {
+	ingredient, err := repo.IngredientService.Create(domain.Ingredient(name))
+	require.NoError(t, err)
+	return ingredient
+}
+
+// sorted returns the values in order, since not every storage keeps the order of relations
+func sorted(values interface{}) []string {
+	var s []string
+	switch v := values.(type) {
+	case domain.Ingredients:
+		for _, i := range v {
+			s = append(s, string(i))
+		}
+	case domain.SourcingValues:
+		for _, sv := range v {
+			s = append(s, string(sv))
+		}
+	}
+	sort.Strings(s)
+	return s
+}
+
+func productIds(icecreams []*domain.Icecream) []string {
+	ids := []string{}
+	for _, icecream := range icecreams {
+		ids = append(ids, icecream.ProductID)
+	}
+	return ids
+}
+
+func formatId(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,154 @@
+// Package search approximates the full-text search of postgres for the stores
+// without one: the search terms are looked up within the texts of an icecream.
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fraenky8/zlr-ca/pkg/domain"
+)
+
+// Terms splits the query into lower case words. Words prefixed with a minus are excluded.
+func Terms(query string) (terms, excluded []string) {
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		negated := strings.HasPrefix(word, "-")
+		word = strings.Trim(word, `-"'.,;:!?()`)
+		if word == "" || word == "or" {
+			continue
+		}
+		if negated {
+			excluded = append(excluded, word)
+			continue
+		}
+		terms = append(terms, word)
+	}
+	return terms, excluded
+}
+
+// Match scores the icecream for the terms, nil if it does not contain all of them or an
+// excluded one. The weights of the fields follow the ones of the search vector in postgres.
+func Match(icecream *domain.Icecream, ingredients []string, terms, excluded []string) *domain.IcecreamSearchResult {
+
+	if len(terms) == 0 {
+		return nil
+	}
+
+	fields := []struct {
+		name   string
+		value  string
+		weight float64
+	}{
+		{"name", icecream.Name, 1.0},
+		{"description", icecream.Description, 0.4},
+		{"story", icecream.Story, 0.2},
+		{"", strings.Join(ingredients, " "), 0.1},
+	}
+
+	for _, term := range excluded {
+		for _, field := range fields {
+			if contains(field.value, term) {
+				return nil
+			}
+		}
+	}
+
+	var score float64
+	for _, term := range terms {
+		var weight float64
+		for _, field := range fields {
+			if contains(field.value, term) && field.weight > weight {
+				weight = field.weight
+			}
+		}
+		if weight == 0 {
+			return nil
+		}
+		score += weight
+	}
+
+	highlights := make(map[string]string)
+	for _, field := range fields {
+		if field.name == "" {
+			continue
+		}
+		if highlight, ok := Highlight(field.value, terms); ok {
+			highlights[field.name] = highlight
+		}
+	}
+
+	return &domain.IcecreamSearchResult{
+		Icecream:   icecream,
+		Score:      score / float64(len(terms)),
+		Highlights: highlights,
+	}
+}
+
+// Rank orders the results by score, best first, and cuts them after limit
+func Rank(results []*domain.IcecreamSearchResult, limit int) []*domain.IcecreamSearchResult {
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		a, _ := strconv.ParseInt(results[i].ProductID, 10, 64)
+		b, _ := strconv.ParseInt(results[j].ProductID, 10, 64)
+		return a < b
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// Highlight marks all occurrences of the terms with <b> like ts_headline does.
+// It reports whether there was any occurrence.
+func Highlight(s string, terms []string) (string, bool) {
+
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		// lowering changed the length of some letters, better mark nothing than the wrong ones
+		return "", false
+	}
+	marked := make([]bool, len(s))
+
+	found := false
+	for _, term := range terms {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], term)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(term); k++ {
+				marked[k] = true
+			}
+			found = true
+			i += j + len(term)
+		}
+	}
+
+	if !found {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString("<b>")
+		}
+		b.WriteByte(s[i])
+		if marked[i] && (i == len(s)-1 || !marked[i+1]) {
+			b.WriteString("</b>")
+		}
+	}
+
+	return b.String(), true
+}
+
+// contains reports whether s contains the term ignoring the case
+func contains(s, term string) bool {
+	return strings.Contains(strings.ToLower(s), term)
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoSQLite is returned by NewSQLite if the sqlite driver is not built in, see sqlite_driver.go
+var ErrNoSQLite = errors.New("sqlite is not supported by this build, build it with -tags sqlite")
+
+// SQLite keeps the whole database in a single file. The tables live in the
+// schema main, which is the one of every sqlite database, so Config.Schema is
+// set to it. The tables get created by the migrations, see package migrations.
+type SQLite struct {
+	db  *sqlx.DB
+	cfg *Config
+}
+
+func NewSQLite(config *Config) (*SQLite, error) {
+	if !sqliteDriver() {
+		return nil, ErrNoSQLite
+	}
+
+	if config.DSN == "" {
+		return nil, fmt.Errorf("missing dsn, the file of the sqlite database")
+	}
+
+	config.Schema = "main"
+
+	lite := &SQLite{cfg: config}
+
+	if err := lite.Connect(); err != nil {
+		return nil, err
+	}
+
+	return lite, nil
+}
+
+// sqliteDriver reports whether the sqlite driver is registered
+func sqliteDriver() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite" {
+			return true
+		}
+	}
+	return false
+}
+
+func (lite *SQLite) Connect() (err error) {
+
+	// the cascades of the relations need the foreign keys to be enforced
+	dsn := lite.cfg.DSN
+	if strings.Contains(dsn, "?") {
+		dsn += "&_pragma=foreign_keys(1)"
+	} else {
+		dsn += "?_pragma=foreign_keys(1)"
+	}
+
+	lite.db, err = sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return fmt.Errorf("could not open database: %v", err)
+	}
+
+	// sqlite writes one at a time anyway and an in-memory database
+	// exists only as long as its single connection
+	lite.db.SetMaxOpenConns(1)
+
+	return nil
+}
+
+func (lite *SQLite) Close() error {
+	return lite.db.Close()
+}
+
+func (lite *SQLite) DB() *sqlx.DB {
+	return lite.db
+}
+
+func (lite *SQLite) Config() *Config {
+	return lite.cfg
+}
+
+func (lite *SQLite) Dialect() Dialect {
+	return SQLiteDialect{}
+}
+
+func (lite *SQLite) Executor() Executor {
+	return &dialectExecutor{executor: lite.db, dialect: lite.Dialect()}
+}
+
+func (lite *SQLite) Transaction(fn func(tx Database) error) (err error) {
+
+	tx, err := lite.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(&SQLiteTx{tx: tx, lite: lite}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SQLiteTx is a Database bound to a running transaction
+type SQLiteTx struct {
+	tx   *sqlx.Tx
+	lite *SQLite
+}
+
+func (t *SQLiteTx) Connect() error {
+	return fmt.Errorf("cannot connect within a transaction")
+}
+
+func (t *SQLiteTx) Close() error {
+	return fmt.Errorf("cannot close a transaction")
+}
+
+func (t *SQLiteTx) DB() *sqlx.DB {
+	return t.lite.DB()
+}
+
+func (t *SQLiteTx) Config() *Config {
+	return t.lite.Config()
+}
+
+func (t *SQLiteTx) Dialect() Dialect {
+	return t.lite.Dialect()
+}
+
+func (t *SQLiteTx) Executor() Executor {
+	return &dialectExecutor{executor: t.tx, dialect: t.Dialect()}
+}
+
+// Transaction joins the already running transaction
+func (t *SQLiteTx) Transaction(fn func(tx Database) error) error {
+	return fn(t)
+}
+
+// dialectExecutor rebinds the placeholders of every statement for the dialect
+type dialectExecutor struct {
+	executor Executor
+	dialect  Dialect
+}
+
+func (e *dialectExecutor) Get(dest interface{}, query string, args ...interface{}) error {
+	return e.executor.Get(dest, e.dialect.Rebind(query), args...)
+}
+
+func (e *dialectExecutor) Select(dest interface{}, query string, args ...interface{}) error {
+	return e.executor.Select(dest, e.dialect.Rebind(query), args...)
+}
+
+func (e *dialectExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return e.executor.Exec(e.dialect.Rebind(query), args...)
+}
+
+func (e *dialectExecutor) Preparex(query string) (*sqlx.Stmt, error) {
+	return e.executor.Preparex(e.dialect.Rebind(query))
+}
+
+// Rebind turns the ? placeholders of sqlx.In into $n, which are rebound on execution
+func (e *dialectExecutor) Rebind(query string) string {
+	return sqlx.Rebind(sqlx.DOLLAR, query)
+}
@@ -0,0 +1,8 @@
+//go:build sqlite
+// +build sqlite
+
+package storage
+
+// The sqlite driver is only built in with -tags sqlite, for the kiosks. It is pure go,
+// so no cgo is needed, but it requires a recent go, which the postgres image does not.
+import _ "modernc.org/sqlite"